@@ -0,0 +1,255 @@
+package hmm
+
+import "math"
+
+// A Segment is a run of consecutive timesteps which were
+// assigned to the same state.
+type Segment struct {
+	State State
+
+	// Start is the first timestep in the segment, and End
+	// is one past the last timestep.
+	Start int
+	End   int
+}
+
+// An Alignment is the result of constrained decoding.
+type Alignment struct {
+	// Path stores the hidden state for each timestep.
+	// Silent states are not included.
+	Path []State
+
+	// Segments partitions the timesteps by state.
+	Segments []Segment
+
+	// LogProb is the joint log probability of the path
+	// and the observations.
+	LogProb float64
+}
+
+// MostLikelyConstrained is like MostLikely, but the state
+// at each timestep is restricted by the corresponding
+// constraint.
+// Constraints with a single state may be used as anchor
+// points.
+//
+// Unlike MostLikely, the resulting path has exactly one
+// state per timestep, since paths through silent states
+// are folded into the transitions between timesteps.
+// Each segment of the result is a maximal run of the same
+// state.
+//
+// The constraints slice must either be nil or have one
+// entry per observation.
+//
+// If no path satisfies the constraints, nil is returned.
+func MostLikelyConstrained(h *HMM, obs []Obs, constraints []StateConstraint) *Alignment {
+	checkConstraints(obs, constraints)
+	c := newHMMCache(h)
+	if len(obs) == 0 {
+		return emptyAlignment(c)
+	}
+
+	probs := negInfSlice(len(h.States))
+	c.Init.Iter(func(state int, prob float64) {
+		if !c.Silent[state] {
+			probs[state] = prob
+		}
+	})
+
+	var backPointers [][]int
+
+	for t := range obs {
+		emitProbs := constrainedEmissions(c, h, obs, constraints, t)
+		for state, prob := range emitProbs {
+			probs[state] += prob
+		}
+		if t+1 == len(obs) {
+			break
+		}
+		newProbs := negInfSlice(len(h.States))
+		pointers := make([]int, len(h.States))
+		for _, trans := range c.Transitions {
+			if c.Silent[trans.To] || c.Silent[trans.From] {
+				continue
+			}
+			prob := probs[trans.From] + trans.Prob
+			if prob > newProbs[trans.To] {
+				newProbs[trans.To] = prob
+				pointers[trans.To] = trans.From
+			}
+		}
+		probs = newProbs
+		backPointers = append(backPointers, pointers)
+	}
+
+	if c.Terminal >= 0 {
+		probs = finalTransitionProbs(c, probs)
+	}
+	best := -1
+	bestProb := math.Inf(-1)
+	for state, prob := range probs {
+		if prob > bestProb {
+			best = state
+			bestProb = prob
+		}
+	}
+	if best < 0 {
+		return nil
+	}
+
+	indices := make([]int, len(obs))
+	indices[len(obs)-1] = best
+	for t := len(obs) - 1; t > 0; t-- {
+		indices[t-1] = backPointers[t-1][indices[t]]
+	}
+	res := &Alignment{LogProb: bestProb}
+	for t, idx := range indices {
+		state := h.States[idx]
+		res.Path = append(res.Path, state)
+		if t == 0 || indices[t-1] != idx {
+			res.Segments = append(res.Segments, Segment{State: state, Start: t})
+		}
+		res.Segments[len(res.Segments)-1].End = t + 1
+	}
+	return res
+}
+
+// ForceAlign finds the most probable path which visits
+// the given states in order, spending at least one
+// timestep in each state.
+// This is useful for aligning observations to a known
+// transcript, where order lists the states of the
+// transcript.
+//
+// The resulting alignment has one segment per entry in
+// order, even if consecutive entries are the same state.
+// Paths through silent states are folded into the
+// transitions between timesteps, so the entries of order
+// should be emitting states.
+//
+// If no such path exists, nil is returned.
+func ForceAlign(h *HMM, obs []Obs, order []State) *Alignment {
+	c := newHMMCache(h)
+	if len(order) == 0 {
+		if len(obs) == 0 {
+			return emptyAlignment(c)
+		}
+		return nil
+	} else if len(order) > len(obs) {
+		return nil
+	}
+
+	orderIdxs := make([]int, len(order))
+	for i, state := range order {
+		idx, ok := c.S2I[state]
+		if !ok || c.Silent[idx] {
+			return nil
+		}
+		orderIdxs[i] = idx
+	}
+	trans := denseTransitions(c, len(h.States))
+
+	// probs[k] is the probability of being in segment k.
+	probs := negInfSlice(len(order))
+	if prob, ok := c.Init.Get(orderIdxs[0]); ok {
+		probs[0] = prob
+	}
+
+	// advanced[t][k] indicates if segment k began at
+	// timestep t.
+	advanced := make([][]bool, len(obs))
+	for t, o := range obs {
+		emitProbs := emissionLogProbs(h.Emitter, o, h.States...)
+		advanced[t] = make([]bool, len(order))
+		if t > 0 {
+			newProbs := negInfSlice(len(order))
+			for k, idx := range orderIdxs {
+				newProbs[k] = probs[k] + trans[idx][idx]
+				if k > 0 {
+					prob := probs[k-1] + trans[orderIdxs[k-1]][idx]
+					if prob > newProbs[k] {
+						newProbs[k] = prob
+						advanced[t][k] = true
+					}
+				}
+			}
+			probs = newProbs
+		} else {
+			advanced[t][0] = true
+		}
+		for k, idx := range orderIdxs {
+			probs[k] += emitProbs[idx]
+		}
+	}
+
+	last := len(order) - 1
+	logProb := probs[last]
+	if c.Terminal >= 0 {
+		logProb += trans[orderIdxs[last]][c.Terminal]
+	}
+	if math.IsInf(logProb, -1) {
+		return nil
+	}
+
+	res := &Alignment{
+		Path:     make([]State, len(obs)),
+		Segments: make([]Segment, len(order)),
+		LogProb:  logProb,
+	}
+	k := last
+	end := len(obs)
+	for t := len(obs) - 1; t >= 0; t-- {
+		res.Path[t] = order[k]
+		if advanced[t][k] {
+			res.Segments[k] = Segment{State: order[k], Start: t, End: end}
+			end = t
+			k--
+		}
+	}
+	return res
+}
+
+// emptyAlignment creates the alignment for an empty
+// observation sequence, or returns nil if the empty
+// sequence is impossible.
+func emptyAlignment(c *hmmCache) *Alignment {
+	logProb := emptyLogLikelihood(c)
+	if math.IsInf(logProb, -1) {
+		return nil
+	}
+	return &Alignment{LogProb: logProb}
+}
+
+// finalTransitionProbs adds the probability of
+// transitioning to the terminal state to each entry.
+func finalTransitionProbs(c *hmmCache, probs []float64) []float64 {
+	res := negInfSlice(len(probs))
+	for _, trans := range c.Transitions {
+		if trans.To == c.Terminal && !c.Silent[trans.From] {
+			res[trans.From] = probs[trans.From] + trans.Prob
+		}
+	}
+	return res
+}
+
+// denseTransitions creates a matrix of log probabilities
+// from the cached transitions.
+func denseTransitions(c *hmmCache, numStates int) [][]float64 {
+	res := make([][]float64, numStates)
+	for i := range res {
+		res[i] = negInfSlice(numStates)
+	}
+	for _, trans := range c.Transitions {
+		res[trans.From][trans.To] = trans.Prob
+	}
+	return res
+}
+
+func negInfSlice(n int) []float64 {
+	res := make([]float64, n)
+	for i := range res {
+		res[i] = math.Inf(-1)
+	}
+	return res
+}
@@ -0,0 +1,134 @@
+package hmm
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestMostLikelyConstrained(t *testing.T) {
+	h := testingHMM()
+	obs := []Obs{"x", "z", "y", "x"}
+
+	actual := MostLikelyConstrained(h, obs, nil)
+	if expected := MostLikely(h, obs); !stateSeqsEqual(actual.Path, expected) {
+		t.Errorf("expected %v but got %v", expected, actual.Path)
+	}
+
+	constraints := []StateConstraint{nil, {"C"}, nil, {"A", "B"}}
+	actual = MostLikelyConstrained(h, obs, constraints)
+	expected, expectedProb := bruteForceMostLikely(h, obs, func(path []State) bool {
+		return path[1] == "C" && (path[3] == "A" || path[3] == "B")
+	})
+	if actual == nil {
+		t.Fatal("no path found")
+	}
+	if !stateSeqsEqual(actual.Path, expected) {
+		t.Errorf("expected %v but got %v", expected, actual.Path)
+	}
+	if math.Abs(actual.LogProb-expectedProb) > 1e-4 {
+		t.Errorf("expected log prob %f but got %f", expectedProb, actual.LogProb)
+	}
+	var segEnd int
+	for _, seg := range actual.Segments {
+		if seg.Start != segEnd {
+			t.Errorf("segment %v does not start at %d", seg, segEnd)
+		}
+		for i := seg.Start; i < seg.End; i++ {
+			if actual.Path[i] != seg.State {
+				t.Errorf("segment %v does not match path %v", seg, actual.Path)
+			}
+		}
+		segEnd = seg.End
+	}
+
+	impossible := []StateConstraint{{"B"}, nil, nil, nil}
+	if res := MostLikelyConstrained(h, obs, impossible); res != nil {
+		t.Errorf("expected nil but got %v", res)
+	}
+}
+
+func TestForceAlign(t *testing.T) {
+	h := testingHMM()
+	obs := []Obs{"x", "z", "z", "y", "x"}
+	order := []State{"C", "A", "B", "C"}
+
+	actual := ForceAlign(h, obs, order)
+	expected, expectedProb := bruteForceMostLikely(h, obs, func(path []State) bool {
+		var runs []State
+		for i, state := range path {
+			if i == 0 || path[i-1] != state {
+				runs = append(runs, state)
+			}
+		}
+		return stateSeqsEqual(runs, order)
+	})
+	if actual == nil {
+		t.Fatal("no path found")
+	}
+	if !stateSeqsEqual(actual.Path, expected) {
+		t.Errorf("expected %v but got %v", expected, actual.Path)
+	}
+	if math.Abs(actual.LogProb-expectedProb) > 1e-4 {
+		t.Errorf("expected log prob %f but got %f", expectedProb, actual.LogProb)
+	}
+	var segStates []State
+	for _, seg := range actual.Segments {
+		segStates = append(segStates, seg.State)
+	}
+	if !reflect.DeepEqual(segStates, order) {
+		t.Errorf("expected segments for %v but got %v", order, actual.Segments)
+	}
+
+	if res := ForceAlign(h, obs[:3], order); res != nil {
+		t.Errorf("expected nil but got %v", res)
+	}
+}
+
+// bruteForceMostLikely finds the most likely path which
+// satisfies the predicate by enumerating every path.
+func bruteForceMostLikely(h *HMM, obs []Obs, pred func([]State) bool) ([]State, float64) {
+	var bestPath []State
+	bestProb := math.Inf(-1)
+	path := make([]State, len(obs))
+	var rec func(t int)
+	rec = func(t int) {
+		if t == len(obs) {
+			if !pred(path) {
+				return
+			}
+			prob := pathLogProb(h, path, obs)
+			if prob > bestProb {
+				bestProb = prob
+				bestPath = append([]State{}, path...)
+			}
+			return
+		}
+		for _, state := range h.States {
+			path[t] = state
+			rec(t + 1)
+		}
+	}
+	rec(0)
+	return bestPath, bestProb
+}
+
+func pathLogProb(h *HMM, path []State, obs []Obs) float64 {
+	param := func(m map[Transition]float64, t Transition) float64 {
+		if prob, ok := m[t]; ok {
+			return prob
+		}
+		return math.Inf(-1)
+	}
+	prob, ok := h.Init[path[0]]
+	if !ok {
+		return math.Inf(-1)
+	}
+	for i, state := range path {
+		prob += h.Emitter.LogProbs(obs[i], state)[0]
+		if i > 0 {
+			prob += param(h.Transitions, Transition{From: path[i-1], To: state})
+		}
+	}
+	return prob + param(h.Transitions, Transition{From: path[len(path)-1], To: h.TerminalState})
+}
@@ -16,7 +16,65 @@ import (
 // If it is 0, then GOMAXPROCS is used.
 //
 // The HMM must use a TabularEmitter.
+// Missing observations contribute to the initial state and
+// transition statistics, but not to the emission
+// statistics.
 func BaumWelch(h *HMM, data <-chan []Obs, parallelism int) *HMM {
+	seqs := make(chan ConstrainedSeq)
+	go func() {
+		defer close(seqs)
+		for sample := range data {
+			seqs <- ConstrainedSeq{Obs: sample}
+		}
+	}()
+	return BaumWelchConstrained(h, seqs, parallelism)
+}
+
+// BaumWelchConstrained is like BaumWelch, but the hidden
+// states of the training sequences may be partially
+// known.
+// Constrained timesteps clamp the inferred posteriors,
+// while unconstrained timesteps are inferred as usual.
+func BaumWelchConstrained(h *HMM, data <-chan ConstrainedSeq, parallelism int) *HMM {
+	bw := baumWelchWorkers(h, parallelism, func(bw *baumWelch) {
+		for sample := range data {
+			bw.Accumulate(sample.Obs, sample.Constraints, 1)
+		}
+	})
+	bw.Normalize()
+	return bw.Result()
+}
+
+// A WeightedSeq is a training sequence with an importance
+// weight.
+type WeightedSeq struct {
+	Obs    []Obs
+	Weight float64
+}
+
+// BaumWelchWeighted is like BaumWelch, but each training
+// sequence has an importance weight which scales its
+// contribution to the expected statistics.
+// For example, a sequence with weight 2 is equivalent to
+// two copies of the sequence with weight 1.
+//
+// Weights must be non-negative.
+// See WeightedLogLikelihood for monitoring convergence.
+func BaumWelchWeighted(h *HMM, data <-chan WeightedSeq, parallelism int) *HMM {
+	bw := baumWelchWorkers(h, parallelism, func(bw *baumWelch) {
+		for sample := range data {
+			bw.Accumulate(sample.Obs, nil, sample.Weight)
+		}
+	})
+	bw.Normalize()
+	return bw.Result()
+}
+
+// baumWelchWorkers runs the E-step of BaumWelch, where
+// each worker accumulates statistics into bw from its
+// share of the data.
+// The resulting statistics are not normalized.
+func baumWelchWorkers(h *HMM, parallelism int, worker func(bw *baumWelch)) *baumWelch {
 	if parallelism == 0 {
 		parallelism = runtime.GOMAXPROCS(0)
 	}
@@ -25,19 +83,17 @@ func BaumWelch(h *HMM, data <-chan []Obs, parallelism int) *HMM {
 	for i := 0; i < parallelism; i++ {
 		wg.Add(1)
 		go func() {
-			for sample := range data {
-				bw.Accumulate(sample)
-			}
+			worker(bw)
 			wg.Done()
 		}()
 	}
 	wg.Wait()
-	bw.Normalize()
-	return bw.Result()
+	return bw
 }
 
 type baumWelch struct {
 	HMM           *HMM
+	Cache         *hmmCache
 	TerminalIndex int
 
 	InitTally *fastStateMap
@@ -54,7 +110,8 @@ type baumWelch struct {
 
 func newBaumWelch(h *HMM) *baumWelch {
 	b := &baumWelch{
-		HMM: h,
+		HMM:   h,
+		Cache: newHMMCache(h),
 
 		InitTally: newFastStateMap(h),
 		InitTotal: math.Inf(-1),
@@ -75,18 +132,30 @@ func newBaumWelch(h *HMM) *baumWelch {
 	return b
 }
 
-func (b *baumWelch) Accumulate(sample []Obs) {
+func (b *baumWelch) Accumulate(sample []Obs, constraints []StateConstraint, weight float64) {
+	checkConstraints(sample, constraints)
+	if weight < 0 {
+		panic("sample weight must be non-negative")
+	} else if weight == 0 {
+		return
+	}
+	logWeight := math.Log(weight)
+
 	if len(sample) == 0 {
 		if b.HMM.TerminalState != nil {
 			b.UpdateLock.Lock()
-			b.InitTotal = addLogs(b.InitTotal, 0)
-			b.InitTally.AddLog(b.TerminalIndex, 0)
+			b.InitTotal = addLogs(b.InitTotal, logWeight)
+			b.InitTally.AddLog(b.TerminalIndex, logWeight)
 			b.UpdateLock.Unlock()
 		}
 		return
 	}
 
-	fb := NewForwardBackward(b.HMM, sample)
+	fb := newForwardBackward(b.Cache, b.HMM, sample, constraints)
+	if math.IsInf(fb.LogLikelihood(), -1) {
+		// The constraints cannot be satisfied.
+		return
+	}
 
 	var dists []*fastStateMap
 	for t := 0; t < len(sample); t++ {
@@ -105,9 +174,9 @@ func (b *baumWelch) Accumulate(sample []Obs) {
 	}
 
 	b.UpdateLock.Lock()
-	b.InitTotal = addLogs(b.InitTotal, 0)
+	b.InitTotal = addLogs(b.InitTotal, logWeight)
 	dists[0].Iter(func(state int, val float64) {
-		b.InitTally.AddLog(state, val)
+		b.InitTally.AddLog(state, val+logWeight)
 	})
 	b.UpdateLock.Unlock()
 
@@ -115,9 +184,9 @@ func (b *baumWelch) Accumulate(sample []Obs) {
 		prevDist := dists[i]
 		prevDist.Iter(func(from int, prevProb float64) {
 			b.UpdateLock.Lock()
-			b.FromStateTotals.AddLog(from, prevProb)
+			b.FromStateTotals.AddLog(from, prevProb+logWeight)
 			condDist[from].Iter(func(to int, condProb float64) {
-				joint := condProb + prevProb
+				joint := condProb + prevProb + logWeight
 				b.TransTally[from].AddLog(to, joint)
 			})
 			b.UpdateLock.Unlock()
@@ -125,8 +194,12 @@ func (b *baumWelch) Accumulate(sample []Obs) {
 	}
 
 	for t, obs := range sample {
+		if isMissing(obs) {
+			continue
+		}
 		b.UpdateLock.Lock()
 		dists[t].Iter(func(state int, prob float64) {
+			prob += logWeight
 			b.EmitTotals.AddLog(state, prob)
 			emissions := b.EmitTally[state]
 			if oldProb, ok := emissions[obs]; ok {
@@ -140,6 +213,13 @@ func (b *baumWelch) Accumulate(sample []Obs) {
 }
 
 func (b *baumWelch) Normalize() {
+	b.expandSilent()
+	b.normalizeTallies()
+}
+
+// normalizeTallies turns the tallies into log
+// probabilities by dividing by the totals.
+func (b *baumWelch) normalizeTallies() {
 	b.FromStateTotals.Iter(func(from int, total float64) {
 		b.TransTally[from].AddAll(-total)
 	})
@@ -177,3 +257,91 @@ func (b *baumWelch) Result() *HMM {
 
 	return &res
 }
+
+// expandSilent converts the initial state and transition
+// tallies, which are accumulated over the silent closure
+// of the model, into tallies for the model's actual
+// initial states and transitions.
+//
+// Each closure transition is split up among the silent
+// paths it represents, in proportion to the probability
+// of each path.
+func (b *baumWelch) expandSilent() {
+	c := b.Cache
+	if len(c.SilentOrder) == 0 {
+		return
+	}
+	h := b.HMM
+
+	reachTarget := make([]*fastStateMap, len(h.States))
+	for target := range h.States {
+		if c.isTarget(target) {
+			reachTarget[target] = c.reachTarget(h, target)
+		}
+	}
+
+	// For each silent state s, maps each target t to the
+	// sum over sources i of P(s | i) * N(i, t) / P(t | i),
+	// where N is the closure tally and P(y | x) is the
+	// probability of reaching y from x silently.
+	// Multiplying by P(t | s) gives the expected number of
+	// visits to s on the way to t.
+	silentVisits := make([]*fastStateMap, len(h.States))
+	for _, state := range c.SilentOrder {
+		silentVisits[state] = newFastStateMap(h)
+	}
+
+	// expandSource computes the tally for the first step
+	// out of a source, given the source's closure tally,
+	// closure probabilities, and actual first steps.
+	expandSource := func(tally, closure, firstSteps *fastStateMap) *fastStateMap {
+		ratios := newFastStateMap(h)
+		tally.Iter(func(target int, count float64) {
+			prob, _ := closure.Get(target)
+			ratios.Set(target, count-prob)
+		})
+		for _, state := range c.SilentOrder {
+			if reachProb, ok := closure.Get(state); ok {
+				ratios.Iter(func(target int, ratio float64) {
+					silentVisits[state].AddLog(target, reachProb+ratio)
+				})
+			}
+		}
+		res := newFastStateMap(h)
+		firstSteps.Iter(func(to int, stepProb float64) {
+			ratios.Iter(func(target int, ratio float64) {
+				if prob, ok := reachTarget[target].Get(to); ok {
+					res.AddLog(to, stepProb+ratio+prob)
+				}
+			})
+		})
+		return res
+	}
+
+	b.InitTally = expandSource(b.InitTally, c.InitClosure, newFastStateMapFrom(h, h.Init))
+	for from, closure := range c.Closure {
+		if closure == nil {
+			continue
+		}
+		firstSteps := newFastStateMap(h)
+		for _, trans := range c.Outgoing[from] {
+			firstSteps.AddLog(trans.To, trans.Prob)
+		}
+		b.TransTally[from] = expandSource(b.TransTally[from], closure, firstSteps)
+	}
+
+	for _, from := range c.SilentOrder {
+		tally := newFastStateMap(h)
+		for _, trans := range c.Outgoing[from] {
+			silentVisits[from].Iter(func(target int, visits float64) {
+				if prob, ok := reachTarget[target].Get(trans.To); ok {
+					tally.AddLog(trans.To, visits+trans.Prob+prob)
+				}
+			})
+		}
+		tally.Iter(func(to int, count float64) {
+			b.FromStateTotals.AddLog(from, count)
+		})
+		b.TransTally[from] = tally
+	}
+}
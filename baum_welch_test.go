@@ -1,6 +1,10 @@
 package hmm
 
-import "testing"
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
 
 func TestBaumWelch(t *testing.T) {
 	states := []State{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
@@ -45,3 +49,57 @@ func BenchmarkBaumWelch(b *testing.B) {
 		BaumWelch(h, makeSamples(), 1)
 	}
 }
+
+func TestBaumWelchWeighted(t *testing.T) {
+	states := []State{0, 1, 2, 3}
+	obses := []Obs{"a", "b", "c"}
+	h := RandomHMM(rand.New(rand.NewSource(1337)), states, 3, obses)
+
+	weighted := []WeightedSeq{
+		{Obs: []Obs{"a", "b", "c"}, Weight: 2},
+		{Obs: []Obs{"c", "a"}, Weight: 1},
+		{Obs: []Obs{"b"}, Weight: 3},
+		{Obs: []Obs{"a"}, Weight: 0},
+	}
+	weightedData := make(chan WeightedSeq, len(weighted))
+	unweightedData := make(chan []Obs, 10)
+	var expectedLikelihood float64
+	for _, seq := range weighted {
+		weightedData <- seq
+		for i := 0; i < int(seq.Weight); i++ {
+			unweightedData <- seq.Obs
+			expectedLikelihood += LogLikelihood(h, seq.Obs)
+		}
+	}
+	close(weightedData)
+	close(unweightedData)
+
+	actualLikelihood := WeightedLogLikelihood(h, weighted)
+	if math.Abs(actualLikelihood-expectedLikelihood) > 1e-4 {
+		t.Errorf("expected log-likelihood %f but got %f", expectedLikelihood, actualLikelihood)
+	}
+
+	expected := BaumWelch(h, unweightedData, 0)
+	actual := BaumWelchWeighted(h, weightedData, 0)
+	for trans, prob := range expected.Transitions {
+		if math.Abs(actual.Transitions[trans]-prob) > 1e-4 {
+			t.Errorf("transition %v: expected %f but got %f", trans, prob,
+				actual.Transitions[trans])
+		}
+	}
+	for state, prob := range expected.Init {
+		if math.Abs(actual.Init[state]-prob) > 1e-4 {
+			t.Errorf("initial state %v: expected %f but got %f", state, prob,
+				actual.Init[state])
+		}
+	}
+	actualEmitter := actual.Emitter.(TabularEmitter)
+	for state, dist := range expected.Emitter.(TabularEmitter) {
+		for obs, prob := range dist {
+			if math.Abs(actualEmitter[state][obs]-prob) > 1e-4 {
+				t.Errorf("emission %v from %v: expected %f but got %f", obs, state, prob,
+					actualEmitter[state][obs])
+			}
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/unixpickle/hmm"
+)
+
+func decodeCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("decode", "[data.txt]", stderr)
+	var format seqFormat
+	var modelPath string
+	var posterior bool
+	fs.BoolVar(&format.Chars, "chars", false, "treat each character as an observation")
+	fs.StringVar(&modelPath, "model", "", "model path (required)")
+	fs.BoolVar(&posterior, "posterior", false,
+		"pick the most likely state at each timestep instead of the most likely path")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	model, data, err := modelAndData(fs, modelPath, stdin, format)
+	if err != nil {
+		return err
+	}
+	for _, seq := range data {
+		var states []hmm.State
+		if posterior {
+			states = posteriorDecode(model, seq)
+		} else {
+			states = hmm.MostLikely(model, seq)
+		}
+		if states == nil && len(seq) > 0 {
+			fmt.Fprintln(stdout, "impossible")
+		} else {
+			fmt.Fprintln(stdout, formatStates(states))
+		}
+	}
+	return nil
+}
+
+// posteriorDecode finds the most likely state at each
+// timestep, or returns nil if the sequence is impossible.
+func posteriorDecode(h *hmm.HMM, seq []hmm.Obs) []hmm.State {
+	fb := hmm.NewForwardBackward(h, seq)
+	if math.IsInf(fb.LogLikelihood(), -1) {
+		return nil
+	}
+	res := make([]hmm.State, len(seq))
+	for t := range seq {
+		dist := fb.Dist(t)
+		bestProb := math.Inf(-1)
+		for _, state := range h.States {
+			if prob, ok := dist[state]; ok && prob > bestProb {
+				res[t] = state
+				bestProb = prob
+			}
+		}
+	}
+	return res
+}
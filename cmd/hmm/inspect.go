@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/unixpickle/hmm"
+)
+
+func inspectCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("inspect", "model", stderr)
+	var format string
+	var minProb float64
+	var topEmissions int
+	fs.StringVar(&format, "format", "text", "output format: text, json, or dot")
+	fs.Float64Var(&minProb, "min-prob", 0, "hide transitions below this probability (dot only)")
+	fs.IntVar(&topEmissions, "top", 3, "emissions to show per state (dot only)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected one model path")
+	}
+	model, err := loadModel(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "text":
+		return writeModelText(stdout, model)
+	case "json":
+		data, err := hmm.EncodeJSON(model, hmm.LinearSpace)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(stdout, string(data))
+		return err
+	case "dot":
+		exporter := &hmm.DotExporter{MinProb: minProb, TopEmissions: topEmissions}
+		return exporter.Export(stdout, model)
+	default:
+		return fmt.Errorf("unknown format: %s", format)
+	}
+}
+
+// writeModelText prints the parameters of a model as
+// linear probabilities, omitting those which are 0.
+func writeModelText(w io.Writer, h *hmm.HMM) error {
+	buf := bufio.NewWriter(w)
+	fmt.Fprintf(buf, "States: %s\n", formatStates(h.States))
+	if h.TerminalState != nil {
+		fmt.Fprintf(buf, "Terminal: %v\n", h.TerminalState)
+	}
+	if len(h.SilentStates) > 0 {
+		fmt.Fprintf(buf, "Silent: %s\n", formatStates(h.SilentStates))
+	}
+
+	fmt.Fprintln(buf, "\nInitial probabilities:")
+	for _, state := range h.States {
+		if prob, ok := h.Init[state]; ok && !math.IsInf(prob, -1) {
+			fmt.Fprintf(buf, "  %v\t%.6f\n", state, math.Exp(prob))
+		}
+	}
+
+	fmt.Fprintln(buf, "\nTransitions:")
+	for _, from := range h.States {
+		for _, to := range h.States {
+			prob, ok := h.Transitions[hmm.Transition{From: from, To: to}]
+			if ok && !math.IsInf(prob, -1) {
+				fmt.Fprintf(buf, "  %v -> %v\t%.6f\n", from, to, math.Exp(prob))
+			}
+		}
+	}
+
+	fmt.Fprintln(buf, "\nEmissions:")
+	switch emitter := h.Emitter.(type) {
+	case hmm.TabularEmitter:
+		for _, state := range h.States {
+			dist, ok := emitter[state]
+			if !ok {
+				continue
+			}
+			var names []string
+			probs := map[string]float64{}
+			for obs, prob := range dist {
+				if !math.IsInf(prob, -1) {
+					name := fmt.Sprint(obs)
+					names = append(names, name)
+					probs[name] = prob
+				}
+			}
+			sort.Strings(names)
+			fmt.Fprintf(buf, "  %v:", state)
+			for _, name := range names {
+				fmt.Fprintf(buf, " %s=%.6f", name, math.Exp(probs[name]))
+			}
+			fmt.Fprintln(buf)
+		}
+	case hmm.GaussianEmitter:
+		for _, state := range h.States {
+			if dist, ok := emitter[state]; ok {
+				fmt.Fprintf(buf, "  %v: mean=%v var=%v\n", state, dist.Mean, dist.Var)
+			}
+		}
+	default:
+		fmt.Fprintf(buf, "  (%T)\n", h.Emitter)
+	}
+	return buf.Flush()
+}
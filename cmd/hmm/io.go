@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/hmm"
+)
+
+// seqFormat describes how sequences are written as lines
+// of text.
+type seqFormat struct {
+	// Chars indicates that each character is an
+	// observation, rather than each whitespace-separated
+	// token.
+	Chars bool
+}
+
+// Split splits a line into observations.
+func (s seqFormat) Split(line string) []hmm.Obs {
+	var res []hmm.Obs
+	if s.Chars {
+		for _, ch := range line {
+			res = append(res, string(ch))
+		}
+	} else {
+		for _, field := range strings.Fields(line) {
+			res = append(res, field)
+		}
+	}
+	return res
+}
+
+// Join formats a sequence of observations as a line.
+func (s seqFormat) Join(obs []hmm.Obs) string {
+	parts := make([]string, len(obs))
+	for i, o := range obs {
+		parts[i] = fmt.Sprint(o)
+	}
+	if s.Chars {
+		return strings.Join(parts, "")
+	}
+	return strings.Join(parts, " ")
+}
+
+// formatStates formats a sequence of states as a
+// space-separated line.
+func formatStates(states []hmm.State) string {
+	parts := make([]string, len(states))
+	for i, state := range states {
+		parts[i] = fmt.Sprint(state)
+	}
+	return strings.Join(parts, " ")
+}
+
+// readSequences reads one sequence per line from the path,
+// or from stdin if the path is "-".
+//
+// Trailing carriage returns are removed from each line, but
+// blank lines are kept as empty sequences.
+func readSequences(path string, stdin io.Reader, format seqFormat) (seqs [][]hmm.Obs,
+	err error) {
+	defer essentials.AddCtxTo("read sequences", &err)
+	r := stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<24)
+	for scanner.Scan() {
+		seqs = append(seqs, format.Split(strings.TrimSuffix(scanner.Text(), "\r")))
+	}
+	return seqs, scanner.Err()
+}
+
+// observations returns the distinct observations in the
+// sequences, sorted.
+func observations(seqs [][]hmm.Obs) []hmm.Obs {
+	seen := map[string]bool{}
+	var names []string
+	for _, seq := range seqs {
+		for _, obs := range seq {
+			name := obs.(string)
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	res := make([]hmm.Obs, len(names))
+	for i, name := range names {
+		res[i] = name
+	}
+	return res
+}
+
+// loadModel reads a model saved by saveModel.
+func loadModel(path string) (h *hmm.HMM, err error) {
+	defer essentials.AddCtxTo("load model", &err)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(path, ".json") {
+		return hmm.DecodeJSON(data)
+	}
+	return hmm.DeserializeHMM(data)
+}
+
+// saveModel writes a model in the package's binary format,
+// or as JSON if the path ends in ".json".
+func saveModel(path string, h *hmm.HMM) (err error) {
+	defer essentials.AddCtxTo("save model", &err)
+	var data []byte
+	if strings.HasSuffix(path, ".json") {
+		data, err = hmm.EncodeJSON(h, hmm.LinearSpace)
+	} else {
+		data, err = h.Serialize()
+	}
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
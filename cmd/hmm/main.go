@@ -0,0 +1,122 @@
+// Command hmm trains and applies hidden Markov models with
+// discrete observations from the command line.
+//
+// Sequences are read from text files with one sequence per
+// line.
+// By default, each whitespace-separated token is an
+// observation; with the -chars flag, each character is.
+//
+// Models are stored in the binary format of the hmm
+// package, or as JSON if the file name ends in ".json".
+//
+// Run "hmm help" for a list of subcommands.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/unixpickle/hmm"
+)
+
+type command struct {
+	Name        string
+	Description string
+	Run         func(args []string, stdin io.Reader, stdout, stderr io.Writer) error
+}
+
+var commands = []command{
+	{"train", "train a model with Baum-Welch", trainCommand},
+	{"decode", "find the hidden states for each sequence", decodeCommand},
+	{"sample", "sample sequences from a model", sampleCommand},
+	{"score", "compute the log-likelihood of each sequence", scoreCommand},
+	{"inspect", "print the parameters of a model", inspectCommand},
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		if err != flag.ErrHelp {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "-help" {
+		printUsage(stderr)
+		if len(args) == 0 {
+			return errors.New("missing subcommand")
+		}
+		return nil
+	}
+	for _, cmd := range commands {
+		if cmd.Name == args[0] {
+			return cmd.Run(args[1:], stdin, stdout, stderr)
+		}
+	}
+	printUsage(stderr)
+	return fmt.Errorf("unknown subcommand: %s", args[0])
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: hmm <subcommand> [flags] [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Subcommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", cmd.Name, cmd.Description)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Run "hmm <subcommand> -h" for the flags of a subcommand.`)
+}
+
+// newFlagSet creates a flag set for a subcommand.
+func newFlagSet(name, args string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: hmm %s [flags] %s\n\nFlags:\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// inputPath gets the single optional input file argument,
+// defaulting to stdin.
+func inputPath(fs *flag.FlagSet) (string, error) {
+	switch fs.NArg() {
+	case 0:
+		return "-", nil
+	case 1:
+		return fs.Arg(0), nil
+	default:
+		fs.Usage()
+		return "", errors.New("too many arguments")
+	}
+}
+
+// modelAndData loads the model from the -model flag and
+// the sequences from the input file argument.
+func modelAndData(fs *flag.FlagSet, modelPath string, stdin io.Reader,
+	format seqFormat) (*hmm.HMM, [][]hmm.Obs, error) {
+	if modelPath == "" {
+		fs.Usage()
+		return nil, nil, errors.New("missing -model flag")
+	}
+	path, err := inputPath(fs)
+	if err != nil {
+		return nil, nil, err
+	}
+	model, err := loadModel(modelPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := readSequences(path, stdin, format)
+	if err != nil {
+		return nil, nil, err
+	}
+	return model, data, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCommands(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hmm-cmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := strings.Repeat("abababab\nabab\nbababa\n", 10)
+	dataPath := filepath.Join(dir, "data.txt")
+	if err := ioutil.WriteFile(dataPath, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, modelName := range []string{"model.bin", "model.json"} {
+		modelPath := filepath.Join(dir, modelName)
+		runCommand(t, "", "train", "-chars", "-states", "2", "-iters", "30", "-restarts", "3",
+			"-seed", "1", "-out", modelPath, dataPath)
+
+		output := runCommand(t, "abab\nbb\n", "score", "-chars", "-model", modelPath)
+		lines := strings.Split(strings.TrimSpace(output), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("unexpected score output: %q", output)
+		}
+		good, _ := strconv.ParseFloat(lines[0], 64)
+		bad, _ := strconv.ParseFloat(lines[1], 64)
+		if good <= bad {
+			t.Errorf("expected %q to score better than %q", lines[0], lines[1])
+		}
+
+		for _, flag := range []string{"-posterior=false", "-posterior"} {
+			output = runCommand(t, "abab\n", "decode", "-chars", flag, "-model", modelPath)
+			states := strings.Fields(output)
+			if len(states) != 4 || states[0] != states[2] || states[0] == states[1] {
+				t.Errorf("%s: unexpected decoding: %q", flag, output)
+			}
+		}
+
+		output = runCommand(t, "", "sample", "-chars", "-n", "5", "-seed", "1", "-hidden",
+			"-model", modelPath)
+		lines = strings.Split(strings.TrimSpace(output), "\n")
+		if len(lines) != 5 {
+			t.Fatalf("unexpected sample output: %q", output)
+		}
+		for _, line := range lines {
+			parts := strings.Split(line, "\t")
+			if len(parts) != 2 || strings.Contains(parts[0], "aa") ||
+				strings.Contains(parts[0], "bb") {
+				t.Errorf("unexpected sample: %q", line)
+			}
+		}
+
+		for _, format := range []string{"text", "json", "dot"} {
+			output = runCommand(t, "", "inspect", "-format", format, modelPath)
+			if !strings.Contains(output, "a") || !strings.Contains(output, "b") {
+				t.Errorf("%s: unexpected output: %q", format, output)
+			}
+		}
+	}
+
+	initPath := filepath.Join(dir, "model.bin")
+	runCommand(t, data, "train", "-chars", "-init", initPath, "-iters", "2", "-out",
+		filepath.Join(dir, "retrained.bin"))
+}
+
+func TestCommandErrors(t *testing.T) {
+	invalid := [][]string{
+		{},
+		{"unknown"},
+		{"train", "-chars"},
+		{"score", "-model", "nonexistent.bin"},
+		{"sample"},
+		{"inspect", "a", "b"},
+	}
+	for _, args := range invalid {
+		var stdout, stderr bytes.Buffer
+		if err := run(args, strings.NewReader(""), &stdout, &stderr); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
+
+func runCommand(t *testing.T, stdin string, args ...string) string {
+	var stdout, stderr bytes.Buffer
+	if err := run(args, strings.NewReader(stdin), &stdout, &stderr); err != nil {
+		t.Fatalf("%v: %s\n%s", args, err, stderr.String())
+	}
+	return stdout.String()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+
+	"github.com/unixpickle/hmm"
+)
+
+func sampleCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("sample", "", stderr)
+	var format seqFormat
+	var modelPath string
+	var count, maxLen int
+	var seed int64
+	var hidden bool
+	fs.BoolVar(&format.Chars, "chars", false, "write observations without spaces")
+	fs.StringVar(&modelPath, "model", "", "model path (required)")
+	fs.IntVar(&count, "n", 1, "number of sequences")
+	fs.IntVar(&maxLen, "maxlen", 0, "maximum sequence length (required without a terminal state)")
+	fs.Int64Var(&seed, "seed", 0, "random seed (0 uses the current time)")
+	fs.BoolVar(&hidden, "hidden", false, "append a tab and the hidden states to each line")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return errors.New("too many arguments")
+	} else if modelPath == "" {
+		fs.Usage()
+		return errors.New("missing -model flag")
+	}
+	model, err := loadModel(modelPath)
+	if err != nil {
+		return err
+	}
+	if maxLen <= 0 && model.TerminalState == nil {
+		return errors.New("the model has no terminal state, so -maxlen is required")
+	}
+
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	gen := rand.New(rand.NewSource(seed))
+	for i := 0; i < count; i++ {
+		var states []hmm.State
+		var obs []hmm.Obs
+		if maxLen > 0 {
+			states, obs = model.SampleLen(gen, maxLen)
+		} else {
+			states, obs = model.Sample(gen)
+		}
+		line := format.Join(obs)
+		if hidden {
+			line += "\t" + formatStates(states)
+		}
+		fmt.Fprintln(stdout, line)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/unixpickle/hmm"
+)
+
+func scoreCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("score", "[data.txt]", stderr)
+	var format seqFormat
+	var modelPath string
+	var perSymbol bool
+	fs.BoolVar(&format.Chars, "chars", false, "treat each character as an observation")
+	fs.StringVar(&modelPath, "model", "", "model path (required)")
+	fs.BoolVar(&perSymbol, "per-symbol", false, "divide each score by the sequence length")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	model, data, err := modelAndData(fs, modelPath, stdin, format)
+	if err != nil {
+		return err
+	}
+	for _, seq := range data {
+		score := hmm.LogLikelihood(model, seq)
+		if perSymbol && len(seq) > 0 {
+			score /= float64(len(seq))
+		}
+		fmt.Fprintln(stdout, score)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+
+	"github.com/unixpickle/hmm"
+)
+
+func trainCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("train", "[data.txt]", stderr)
+	var format seqFormat
+	var numStates, iterations, restarts int
+	var terminal bool
+	var tolerance float64
+	var seed int64
+	var initPath, outPath string
+	fs.BoolVar(&format.Chars, "chars", false, "treat each character as an observation")
+	fs.IntVar(&numStates, "states", 2, "number of hidden states")
+	fs.BoolVar(&terminal, "terminal", true, "add a terminal state to model sequence ends")
+	fs.IntVar(&iterations, "iters", 20, "maximum number of Baum-Welch iterations")
+	fs.IntVar(&restarts, "restarts", 1, "number of random initializations")
+	fs.Float64Var(&tolerance, "tol", 0, "stop once an iteration improves by less than this")
+	fs.Int64Var(&seed, "seed", 0, "random seed (0 uses the current time)")
+	fs.StringVar(&initPath, "init", "", "continue training this model instead of random ones")
+	fs.StringVar(&outPath, "out", "", "output model path (required)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if outPath == "" {
+		fs.Usage()
+		return errors.New("missing -out flag")
+	} else if numStates < 1 || restarts < 1 {
+		return errors.New("-states and -restarts must be positive")
+	}
+	path, err := inputPath(fs)
+	if err != nil {
+		return err
+	}
+	data, err := readSequences(path, stdin, format)
+	if err != nil {
+		return err
+	}
+
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	gen := rand.New(rand.NewSource(seed))
+
+	var model *hmm.HMM
+	if initPath != "" {
+		if model, err = loadModel(initPath); err != nil {
+			return err
+		}
+		prev := totalLogLikelihood(model, data)
+		for i := 0; i < iterations; i++ {
+			model = hmm.BaumWelch(model, obsChan(data), 0)
+			ll := totalLogLikelihood(model, data)
+			if tolerance != 0 && ll-prev < tolerance {
+				break
+			}
+			prev = ll
+		}
+	} else {
+		trainer := &hmm.RandomRestarts{
+			Obs:        observations(data),
+			NumRuns:    restarts,
+			Iterations: iterations,
+			Tolerance:  tolerance,
+		}
+		for i := 0; i < numStates; i++ {
+			trainer.States = append(trainer.States, i)
+		}
+		if terminal {
+			trainer.TerminalState = numStates
+			trainer.States = append(trainer.States, numStates)
+		}
+		best, _ := trainer.Train(gen, data, nil)
+		model = best.HMM
+	}
+
+	fmt.Fprintf(stderr, "log-likelihood: %f\n", totalLogLikelihood(model, data))
+	return saveModel(outPath, model)
+}
+
+func obsChan(data [][]hmm.Obs) <-chan []hmm.Obs {
+	res := make(chan []hmm.Obs, len(data))
+	for _, seq := range data {
+		res <- seq
+	}
+	close(res)
+	return res
+}
+
+func totalLogLikelihood(h *hmm.HMM, data [][]hmm.Obs) float64 {
+	var res float64
+	for _, seq := range data {
+		res += hmm.LogLikelihood(h, seq)
+	}
+	return res
+}
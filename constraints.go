@@ -0,0 +1,54 @@
+package hmm
+
+import "math"
+
+// A StateConstraint restricts the hidden state at a single
+// timestep to a set of allowed states.
+//
+// A nil StateConstraint allows every state.
+// A StateConstraint with one entry fixes the state.
+type StateConstraint []State
+
+// A ConstrainedSeq is an observation sequence where the
+// hidden states at some timesteps are known or restricted.
+type ConstrainedSeq struct {
+	Obs []Obs
+
+	// Constraints stores one StateConstraint per timestep.
+	// If it is nil, then no timesteps are constrained.
+	Constraints []StateConstraint
+}
+
+// checkConstraints panics if the constraints do not match
+// the observation sequence.
+func checkConstraints(obs []Obs, constraints []StateConstraint) {
+	if constraints != nil && len(constraints) != len(obs) {
+		panic("constraint count must match observation count")
+	}
+}
+
+// constrainedEmissions computes the emission probabilities
+// for a timestep, setting the probabilities of disallowed
+// states to -infinity.
+func constrainedEmissions(c *hmmCache, h *HMM, obs []Obs, constraints []StateConstraint,
+	t int) []float64 {
+	res := emissionLogProbs(h.Emitter, obs[t], h.States...)
+	if constraints == nil || constraints[t] == nil {
+		return res
+	}
+	allowed := make([]bool, len(h.States))
+	for _, state := range constraints[t] {
+		if idx, ok := c.S2I[state]; ok {
+			allowed[idx] = true
+		}
+	}
+	masked := make([]float64, len(res))
+	for i, prob := range res {
+		if allowed[i] {
+			masked[i] = prob
+		} else {
+			masked[i] = math.Inf(-1)
+		}
+	}
+	return masked
+}
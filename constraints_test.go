@@ -0,0 +1,71 @@
+package hmm
+
+import (
+	"math"
+	"testing"
+)
+
+func TestForwardBackwardConstrained(t *testing.T) {
+	h := testingHMM()
+	obs := []Obs{"x", "z", "y", "x"}
+	constraints := []StateConstraint{nil, {"A"}, {"B", "C"}, nil}
+
+	unconstrained := NewForwardBackward(h, obs)
+	fb := NewForwardBackwardConstrained(h, obs, constraints)
+
+	// Compute P(Z_1 = A, Z_2 in {B, C} | X).
+	var probSatisfied float64
+	prior := unconstrained.Dist(1)
+	cond := unconstrained.CondDist(2)
+	for _, to := range []State{"B", "C"} {
+		if prob, ok := cond["A"][to]; ok {
+			probSatisfied += math.Exp(prob + prior["A"])
+		}
+	}
+	expected := unconstrained.LogLikelihood() + math.Log(probSatisfied)
+	if actual := fb.LogLikelihood(); math.Abs(actual-expected) > 1e-4 {
+		t.Errorf("expected log-likelihood %f but got %f", expected, actual)
+	}
+
+	if dist := fb.Dist(1); len(dist) != 1 || math.Abs(dist["A"]) > 1e-4 {
+		t.Errorf("unexpected distribution at constrained timestep: %v", dist)
+	}
+	for state := range fb.Dist(2) {
+		if state != "B" && state != "C" {
+			t.Errorf("disallowed state %v has non-zero probability", state)
+		}
+	}
+}
+
+func TestBaumWelchConstrained(t *testing.T) {
+	states := []State{0, 1, 2, 3}
+	obses := []Obs{"a", "b", "c"}
+	samples := []ConstrainedSeq{
+		{Obs: []Obs{"a", "b", "c"}, Constraints: []StateConstraint{{0}, nil, {2}}},
+		{Obs: []Obs{"b", "b"}},
+		{Obs: []Obs{"c", "a"}, Constraints: []StateConstraint{nil, {1, 2}}},
+	}
+	h := RandomHMM(nil, states, 3, obses)
+	logLikelihood := func() float64 {
+		var sum float64
+		for _, sample := range samples {
+			fb := NewForwardBackwardConstrained(h, sample.Obs, sample.Constraints)
+			sum += fb.LogLikelihood()
+		}
+		return sum
+	}
+	for i := 0; i < 3; i++ {
+		ch := make(chan ConstrainedSeq, len(samples))
+		for _, sample := range samples {
+			ch <- sample
+		}
+		close(ch)
+		oldLikelihood := logLikelihood()
+		h = BaumWelchConstrained(h, ch, 0)
+		newLikelihood := logLikelihood()
+		if newLikelihood < oldLikelihood {
+			t.Errorf("expected new likelihood (%f) to be greater than %f", newLikelihood,
+				oldLikelihood)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package hmm
+
+import (
+	"math"
+	"math/rand"
+)
+
+// EarlyStopping trains an HMM with BaumWelch until the
+// log-likelihood of a validation set stops improving.
+type EarlyStopping struct {
+	// MaxIterations is the maximum number of BaumWelch
+	// steps.
+	MaxIterations int
+
+	// Patience is the number of consecutive steps without
+	// a validation improvement after which training stops.
+	// If it is 0, then 1 is used.
+	Patience int
+
+	// Parallelism is passed to BaumWelch.
+	Parallelism int
+}
+
+// Train trains the model h on the training data.
+//
+// It returns the model with the best validation
+// log-likelihood, along with the validation log-likelihood
+// of the initial model and after every step.
+func (e *EarlyStopping) Train(h *HMM, train, validation [][]Obs) (*HMM, []float64) {
+	patience := e.Patience
+	if patience == 0 {
+		patience = 1
+	}
+	best := h
+	bestScore := totalLogLikelihood(h, validation)
+	history := []float64{bestScore}
+	var numWorse int
+	for i := 0; i < e.MaxIterations && numWorse < patience; i++ {
+		h = BaumWelch(h, obsChan(train), e.Parallelism)
+		score := totalLogLikelihood(h, validation)
+		history = append(history, score)
+		if score > bestScore {
+			best = h
+			bestScore = score
+			numWorse = 0
+		} else {
+			numWorse++
+		}
+	}
+	return best, history
+}
+
+// CrossValidation evaluates how well HMM training
+// generalizes using k-fold cross validation.
+type CrossValidation struct {
+	// NumFolds is the number of folds.
+	NumFolds int
+
+	// Init creates the initial model for each fold.
+	Init func(fold int) *HMM
+
+	// Iterations is the number of BaumWelch steps to run on
+	// each fold.
+	// It is ignored if EarlyStopping is set.
+	Iterations int
+
+	// EarlyStopping, if non-nil, is used to train each
+	// fold.
+	// In this case, the fold after the test fold is used
+	// as a validation set, and the remaining folds are
+	// used for training.
+	EarlyStopping *EarlyStopping
+
+	// Parallelism is passed to BaumWelch.
+	Parallelism int
+}
+
+// A FoldResult is the result of training and testing on
+// one fold.
+type FoldResult struct {
+	// HMM is the model trained without the fold.
+	HMM *HMM
+
+	// LogLikelihood is the total log-likelihood of the
+	// fold's sequences.
+	LogLikelihood float64
+
+	// NumSymbols is the total number of observations in
+	// the fold.
+	NumSymbols int
+}
+
+// PerSymbol returns the log-likelihood of the fold divided
+// by the number of observations.
+func (f *FoldResult) PerSymbol() float64 {
+	return f.LogLikelihood / float64(f.NumSymbols)
+}
+
+// A CrossValidationResult summarizes a cross validation
+// run.
+type CrossValidationResult struct {
+	Folds []*FoldResult
+
+	// MeanPerSymbol is the average of each fold's
+	// per-symbol log-likelihood.
+	// Folds without any observations are excluded.
+	MeanPerSymbol float64
+}
+
+// Run performs cross validation on the data.
+//
+// The data is shuffled before being split into folds.
+// If gen is nil, the global routines in package rand are
+// used for shuffling.
+func (c *CrossValidation) Run(gen *rand.Rand, data [][]Obs) *CrossValidationResult {
+	if c.NumFolds < 2 {
+		panic("cross validation requires at least two folds")
+	} else if c.EarlyStopping != nil && c.NumFolds < 3 {
+		panic("early stopping requires at least three folds")
+	}
+
+	var perm []int
+	if gen != nil {
+		perm = gen.Perm(len(data))
+	} else {
+		perm = rand.Perm(len(data))
+	}
+	folds := make([][][]Obs, c.NumFolds)
+	for i, idx := range perm {
+		folds[i%c.NumFolds] = append(folds[i%c.NumFolds], data[idx])
+	}
+
+	res := &CrossValidationResult{}
+	var numMeans int
+	for i, test := range folds {
+		validationIdx := -1
+		if c.EarlyStopping != nil {
+			validationIdx = (i + 1) % c.NumFolds
+		}
+		var train [][]Obs
+		for j, fold := range folds {
+			if j != i && j != validationIdx {
+				train = append(train, fold...)
+			}
+		}
+
+		h := c.Init(i)
+		if c.EarlyStopping != nil {
+			h, _ = c.EarlyStopping.Train(h, train, folds[validationIdx])
+		} else {
+			for j := 0; j < c.Iterations; j++ {
+				h = BaumWelch(h, obsChan(train), c.Parallelism)
+			}
+		}
+
+		foldRes := &FoldResult{
+			HMM:           h,
+			LogLikelihood: totalLogLikelihood(h, test),
+		}
+		for _, seq := range test {
+			foldRes.NumSymbols += len(seq)
+		}
+		res.Folds = append(res.Folds, foldRes)
+		if foldRes.NumSymbols > 0 {
+			res.MeanPerSymbol += foldRes.PerSymbol()
+			numMeans++
+		}
+	}
+	if numMeans > 0 {
+		res.MeanPerSymbol /= float64(numMeans)
+	} else {
+		res.MeanPerSymbol = math.NaN()
+	}
+	return res
+}
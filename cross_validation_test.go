@@ -0,0 +1,110 @@
+package hmm
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestEarlyStopping(t *testing.T) {
+	gen := rand.New(rand.NewSource(1337))
+	target := testingHMM()
+	var train, validation [][]Obs
+	for i := 0; i < 30; i++ {
+		_, obs := target.Sample(gen)
+		if i%3 == 0 {
+			validation = append(validation, obs)
+		} else {
+			train = append(train, obs)
+		}
+	}
+	initial := RandomHMM(gen, target.States, target.TerminalState, []Obs{"x", "y", "z"})
+	e := &EarlyStopping{MaxIterations: 20, Patience: 2}
+	best, history := e.Train(initial, train, validation)
+
+	if len(history) < 2 || len(history) > e.MaxIterations+1 {
+		t.Fatalf("unexpected history length: %d", len(history))
+	}
+	bestScore := math.Inf(-1)
+	for _, score := range history {
+		bestScore = math.Max(bestScore, score)
+	}
+	if actual := totalLogLikelihood(best, validation); math.Abs(actual-bestScore) > 1e-4 {
+		t.Errorf("expected best validation score %f but got %f", bestScore, actual)
+	}
+}
+
+func TestCrossValidation(t *testing.T) {
+	gen := rand.New(rand.NewSource(1337))
+	target := testingHMM()
+	var data [][]Obs
+	for i := 0; i < 40; i++ {
+		_, obs := target.Sample(gen)
+		data = append(data, obs)
+	}
+	var numSymbols int
+	for _, seq := range data {
+		numSymbols += len(seq)
+	}
+
+	for _, early := range []*EarlyStopping{nil, {MaxIterations: 5}} {
+		cv := &CrossValidation{
+			NumFolds: 4,
+			Init: func(fold int) *HMM {
+				return RandomHMM(rand.New(rand.NewSource(int64(fold))), target.States,
+					target.TerminalState, []Obs{"x", "y", "z"})
+			},
+			Iterations:    3,
+			EarlyStopping: early,
+		}
+		res := cv.Run(gen, data)
+		if len(res.Folds) != cv.NumFolds {
+			t.Fatalf("expected %d folds but got %d", cv.NumFolds, len(res.Folds))
+		}
+		var totalSymbols int
+		var mean float64
+		for _, fold := range res.Folds {
+			totalSymbols += fold.NumSymbols
+			mean += fold.PerSymbol() / float64(len(res.Folds))
+			if math.IsInf(fold.LogLikelihood, 0) || math.IsNaN(fold.LogLikelihood) {
+				t.Errorf("invalid fold log-likelihood: %f", fold.LogLikelihood)
+			}
+		}
+		if totalSymbols != numSymbols {
+			t.Errorf("expected %d symbols but got %d", numSymbols, totalSymbols)
+		}
+		if math.Abs(mean-res.MeanPerSymbol) > 1e-8 {
+			t.Errorf("expected mean %f but got %f", mean, res.MeanPerSymbol)
+		}
+	}
+}
+
+func TestCrossValidationReproducible(t *testing.T) {
+	run := func() *CrossValidationResult {
+		gen := rand.New(rand.NewSource(42))
+		target := testingHMM()
+		var data [][]Obs
+		for i := 0; i < 30; i++ {
+			_, obs := target.Sample(gen)
+			data = append(data, obs)
+		}
+		cv := &CrossValidation{
+			NumFolds: 3,
+			Init: func(fold int) *HMM {
+				return RandomHMM(rand.New(rand.NewSource(int64(fold))), target.States,
+					target.TerminalState, []Obs{"x", "y", "z"})
+			},
+			Iterations: 2,
+		}
+		return cv.Run(gen, data)
+	}
+	res1, res2 := run(), run()
+	for i, fold := range res1.Folds {
+		other := res2.Folds[i]
+		if fold.NumSymbols != other.NumSymbols ||
+			math.Abs(fold.LogLikelihood-other.LogLikelihood) > 1e-8 {
+			t.Errorf("fold %d differs between runs: %v vs %v", i, fold.LogLikelihood,
+				other.LogLikelihood)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package dataset
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/hmm"
+)
+
+// CoNLL reads sentences from a CoNLL-style file, where
+// each line holds the whitespace-separated columns for one
+// token, and sentences are separated by blank lines.
+//
+// It is both a Source, producing the observation column,
+// and a LabeledSource, which also produces the state column
+// (for example, part-of-speech tags).
+// Both columns are represented as strings.
+//
+// Comment lines (starting with '#' before the first token
+// of a sentence) and "-DOCSTART-" lines are ignored.
+type CoNLL struct {
+	Open Opener
+
+	// ObsColumn and StateColumn are the column indices of
+	// the observations and states.
+	// Negative indices count from the last column, so -1
+	// is the last column.
+	ObsColumn   int
+	StateColumn int
+}
+
+// NewCoNLL creates a CoNLL source which uses the first
+// column as observations and the last column as states.
+func NewCoNLL(open Opener) *CoNLL {
+	return &CoNLL{Open: open, ObsColumn: 0, StateColumn: -1}
+}
+
+// Stream streams the observations of each sentence.
+func (c *CoNLL) Stream() (<-chan []hmm.Obs, <-chan error) {
+	labeled, errs := c.StreamLabeled()
+	seqs := make(chan []hmm.Obs, cap(labeled))
+	go func() {
+		defer close(seqs)
+		for seq := range labeled {
+			seqs <- seq.Obs
+		}
+	}()
+	return seqs, errs
+}
+
+// StreamLabeled streams the observations and states of
+// each sentence.
+func (c *CoNLL) StreamLabeled() (<-chan hmm.LabeledSeq, <-chan error) {
+	seqs := make(chan hmm.LabeledSeq, 16)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		errs <- func() (err error) {
+			defer close(seqs)
+			defer essentials.AddCtxTo("read CoNLL", &err)
+			r, err := c.Open()
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+
+			scanner := bufio.NewScanner(r)
+			scanner.Buffer(nil, maxLineSize)
+			var seq hmm.LabeledSeq
+			flush := func() {
+				if len(seq.Obs) > 0 {
+					seqs <- seq
+					seq = hmm.LabeledSeq{}
+				}
+			}
+			for lineNum := 1; scanner.Scan(); lineNum++ {
+				fields := strings.Fields(scanner.Text())
+				if len(fields) == 0 {
+					flush()
+					continue
+				} else if fields[0] == "-DOCSTART-" ||
+					(len(seq.Obs) == 0 && strings.HasPrefix(fields[0], "#")) {
+					continue
+				}
+				obs, ok1 := column(fields, c.ObsColumn)
+				state, ok2 := column(fields, c.StateColumn)
+				if !ok1 || !ok2 {
+					return fmt.Errorf("line %d: expected more than %d columns", lineNum,
+						len(fields))
+				}
+				seq.Obs = append(seq.Obs, obs)
+				seq.States = append(seq.States, state)
+			}
+			if err := scanner.Err(); err != nil {
+				return err
+			}
+			flush()
+			return nil
+		}()
+	}()
+	return seqs, errs
+}
+
+func column(fields []string, idx int) (string, bool) {
+	if idx < 0 {
+		idx += len(fields)
+	}
+	if idx < 0 || idx >= len(fields) {
+		return "", false
+	}
+	return fields[idx], true
+}
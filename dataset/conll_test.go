@@ -0,0 +1,61 @@
+package dataset
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/unixpickle/hmm"
+)
+
+const conllTestingData = `-DOCSTART- -X- O
+
+# sent_id = 1
+The DT B-NP
+cat NN I-NP
+# SYM O
+
+Hi UH O
+`
+
+func TestCoNLL(t *testing.T) {
+	src := NewCoNLL(Bytes([]byte(conllTestingData)))
+	labeled, err := ReadAllLabeled(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []hmm.LabeledSeq{
+		{
+			States: []hmm.State{"B-NP", "I-NP", "O"},
+			Obs:    []hmm.Obs{"The", "cat", "#"},
+		},
+		{
+			States: []hmm.State{"O"},
+			Obs:    []hmm.Obs{"Hi"},
+		},
+	}
+	if !reflect.DeepEqual(labeled, expected) {
+		t.Errorf("expected %v but got %v", expected, labeled)
+	}
+
+	obs, err := ReadAll(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(obs, [][]hmm.Obs{expected[0].Obs, expected[1].Obs}) {
+		t.Errorf("unexpected observations: %v", obs)
+	}
+
+	src.StateColumn = 1
+	labeled, err = ReadAllLabeled(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if labeled[0].States[0] != "DT" {
+		t.Errorf("unexpected states: %v", labeled[0].States)
+	}
+
+	src.StateColumn = 3
+	if _, err := ReadAllLabeled(src); err == nil {
+		t.Error("expected error for missing column")
+	}
+}
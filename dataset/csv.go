@@ -0,0 +1,125 @@
+package dataset
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/hmm"
+)
+
+// CSV is a Source which reads numeric time series from a
+// CSV file, where each row is one timestep.
+//
+// Each observation is a []float64 with one entry per value
+// column, suitable for hmm.GaussianEmitter.
+// If any value in a row is empty, the observation is nil,
+// meaning that it is missing.
+type CSV struct {
+	Open Opener
+
+	// Header, if true, indicates that the first row is a
+	// header and should be skipped.
+	Header bool
+
+	// SeqColumn is the index of a column which identifies
+	// the sequence for each row.
+	// Consecutive rows with the same identifier form one
+	// sequence.
+	// If SeqColumn is negative, the entire file is one
+	// sequence.
+	SeqColumn int
+
+	// Columns lists the indices of the value columns.
+	// If nil, every column except SeqColumn is used.
+	Columns []int
+}
+
+// NewCSV creates a CSV source which reads the entire file
+// as a single sequence, using every column as a value.
+func NewCSV(open Opener) *CSV {
+	return &CSV{Open: open, SeqColumn: -1}
+}
+
+// Stream streams the time series.
+func (c *CSV) Stream() (<-chan []hmm.Obs, <-chan error) {
+	return stream(c.Open, func(r io.Reader, emit func([]hmm.Obs)) (err error) {
+		defer essentials.AddCtxTo("read CSV", &err)
+		reader := csv.NewReader(r)
+		reader.TrimLeadingSpace = true
+		if c.Header {
+			if _, err := reader.Read(); err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+		}
+
+		var seq []hmm.Obs
+		var seqID string
+		for {
+			row, err := reader.Read()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			}
+			line, _ := reader.FieldPos(0)
+			if c.SeqColumn >= 0 {
+				if c.SeqColumn >= len(row) {
+					return fmt.Errorf("line %d: missing sequence column", line)
+				}
+				if seq != nil && row[c.SeqColumn] != seqID {
+					emit(seq)
+					seq = nil
+				}
+				seqID = row[c.SeqColumn]
+			}
+			obs, err := c.parseRow(row)
+			if err != nil {
+				return essentials.AddCtx(fmt.Sprintf("line %d", line), err)
+			}
+			seq = append(seq, obs)
+		}
+		if seq != nil {
+			emit(seq)
+		}
+		return nil
+	})
+}
+
+func (c *CSV) parseRow(row []string) (hmm.Obs, error) {
+	columns := c.Columns
+	if columns == nil {
+		for i := range row {
+			if i != c.SeqColumn {
+				columns = append(columns, i)
+			}
+		}
+	}
+	res := make([]float64, len(columns))
+	missing := false
+	for i, col := range columns {
+		if col < 0 || col >= len(row) {
+			return nil, fmt.Errorf("missing column %d", col)
+		}
+		field := strings.TrimSpace(row[col])
+		if field == "" {
+			missing = true
+			continue
+		}
+		x, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil, fmt.Errorf("column %d: invalid number: %s", col, field)
+		}
+		res[i] = x
+	}
+	if missing {
+		return nil, nil
+	}
+	return res, nil
+}
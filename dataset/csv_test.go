@@ -0,0 +1,46 @@
+package dataset
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/unixpickle/hmm"
+)
+
+func TestCSV(t *testing.T) {
+	data := []byte("id,x,y\na,1,2\na,3,\nb,-1.5,1e2\n")
+
+	src := &CSV{Open: Bytes(data), Header: true, SeqColumn: 0}
+	actual, err := ReadAll(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]hmm.Obs{
+		{[]float64{1, 2}, nil},
+		{[]float64{-1.5, 100}},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v but got %v", expected, actual)
+	}
+
+	src = &CSV{Open: Bytes(data), Header: true, SeqColumn: -1, Columns: []int{1}}
+	actual, err = ReadAll(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = [][]hmm.Obs{{[]float64{1}, []float64{3}, []float64{-1.5}}}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v but got %v", expected, actual)
+	}
+
+	invalid := []*CSV{
+		NewCSV(Bytes(data)),
+		{Open: Bytes(data), Header: true, SeqColumn: 0, Columns: []int{3}},
+		{Open: Bytes([]byte("1,2\n3\n")), SeqColumn: -1},
+	}
+	for i, src := range invalid {
+		if _, err := ReadAll(src); err == nil {
+			t.Errorf("case %d: expected an error", i)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Package dataset reads observation sequences from common
+// file formats.
+//
+// Each reader is a Source, which can stream its sequences
+// any number of times, for example once per iteration of
+// hmm.BaumWelch:
+//
+//	src := dataset.NewText(dataset.File("corpus.txt"))
+//	for i := 0; i < 10; i++ {
+//		seqs, errs := src.Stream()
+//		model = hmm.BaumWelch(model, seqs, 0)
+//		if err := <-errs; err != nil {
+//			// Handle the error.
+//		}
+//	}
+package dataset
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/unixpickle/hmm"
+)
+
+// A Source is a collection of observation sequences which
+// can be streamed repeatedly.
+type Source interface {
+	// Stream starts a pass over the sequences.
+	//
+	// The sequence channel is closed at the end of the pass
+	// or after an error.
+	// Afterwards, exactly one value, which is nil on success,
+	// is sent on the error channel.
+	//
+	// The caller must drain the sequence channel.
+	Stream() (<-chan []hmm.Obs, <-chan error)
+}
+
+// A LabeledSource is like a Source, but it produces the
+// hidden states along with the observations, for example
+// to train an hmm.SupervisedMLE.
+type LabeledSource interface {
+	StreamLabeled() (<-chan hmm.LabeledSeq, <-chan error)
+}
+
+// An Opener opens a new reader for the underlying data,
+// allowing the data to be read more than once.
+type Opener func() (io.ReadCloser, error)
+
+// File creates an Opener for a file path.
+func File(path string) Opener {
+	return func() (io.ReadCloser, error) {
+		return os.Open(path)
+	}
+}
+
+// Bytes creates an Opener for in-memory data.
+func Bytes(data []byte) Opener {
+	return func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+}
+
+// Slice is an in-memory Source.
+type Slice [][]hmm.Obs
+
+// Stream streams the sequences in order.
+func (s Slice) Stream() (<-chan []hmm.Obs, <-chan error) {
+	seqs := make(chan []hmm.Obs, len(s))
+	for _, seq := range s {
+		seqs <- seq
+	}
+	close(seqs)
+	errs := make(chan error, 1)
+	errs <- nil
+	return seqs, errs
+}
+
+// ReadAll reads every sequence from a Source.
+func ReadAll(s Source) ([][]hmm.Obs, error) {
+	var res [][]hmm.Obs
+	seqs, errs := s.Stream()
+	for seq := range seqs {
+		res = append(res, seq)
+	}
+	if err := <-errs; err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ReadAllLabeled reads every sequence from a
+// LabeledSource.
+func ReadAllLabeled(s LabeledSource) ([]hmm.LabeledSeq, error) {
+	var res []hmm.LabeledSeq
+	seqs, errs := s.StreamLabeled()
+	for seq := range seqs {
+		res = append(res, seq)
+	}
+	if err := <-errs; err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// stream runs a parser in the background on a reader from
+// the Opener.
+func stream(open Opener, parse func(r io.Reader, emit func([]hmm.Obs)) error) (
+	<-chan []hmm.Obs, <-chan error) {
+	seqs := make(chan []hmm.Obs, 16)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		errs <- func() error {
+			defer close(seqs)
+			r, err := open()
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+			return parse(r, func(seq []hmm.Obs) {
+				seqs <- seq
+			})
+		}()
+	}()
+	return seqs, errs
+}
@@ -0,0 +1,66 @@
+package dataset
+
+import (
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/unixpickle/hmm"
+)
+
+func TestSourceReiterable(t *testing.T) {
+	src := NewText(Bytes([]byte("x y\ny y x\n")))
+	h := &hmm.HMM{
+		States: []hmm.State{"A", "B"},
+		Emitter: hmm.TabularEmitter{
+			"A": map[hmm.Obs]float64{"x": math.Log(0.6), "y": math.Log(0.4)},
+			"B": map[hmm.Obs]float64{"x": math.Log(0.3), "y": math.Log(0.7)},
+		},
+		Init: map[hmm.State]float64{"A": math.Log(0.5), "B": math.Log(0.5)},
+		Transitions: map[hmm.Transition]float64{
+			hmm.Transition{From: "A", To: "A"}: math.Log(0.9),
+			hmm.Transition{From: "A", To: "B"}: math.Log(0.1),
+			hmm.Transition{From: "B", To: "A"}: math.Log(0.2),
+			hmm.Transition{From: "B", To: "B"}: math.Log(0.8),
+		},
+	}
+	expected := h
+	for i := 0; i < 3; i++ {
+		seqs, errs := src.Stream()
+		h = hmm.BaumWelch(h, seqs, 0)
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+		expectedSeqs, _ := Slice{{"x", "y"}, {"y", "y", "x"}}.Stream()
+		expected = hmm.BaumWelch(expected, expectedSeqs, 0)
+	}
+	for trans, prob := range expected.Transitions {
+		if math.Abs(h.Transitions[trans]-prob) > 1e-8 {
+			t.Errorf("transition %v: expected %f but got %f", trans, prob, h.Transitions[trans])
+		}
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	openErr := errors.New("open failed")
+	src := NewText(func() (io.ReadCloser, error) {
+		return nil, openErr
+	})
+	seqs, err := ReadAll(src)
+	if err == nil || seqs != nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestReadAll(t *testing.T) {
+	data := Slice{{"a"}, {}, {"b", "c"}}
+	actual, err := ReadAll(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual([][]hmm.Obs(data), actual) {
+		t.Errorf("expected %v but got %v", data, actual)
+	}
+}
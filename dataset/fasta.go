@@ -0,0 +1,71 @@
+package dataset
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/hmm"
+)
+
+// FASTA is a Source which reads the records of a FASTA
+// file, such as a collection of DNA or protein sequences.
+//
+// Each residue is an observation, represented as a
+// single-character string.
+// Header lines (starting with '>') begin a new record, and
+// comment lines (starting with ';') are ignored.
+type FASTA struct {
+	Open Opener
+
+	// UpperCase, if true, converts residues to upper case,
+	// removing soft-masking.
+	UpperCase bool
+}
+
+// NewFASTA creates a FASTA source with default settings.
+func NewFASTA(open Opener) *FASTA {
+	return &FASTA{Open: open}
+}
+
+// Stream streams the records.
+func (f *FASTA) Stream() (<-chan []hmm.Obs, <-chan error) {
+	return stream(f.Open, func(r io.Reader, emit func([]hmm.Obs)) (err error) {
+		defer essentials.AddCtxTo("read FASTA", &err)
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(nil, maxLineSize)
+		var seq []hmm.Obs
+		for lineNum := 1; scanner.Scan(); lineNum++ {
+			line := strings.TrimSpace(scanner.Text())
+			if strings.HasPrefix(line, ">") {
+				if seq != nil {
+					emit(seq)
+				}
+				seq = []hmm.Obs{}
+				continue
+			} else if line == "" || strings.HasPrefix(line, ";") {
+				continue
+			} else if seq == nil {
+				return fmt.Errorf("line %d: sequence before header", lineNum)
+			}
+			if f.UpperCase {
+				line = strings.ToUpper(line)
+			}
+			for _, ch := range line {
+				if !unicode.IsSpace(ch) {
+					seq = append(seq, string(ch))
+				}
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		if seq != nil {
+			emit(seq)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,32 @@
+package dataset
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/unixpickle/hmm"
+)
+
+func TestFASTA(t *testing.T) {
+	data := []byte(">seq1 first sequence\nACgt\nNA\n; comment\n\n>seq2\n>seq3\nTT\n")
+	actual, err := ReadAll(NewFASTA(Bytes(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]hmm.Obs{{"A", "C", "g", "t", "N", "A"}, {}, {"T", "T"}}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v but got %v", expected, actual)
+	}
+
+	actual, err = ReadAll(&FASTA{Open: Bytes(data), UpperCase: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual[0][2] != "G" || actual[0][3] != "T" {
+		t.Errorf("expected upper case but got %v", actual[0])
+	}
+
+	if _, err := ReadAll(NewFASTA(Bytes([]byte("ACGT\n>seq\nA\n")))); err == nil {
+		t.Error("expected error for missing header")
+	}
+}
@@ -0,0 +1,64 @@
+package dataset
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/hmm"
+)
+
+// maxLineSize is the longest line that readers accept.
+const maxLineSize = 1 << 24
+
+// Text is a Source which reads one sequence per line.
+//
+// By default, each whitespace-separated token is an
+// observation, represented as a string.
+// Empty lines produce empty sequences.
+type Text struct {
+	Open Opener
+
+	// Chars, if true, makes each character an observation,
+	// rather than each token.
+	Chars bool
+
+	// SkipEmpty, if true, skips lines with no observations.
+	SkipEmpty bool
+}
+
+// NewText creates a Text source with default settings.
+func NewText(open Opener) *Text {
+	return &Text{Open: open}
+}
+
+// Stream streams the lines of text.
+func (t *Text) Stream() (<-chan []hmm.Obs, <-chan error) {
+	return stream(t.Open, func(r io.Reader, emit func([]hmm.Obs)) (err error) {
+		defer essentials.AddCtxTo("read text", &err)
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(nil, maxLineSize)
+		for scanner.Scan() {
+			seq := t.split(strings.TrimSuffix(scanner.Text(), "\r"))
+			if len(seq) > 0 || !t.SkipEmpty {
+				emit(seq)
+			}
+		}
+		return scanner.Err()
+	})
+}
+
+func (t *Text) split(line string) []hmm.Obs {
+	res := []hmm.Obs{}
+	if t.Chars {
+		for _, ch := range line {
+			res = append(res, string(ch))
+		}
+	} else {
+		for _, field := range strings.Fields(line) {
+			res = append(res, field)
+		}
+	}
+	return res
+}
@@ -0,0 +1,39 @@
+package dataset
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/unixpickle/hmm"
+)
+
+func TestText(t *testing.T) {
+	data := []byte("the cat  sat\r\n\nhi\n")
+	cases := []struct {
+		Source   *Text
+		Expected [][]hmm.Obs
+	}{
+		{
+			Source:   NewText(Bytes(data)),
+			Expected: [][]hmm.Obs{{"the", "cat", "sat"}, {}, {"hi"}},
+		},
+		{
+			Source:   &Text{Open: Bytes(data), SkipEmpty: true},
+			Expected: [][]hmm.Obs{{"the", "cat", "sat"}, {"hi"}},
+		},
+		{
+			Source: &Text{Open: Bytes(data), Chars: true},
+			Expected: [][]hmm.Obs{{"t", "h", "e", " ", "c", "a", "t", " ", " ", "s", "a", "t"},
+				{}, {"h", "i"}},
+		},
+	}
+	for i, c := range cases {
+		actual, err := ReadAll(c.Source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(actual, c.Expected) {
+			t.Errorf("case %d: expected %v but got %v", i, c.Expected, actual)
+		}
+	}
+}
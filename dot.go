@@ -0,0 +1,151 @@
+package hmm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/unixpickle/essentials"
+)
+
+// DotExporter writes the topology of an HMM as a GraphViz
+// DOT graph.
+//
+// States are drawn as nodes, labeled with fmt.Sprint.
+// The terminal state is drawn with a double border, silent
+// states are dashed, and initial states are bold.
+// An unlabeled start node points to every initial state,
+// and its edges are labeled with the initial
+// probabilities.
+type DotExporter struct {
+	// MinProb is the minimum probability of a transition
+	// or initial state for its edge to be drawn.
+	// Edges with probability 0 are never drawn.
+	MinProb float64
+
+	// TopEmissions is the number of most likely emissions
+	// to list in the label of each state.
+	// It only applies to TabularEmitters.
+	// If it is 0, no emissions are listed.
+	TopEmissions int
+}
+
+// Export writes the DOT graph for h to w.
+//
+// The output is deterministic, with nodes written in the
+// order of h.States.
+func (d *DotExporter) Export(w io.Writer, h *HMM) (err error) {
+	defer essentials.AddCtxTo("export DOT", &err)
+
+	s2i := statesToIndices(h)
+	silent := map[State]bool{}
+	for _, state := range h.SilentStates {
+		silent[state] = true
+	}
+	tabular, _ := h.Emitter.(TabularEmitter)
+
+	buf := bufio.NewWriter(w)
+	fmt.Fprintln(buf, "digraph HMM {")
+	fmt.Fprintln(buf, "\trankdir=LR;")
+	fmt.Fprintln(buf, "\tstart [shape=point];")
+	for i, state := range h.States {
+		var attrs []string
+		label := fmt.Sprint(state)
+		if d.TopEmissions > 0 && tabular != nil && !silent[state] &&
+			state != h.TerminalState {
+			for _, line := range d.topEmissions(tabular[state]) {
+				label += "\n" + line
+			}
+		}
+		attrs = append(attrs, "label="+dotQuote(label))
+		if state == h.TerminalState {
+			attrs = append(attrs, "shape=doublecircle")
+		}
+		var styles []string
+		if prob, ok := h.Init[state]; ok && d.shouldDraw(prob) {
+			styles = append(styles, "bold")
+		}
+		if silent[state] {
+			styles = append(styles, "dashed")
+		}
+		if len(styles) > 0 {
+			attrs = append(attrs, "style="+dotQuote(strings.Join(styles, ",")))
+		}
+		fmt.Fprintf(buf, "\ts%d [%s];\n", i, strings.Join(attrs, ", "))
+	}
+
+	for i, state := range h.States {
+		if prob, ok := h.Init[state]; ok && d.shouldDraw(prob) {
+			fmt.Fprintf(buf, "\tstart -> s%d [label=%s];\n", i, dotQuote(dotProb(prob)))
+		}
+	}
+
+	var transitions []fastTransition
+	for trans, prob := range h.Transitions {
+		if !d.shouldDraw(prob) {
+			continue
+		}
+		from, ok1 := s2i[trans.From]
+		to, ok2 := s2i[trans.To]
+		if !ok1 || !ok2 {
+			return fmt.Errorf("unknown state in transition: %v", trans)
+		}
+		transitions = append(transitions, fastTransition{From: from, To: to, Prob: prob})
+	}
+	sort.Slice(transitions, func(i, j int) bool {
+		t1, t2 := transitions[i], transitions[j]
+		return t1.From < t2.From || (t1.From == t2.From && t1.To < t2.To)
+	})
+	for _, t := range transitions {
+		fmt.Fprintf(buf, "\ts%d -> s%d [label=%s];\n", t.From, t.To,
+			dotQuote(dotProb(t.Prob)))
+	}
+
+	fmt.Fprintln(buf, "}")
+	return buf.Flush()
+}
+
+// shouldDraw checks if an edge with the given log
+// probability should be drawn.
+func (d *DotExporter) shouldDraw(logProb float64) bool {
+	return !math.IsInf(logProb, -1) && math.Exp(logProb) >= d.MinProb
+}
+
+// topEmissions formats the most likely emissions of a
+// state, breaking ties by observation label.
+func (d *DotExporter) topEmissions(dist map[Obs]float64) []string {
+	type emission struct {
+		Label   string
+		LogProb float64
+	}
+	var emissions []emission
+	for obs, prob := range dist {
+		if !math.IsInf(prob, -1) {
+			emissions = append(emissions, emission{Label: fmt.Sprint(obs), LogProb: prob})
+		}
+	}
+	sort.Slice(emissions, func(i, j int) bool {
+		e1, e2 := emissions[i], emissions[j]
+		return e1.LogProb > e2.LogProb || (e1.LogProb == e2.LogProb && e1.Label < e2.Label)
+	})
+	var res []string
+	for i := 0; i < len(emissions) && i < d.TopEmissions; i++ {
+		res = append(res, emissions[i].Label+": "+dotProb(emissions[i].LogProb))
+	}
+	return res
+}
+
+func dotProb(logProb float64) string {
+	return fmt.Sprintf("%.3f", math.Exp(logProb))
+}
+
+// dotQuote creates a DOT string literal.
+func dotQuote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	return `"` + s + `"`
+}
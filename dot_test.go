@@ -0,0 +1,59 @@
+package hmm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDotExporter(t *testing.T) {
+	h := silentTestingHMM()
+	h.States = append(h.States, `quote"d`)
+	h.Emitter.(TabularEmitter)[`quote"d`] = map[Obs]float64{"x": 0}
+
+	e := &DotExporter{MinProb: 0.25, TopEmissions: 1}
+	var buf bytes.Buffer
+	if err := e.Export(&buf, h); err != nil {
+		t.Fatal(err)
+	}
+	actual := buf.String()
+	expected := `digraph HMM {
+	rankdir=LR;
+	start [shape=point];
+	s0 [label="A\nx: 0.800", style="bold"];
+	s1 [label="B\ny: 0.900"];
+	s2 [label="S", style="bold,dashed"];
+	s3 [label="T", shape=doublecircle];
+	s4 [label="quote\"d\nx: 1.000"];
+	start -> s0 [label="0.600"];
+	start -> s2 [label="0.400"];
+	s0 -> s2 [label="0.500"];
+	s0 -> s3 [label="0.300"];
+	s1 -> s0 [label="0.400"];
+	s1 -> s1 [label="0.300"];
+	s1 -> s3 [label="0.300"];
+	s2 -> s1 [label="0.700"];
+	s2 -> s3 [label="0.300"];
+}
+`
+	if actual != expected {
+		t.Errorf("unexpected output:\n%s", actual)
+	}
+
+	var buf2 bytes.Buffer
+	e.Export(&buf2, h)
+	if buf2.String() != actual {
+		t.Error("output is not deterministic")
+	}
+
+	buf.Reset()
+	if err := (&DotExporter{}).Export(&buf, h); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "x: ") {
+		t.Error("unexpected emissions in output")
+	}
+	if strings.Count(buf.String(), "->") != len(h.Transitions)+len(h.Init) {
+		t.Errorf("unexpected number of edges:\n%s", buf.String())
+	}
+}
@@ -2,9 +2,9 @@ package hmm
 
 import (
 	"errors"
-	"fmt"
 	"math"
 	"math/rand"
+	"sort"
 
 	"github.com/unixpickle/essentials"
 	"github.com/unixpickle/serializer"
@@ -16,6 +16,11 @@ func init() {
 }
 
 // An Obs is an observation for a single timestep.
+//
+// A nil Obs indicates a missing observation.
+// Missing observations are marginalized out by inference
+// and training algorithms, so they are never passed to an
+// Emitter.
 type Obs interface{}
 
 // An Emitter performs operations on the conditional
@@ -56,27 +61,48 @@ func DeserializeTabularEmitter(d []byte) (t TabularEmitter, err error) {
 		return nil, errors.New("State or Obs not comparable")
 	}
 	t = TabularEmitter{}
-	for i, state := range states {
+	for i, stateSer := range states {
+		state := fromSerializer(stateSer)
 		if _, ok := t[state]; !ok {
 			t[state] = map[Obs]float64{}
 		}
-		t[state][obses[i]] = probs[i]
+		t[state][fromSerializer(obses[i])] = probs[i]
 	}
 	return t, nil
 }
 
 // Sample samples an observation from the state.
+//
+// The observations are sorted on every call, so that the
+// result only depends on gen.
+// HMM.Sample sorts each row only once per sequence.
 func (t TabularEmitter) Sample(gen *rand.Rand, state State) Obs {
-	if len(t[state]) == 0 {
-		panic("no entries for the given state")
+	return newEmitSampler(t).Sample(gen, state)
+}
+
+// sortedObs returns the observations of a row sorted with
+// valueLess.
+func sortedObs(row map[Obs]float64) []Obs {
+	res := make([]Obs, 0, len(row))
+	strs := make([]string, 0, len(row))
+	for obs := range row {
+		res = append(res, obs)
+		if str, ok := obs.(string); ok {
+			strs = append(strs, str)
+		}
 	}
-	var obses []Obs
-	var probs []float64
-	for obs, prob := range t[state] {
-		obses = append(obses, obs)
-		probs = append(probs, math.Exp(prob))
+	if len(strs) == len(res) {
+		// Fast path for string observations.
+		sort.Strings(strs)
+		for i, str := range strs {
+			res[i] = str
+		}
+	} else {
+		sort.Slice(res, func(i, j int) bool {
+			return valueLess(res[i], res[j])
+		})
 	}
-	return obses[sampleIndex(gen, probs)]
+	return res
 }
 
 // LogProbs computes the conditional probabilities.
@@ -101,26 +127,56 @@ func (t TabularEmitter) SerializerType() string {
 // Serialize serializes the TabularEmitter.
 //
 // For this to work, the states and observations must
-// implement serializer.Serializer.
+// either implement serializer.Serializer or be plain
+// comparable values (see HMM.Serialize).
+//
+// Entries are written in a canonical order, so the same
+// TabularEmitter always produces the same bytes.
 func (t TabularEmitter) Serialize() (data []byte, err error) {
 	defer essentials.AddCtxTo("serialize TabularEmitter", &err)
+	var rawStates []interface{}
+	for state := range t {
+		rawStates = append(rawStates, state)
+	}
+	sortedStates, stateSers, err := sortedSerializers(rawStates)
+	if err != nil {
+		return nil, err
+	}
 	var states []serializer.Serializer
 	var obses []serializer.Serializer
 	var probs []float64
-	for state, dist := range t {
-		stateSer, ok := state.(serializer.Serializer)
-		if !ok {
-			return nil, fmt.Errorf("not a Serializer: %T", state)
+	for i, state := range sortedStates {
+		dist := t[state]
+		var rawObses []interface{}
+		for obs := range dist {
+			rawObses = append(rawObses, obs)
 		}
-		for obs, prob := range dist {
-			obsSer, ok := obs.(serializer.Serializer)
-			if !ok {
-				return nil, fmt.Errorf("not a Serializer: %T", obs)
-			}
-			states = append(states, stateSer)
-			obses = append(obses, obsSer)
-			probs = append(probs, prob)
+		sortedObses, obsSers, err := sortedSerializers(rawObses)
+		if err != nil {
+			return nil, err
+		}
+		for j, obs := range sortedObses {
+			states = append(states, stateSers[i])
+			obses = append(obses, obsSers[j])
+			probs = append(probs, dist[obs])
 		}
 	}
 	return serializer.SerializeAny(states, obses, probs)
 }
+
+// MarshalBinary encodes the TabularEmitter using
+// Serialize, so that it can be used with encoding/gob.
+func (t TabularEmitter) MarshalBinary() ([]byte, error) {
+	return t.Serialize()
+}
+
+// UnmarshalBinary decodes a TabularEmitter encoded with
+// MarshalBinary.
+func (t *TabularEmitter) UnmarshalBinary(data []byte) error {
+	res, err := DeserializeTabularEmitter(data)
+	if err != nil {
+		return err
+	}
+	*t = res
+	return nil
+}
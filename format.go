@@ -0,0 +1,134 @@
+package hmm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/unixpickle/serializer"
+)
+
+// hmmFormatMagic prefixes every versioned HMM encoding.
+//
+// Legacy encodings, which had no header, start with a
+// length prefix, so they never begin with these bytes in
+// practice.
+const hmmFormatMagic = "\xffHMM"
+
+// hmmFormatVersion is the version of the HMM encoding
+// produced by Serialize.
+//
+// Version 0 is the legacy format, which stored states in
+// map order rather than by index and had no silent states.
+const hmmFormatVersion = 1
+
+func writeFormatHeader(version uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, version)
+	return append([]byte(hmmFormatMagic), buf[:n]...)
+}
+
+// readFormatHeader parses the version header of an
+// encoded HMM, returning the version and the remaining
+// data.
+//
+// Data without a header is treated as version 0.
+func readFormatHeader(d []byte) (version uint64, body []byte, err error) {
+	if !strings.HasPrefix(string(d), hmmFormatMagic) {
+		return 0, d, nil
+	}
+	version, n := binary.Uvarint(d[len(hmmFormatMagic):])
+	if n <= 0 {
+		return 0, nil, errors.New("invalid format header")
+	}
+	if version == 0 || version > hmmFormatVersion {
+		return 0, nil, fmt.Errorf("unsupported format version %d (newest supported is %d)",
+			version, hmmFormatVersion)
+	}
+	return version, d[len(hmmFormatMagic)+n:], nil
+}
+
+// deserializeHMMV0 decodes the legacy, unversioned HMM
+// encoding.
+func deserializeHMMV0(d []byte) (*HMM, error) {
+	var terminalIdx int
+	var states []serializer.Serializer
+	var initStates []serializer.Serializer
+	var initProbs []float64
+	var transitionStates []serializer.Serializer
+	var transitionProbs []float64
+	var emitter Emitter
+	err := serializer.DeserializeAny(d, &terminalIdx, &states, &initStates, &initProbs,
+		&transitionStates, &transitionProbs, &emitter)
+	if err != nil {
+		return nil, err
+	}
+	if len(transitionStates)%2 != 0 || len(transitionProbs) != len(transitionStates)/2 ||
+		len(initProbs) != len(initStates) || terminalIdx >= len(states) {
+		return nil, errors.New("invalid slice size")
+	} else if !serializersComparable(states, initStates, transitionStates) {
+		return nil, errors.New("State or Obs not comparable")
+	}
+	h := &HMM{
+		Emitter:     emitter,
+		Init:        map[State]float64{},
+		Transitions: map[Transition]float64{},
+	}
+	if terminalIdx >= 0 {
+		h.TerminalState = fromSerializer(states[terminalIdx])
+	}
+	for _, state := range states {
+		h.States = append(h.States, fromSerializer(state))
+	}
+	for i, prob := range transitionProbs {
+		t := Transition{
+			From: fromSerializer(transitionStates[i*2]),
+			To:   fromSerializer(transitionStates[i*2+1]),
+		}
+		h.Transitions[t] = prob
+	}
+	for i, state := range initStates {
+		h.Init[fromSerializer(state)] = initProbs[i]
+	}
+	return h, nil
+}
+
+// sortedSerializers converts the values to serializers
+// and sorts them canonically, by type and then by their
+// encoded data.
+//
+// The values are returned in the same order as the
+// serializers.
+func sortedSerializers(values []interface{}) ([]interface{}, []serializer.Serializer,
+	error) {
+	sers := make([]serializer.Serializer, len(values))
+	keys := make([]string, len(values))
+	for i, value := range values {
+		ser, err := toSerializer(value)
+		if err != nil {
+			return nil, nil, err
+		}
+		data, err := ser.Serialize()
+		if err != nil {
+			return nil, nil, err
+		}
+		sers[i] = ser
+		keys[i] = ser.SerializerType() + "\x00" + string(data)
+	}
+	order := make([]int, len(values))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return keys[order[i]] < keys[order[j]]
+	})
+	sortedValues := make([]interface{}, len(values))
+	sortedSers := make([]serializer.Serializer, len(values))
+	for i, idx := range order {
+		sortedValues[i] = values[idx]
+		sortedSers[i] = sers[idx]
+	}
+	return sortedValues, sortedSers, nil
+}
@@ -11,6 +11,8 @@ import (
 //
 // Probabilities are experssed in the log domain.
 // States with 0 probability are omitted.
+// Silent states are always omitted, since they do not
+// correspond to any timestep.
 //
 // The caller should read through the entire channel,
 // which is fed len(obs) items.
@@ -21,21 +23,25 @@ func ForwardProbs(h *HMM, obs []Obs) <-chan map[State]float64 {
 		close(res)
 		return res
 	}
-	return forwardProbs(newHMMCache(h), h, obs)
+	return forwardProbs(newHMMCache(h), h, obs, nil)
 }
 
-func forwardProbs(c *hmmCache, h *HMM, obs []Obs) <-chan map[State]float64 {
+func forwardProbs(c *hmmCache, h *HMM, obs []Obs,
+	constraints []StateConstraint) <-chan map[State]float64 {
 	res := make(chan map[State]float64, 1)
 	go func() {
 		defer close(res)
-		distribution := newFastStateMapFrom(h, h.Init)
-		for _, o := range obs {
+		distribution := c.Init
+		for t := range obs {
 			// Compute P(X_i | Z_i)
-			emitProbs := h.Emitter.LogProbs(o, h.States...)
+			emitProbs := constrainedEmissions(c, h, obs, constraints, t)
 
 			// Compute P(X_0:i, Z_i) from P(X_0:i-1, Z_i)
 			outJoints := map[State]float64{}
 			distribution.Iter(func(state int, prior float64) {
+				if c.Silent[state] {
+					return
+				}
 				prob := prior + emitProbs[state]
 				if !math.IsInf(prob, -1) {
 					outJoints[h.States[state]] = prob
@@ -47,7 +53,7 @@ func forwardProbs(c *hmmCache, h *HMM, obs []Obs) <-chan map[State]float64 {
 			newDist := newFastStateMap(h)
 			for _, trans := range c.Transitions {
 				prior, hasPrior := distribution.Get(trans.From)
-				if !hasPrior {
+				if !hasPrior || c.Silent[trans.From] {
 					continue
 				}
 				destProb := prior + trans.Prob + emitProbs[trans.From]
@@ -74,17 +80,18 @@ func BackwardProbs(h *HMM, obs []Obs) <-chan map[State]float64 {
 		close(res)
 		return res
 	}
-	return backwardProbs(newHMMCache(h), h, obs)
+	return backwardProbs(newHMMCache(h), h, obs, nil)
 }
 
-func backwardProbs(c *hmmCache, h *HMM, obs []Obs) <-chan map[State]float64 {
+func backwardProbs(c *hmmCache, h *HMM, obs []Obs,
+	constraints []StateConstraint) <-chan map[State]float64 {
 	res := make(chan map[State]float64, 1)
 	go func() {
 		defer close(res)
 		distribution := initialBackwardDist(c, h)
 		for i := len(obs) - 1; i >= 0; i-- {
 			// Compute P(X_i | Z_i)
-			emitProbs := h.Emitter.LogProbs(obs[i], h.States...)
+			emitProbs := constrainedEmissions(c, h, obs, constraints, i)
 
 			// Compute P(X_i:n | Z_i-1) for all Z_i-1.
 			newDist := newFastStateMap(h)
@@ -112,9 +119,8 @@ func initialBackwardDist(c *hmmCache, h *HMM) *fastStateMap {
 		}
 		return res
 	}
-	terminalIdx := c.S2I[h.TerminalState]
 	for _, trans := range c.Transitions {
-		if trans.To == terminalIdx && !math.IsInf(trans.Prob, -1) {
+		if trans.To == c.Terminal && !math.IsInf(trans.Prob, -1) {
 			res.Set(trans.From, trans.Prob)
 		}
 	}
@@ -126,23 +132,15 @@ func initialBackwardDist(c *hmmCache, h *HMM) *fastStateMap {
 // It is faster than creating a new ForwardBackward and
 // calling LogLikelihood on the result.
 func LogLikelihood(h *HMM, obs []Obs) float64 {
+	cache := newHMMCache(h)
+
 	if len(obs) == 0 {
-		if h.TerminalState == nil {
-			return 0
-		} else {
-			if prob, ok := h.Init[h.TerminalState]; ok {
-				return prob
-			} else {
-				return math.Inf(-1)
-			}
-		}
+		return emptyLogLikelihood(cache)
 	}
 
-	cache := newHMMCache(h)
-
 	firstBwdFwd := initialBackwardDist(cache, h).Map()
 	lastFwdBwd := map[State]float64{}
-	for dist := range forwardProbs(cache, h, obs) {
+	for dist := range forwardProbs(cache, h, obs, nil) {
 		lastFwdBwd = dist
 	}
 
@@ -156,12 +154,43 @@ func LogLikelihood(h *HMM, obs []Obs) float64 {
 	return sum
 }
 
+// WeightedLogLikelihood computes the weighted sum of the
+// log-likelihoods of the sequences.
+//
+// This is the objective which BaumWelchWeighted increases,
+// so it may be used to monitor convergence.
+func WeightedLogLikelihood(h *HMM, seqs []WeightedSeq) float64 {
+	var sum float64
+	for _, seq := range seqs {
+		if seq.Weight != 0 {
+			sum += seq.Weight * LogLikelihood(h, seq.Obs)
+		}
+	}
+	return sum
+}
+
+// emptyLogLikelihood computes the log-likelihood of an
+// empty observation sequence.
+func emptyLogLikelihood(c *hmmCache) float64 {
+	if c.Terminal < 0 {
+		return 0
+	}
+	if prob, ok := c.Init.Get(c.Terminal); ok {
+		return prob
+	}
+	return math.Inf(-1)
+}
+
 // ForwardBackward is a result from the forward-backward.
 type ForwardBackward struct {
 	// Algorithm inputs.
 	HMM *HMM
 	Obs []Obs
 
+	// Constraints optionally restricts the hidden states.
+	// See NewForwardBackwardConstrained.
+	Constraints []StateConstraint
+
 	// Cached values used for inference.
 	ForwardOut  []map[State]float64
 	BackwardOut []map[State]float64
@@ -172,21 +201,44 @@ type ForwardBackward struct {
 // NewForwardBackward creates a Smoother that performs hidden
 // state inference given the HMM and the observations.
 func NewForwardBackward(h *HMM, obs []Obs) *ForwardBackward {
+	return newForwardBackward(newHMMCache(h), h, obs, nil)
+}
+
+// NewForwardBackwardConstrained is like NewForwardBackward,
+// but the hidden state at each timestep is restricted by
+// the corresponding constraint.
+//
+// The resulting distributions are conditioned on the
+// constraints being satisfied, and the log-likelihood is
+// the joint probability of the observations and of the
+// constraints being satisfied.
+//
+// The constraints slice must either be nil or have one
+// entry per observation.
+func NewForwardBackwardConstrained(h *HMM, obs []Obs,
+	constraints []StateConstraint) *ForwardBackward {
+	checkConstraints(obs, constraints)
+	return newForwardBackward(newHMMCache(h), h, obs, constraints)
+}
+
+func newForwardBackward(c *hmmCache, h *HMM, obs []Obs,
+	constraints []StateConstraint) *ForwardBackward {
 	res := &ForwardBackward{
-		HMM:   h,
-		Obs:   obs,
-		cache: newHMMCache(h),
+		HMM:         h,
+		Obs:         obs,
+		Constraints: constraints,
+		cache:       c,
 	}
 	var wg sync.WaitGroup
 	wg.Add(2)
 	go func() {
-		for fwdOut := range forwardProbs(res.cache, h, obs) {
+		for fwdOut := range forwardProbs(res.cache, h, obs, constraints) {
 			res.ForwardOut = append(res.ForwardOut, fwdOut)
 		}
 		wg.Done()
 	}()
 	go func() {
-		for bwdOut := range backwardProbs(res.cache, h, obs) {
+		for bwdOut := range backwardProbs(res.cache, h, obs, constraints) {
 			res.BackwardOut = append(res.BackwardOut, bwdOut)
 		}
 		wg.Done()
@@ -199,15 +251,7 @@ func NewForwardBackward(h *HMM, obs []Obs) *ForwardBackward {
 // sequence.
 func (f *ForwardBackward) LogLikelihood() float64 {
 	if len(f.Obs) == 0 {
-		if f.HMM.TerminalState == nil {
-			return 0
-		} else {
-			if prob, ok := f.HMM.Init[f.HMM.TerminalState]; ok {
-				return prob
-			} else {
-				return math.Inf(-1)
-			}
-		}
+		return emptyLogLikelihood(f.cache)
 	}
 
 	fwdDist := f.ForwardOut[len(f.ForwardOut)-1]
@@ -260,6 +304,10 @@ func (f *ForwardBackward) Dist(t int) map[State]float64 {
 //
 // The behavior is undefined if the given hidden state has
 // zero probability.
+//
+// Paths through silent states are folded into the result,
+// so that both states are emitting states (or, at the end
+// of the sequence, the terminal state).
 func (f *ForwardBackward) CondDist(t int) map[State]map[State]float64 {
 	fastRes := f.fastCondDist(t)
 	res := map[State]map[State]float64{}
@@ -292,7 +340,7 @@ func (f *ForwardBackward) fastCondDist(t int) []*fastStateMap {
 	if t < len(f.Obs) {
 		bwd := f.BackwardOut[len(f.BackwardOut)-(t+1)]
 		bwdDist = newFastStateMapFrom(f.HMM, bwd)
-		emissionDist = f.HMM.Emitter.LogProbs(f.Obs[t], f.HMM.States...)
+		emissionDist = constrainedEmissions(f.cache, f.HMM, f.Obs, f.Constraints, t)
 	}
 
 	prevDist := newFastStateMapFrom(f.HMM, f.Dist(t-1))
@@ -318,8 +366,7 @@ func (f *ForwardBackward) fastCondDist(t int) []*fastStateMap {
 		fromDist := fromDists[trans.From]
 		endProb := prevProb + trans.Prob
 		if t == len(f.Obs) {
-			if f.HMM.TerminalState != nil &&
-				trans.To != f.cache.S2I[f.HMM.TerminalState] {
+			if f.HMM.TerminalState != nil && trans.To != f.cache.Terminal {
 				continue
 			}
 		} else {
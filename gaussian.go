@@ -0,0 +1,170 @@
+package hmm
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/serializer"
+)
+
+func init() {
+	serializer.RegisterTypedDeserializer(GaussianEmitter{}.SerializerType(),
+		DeserializeGaussianEmitter)
+}
+
+// A Gaussian is a multivariate normal distribution with a
+// diagonal covariance matrix.
+type Gaussian struct {
+	Mean []float64
+
+	// Var stores the variance of each component.
+	Var []float64
+}
+
+// LogProb computes the log density of the vector x.
+func (g *Gaussian) LogProb(x []float64) float64 {
+	return g.PartialLogProb(x, nil)
+}
+
+// PartialLogProb computes the marginal log density of the
+// components of x marked in observed.
+// If observed is nil, all the components are used.
+func (g *Gaussian) PartialLogProb(x []float64, observed []bool) float64 {
+	if len(x) != len(g.Mean) {
+		panic("dimension mismatch")
+	}
+	var res float64
+	for i, val := range x {
+		if observed != nil && !observed[i] {
+			continue
+		}
+		diff := val - g.Mean[i]
+		res -= 0.5 * (math.Log(2*math.Pi*g.Var[i]) + diff*diff/g.Var[i])
+	}
+	return res
+}
+
+// Sample samples a vector from the distribution.
+func (g *Gaussian) Sample(gen *rand.Rand) []float64 {
+	res := make([]float64, len(g.Mean))
+	for i, mean := range g.Mean {
+		var noise float64
+		if gen != nil {
+			noise = gen.NormFloat64()
+		} else {
+			noise = rand.NormFloat64()
+		}
+		res[i] = mean + noise*math.Sqrt(g.Var[i])
+	}
+	return res
+}
+
+// A GaussianEmitter is an Emitter which produces vector
+// observations from a Gaussian for each state.
+//
+// Observations are []float64 values.
+// A GaussianEmitter implements PartialEmitter, so some of
+// the components of an observation may be missing.
+type GaussianEmitter map[State]*Gaussian
+
+// DeserializeGaussianEmitter deserializes a
+// GaussianEmitter.
+func DeserializeGaussianEmitter(d []byte) (g GaussianEmitter, err error) {
+	defer essentials.AddCtxTo("deserialize GaussianEmitter", &err)
+	var states []serializer.Serializer
+	var means []float64
+	var vars []float64
+	if err := serializer.DeserializeAny(d, &states, &means, &vars); err != nil {
+		return nil, err
+	}
+	if len(means) != len(vars) || (len(states) == 0 && len(means) != 0) ||
+		(len(states) != 0 && len(means)%len(states) != 0) {
+		return nil, errors.New("mismatching slice lengths")
+	} else if !serializersComparable(states) {
+		return nil, errors.New("State not comparable")
+	}
+	g = GaussianEmitter{}
+	if len(states) == 0 {
+		return g, nil
+	}
+	dim := len(means) / len(states)
+	for i, state := range states {
+		g[fromSerializer(state)] = &Gaussian{
+			Mean: means[i*dim : (i+1)*dim],
+			Var:  vars[i*dim : (i+1)*dim],
+		}
+	}
+	return g, nil
+}
+
+// Sample samples an observation from the state.
+func (g GaussianEmitter) Sample(gen *rand.Rand, state State) Obs {
+	dist, ok := g[state]
+	if !ok {
+		panic("no entries for the given state")
+	}
+	return dist.Sample(gen)
+}
+
+// LogProbs computes the conditional log densities.
+//
+// States without a Gaussian have a probability of 0.
+func (g GaussianEmitter) LogProbs(obs Obs, states ...State) []float64 {
+	return g.PartialLogProbs(obs, nil, states...)
+}
+
+// PartialLogProbs computes the marginal log densities of
+// the observed components of obs.
+func (g GaussianEmitter) PartialLogProbs(obs Obs, observed []bool,
+	states ...State) []float64 {
+	vec := obs.([]float64)
+	res := make([]float64, len(states))
+	for i, state := range states {
+		if dist, ok := g[state]; ok {
+			res[i] = dist.PartialLogProb(vec, observed)
+		} else {
+			res[i] = math.Inf(-1)
+		}
+	}
+	return res
+}
+
+// SerializerType returns the unique ID used to serialize
+// a GaussianEmitter with the serializer package.
+func (g GaussianEmitter) SerializerType() string {
+	return "github.com/unixpickle/hmm.GaussianEmitter"
+}
+
+// Serialize serializes the GaussianEmitter.
+//
+// For this to work, the states must either implement
+// serializer.Serializer or be plain comparable values (see
+// HMM.Serialize), and every Gaussian must have the same
+// dimensionality.
+//
+// States are written in a canonical order, so the same
+// GaussianEmitter always produces the same bytes.
+func (g GaussianEmitter) Serialize() (data []byte, err error) {
+	defer essentials.AddCtxTo("serialize GaussianEmitter", &err)
+	var rawStates []interface{}
+	for state := range g {
+		rawStates = append(rawStates, state)
+	}
+	sortedStates, states, err := sortedSerializers(rawStates)
+	if err != nil {
+		return nil, err
+	}
+	var means []float64
+	var vars []float64
+	for i, state := range sortedStates {
+		dist := g[state]
+		if i > 0 && len(dist.Mean) != len(means)/i {
+			return nil, errors.New("mismatching dimensions")
+		}
+		means = append(means, dist.Mean...)
+		vars = append(vars, dist.Var...)
+	}
+	return serializer.SerializeAny(states, means, vars)
+}
@@ -0,0 +1,49 @@
+package hmm
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/serializer"
+)
+
+func TestGaussianLogProb(t *testing.T) {
+	g := &Gaussian{Mean: []float64{1, -2}, Var: []float64{2, 0.5}}
+	x := []float64{0.5, -1}
+	expected := math.Log(normalDensity(0.5, 1, 2) * normalDensity(-1, -2, 0.5))
+	if actual := g.LogProb(x); math.Abs(actual-expected) > 1e-8 {
+		t.Errorf("expected %f but got %f", expected, actual)
+	}
+	expected = math.Log(normalDensity(-1, -2, 0.5))
+	if actual := g.PartialLogProb(x, []bool{false, true}); math.Abs(actual-expected) > 1e-8 {
+		t.Errorf("expected %f but got %f", expected, actual)
+	}
+}
+
+func TestGaussianEmitterSerialize(t *testing.T) {
+	e1 := GaussianEmitter{
+		serializer.String("A"): &Gaussian{Mean: []float64{1, 2}, Var: []float64{3, 4}},
+		serializer.String("B"): &Gaussian{Mean: []float64{-1, 0}, Var: []float64{1, 0.5}},
+	}
+	data, err := serializer.SerializeAny(e1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e2 GaussianEmitter
+	if err := serializer.DeserializeAny(data, &e2); err != nil {
+		t.Fatal(err)
+	}
+	obs := []float64{0.5, 1.5}
+	states := []State{serializer.String("A"), serializer.String("B")}
+	probs1 := e1.LogProbs(obs, states...)
+	probs2 := e2.LogProbs(obs, states...)
+	for i, p1 := range probs1 {
+		if math.Abs(p1-probs2[i]) > 1e-8 {
+			t.Errorf("state %v: expected %f but got %f", states[i], p1, probs2[i])
+		}
+	}
+}
+
+func normalDensity(x, mean, variance float64) float64 {
+	return math.Exp(-(x-mean)*(x-mean)/(2*variance)) / math.Sqrt(2*math.Pi*variance)
+}
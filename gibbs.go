@@ -0,0 +1,583 @@
+package hmm
+
+import (
+	"math"
+	"math/rand"
+	"runtime"
+	"sync"
+)
+
+// SampleHidden samples a hidden state sequence from the
+// posterior distribution P(Z|X) using forward-filtering
+// backward-sampling.
+//
+// Like MostLikely, the resulting path includes silent
+// states but not the terminal state.
+//
+// If the observations are impossible, nil is returned.
+func SampleHidden(gen *rand.Rand, h *HMM, obs []Obs) []State {
+	path, _ := newPathSampler(h).Sample(gen, obs)
+	if path == nil {
+		return nil
+	}
+	res := make([]State, len(path))
+	for i, idx := range path {
+		res[i] = h.States[idx]
+	}
+	return res
+}
+
+// NormalInvGamma is a Normal-Inverse-Gamma prior over the
+// mean and variance of each component of a Gaussian.
+//
+// The variance has an inverse gamma prior with shape Alpha
+// and scale Beta, and the mean is normally distributed
+// around Mean with variance Var/Kappa.
+type NormalInvGamma struct {
+	Mean  float64
+	Kappa float64
+	Alpha float64
+	Beta  float64
+}
+
+// Posterior samples a mean and variance from the posterior
+// given the observed values.
+func (n *NormalInvGamma) Posterior(gen *rand.Rand, values []float64) (mean, variance float64) {
+	count := float64(len(values))
+	var sampleMean float64
+	for _, x := range values {
+		sampleMean += x
+	}
+	if len(values) > 0 {
+		sampleMean /= count
+	}
+	var sqErr float64
+	for _, x := range values {
+		sqErr += (x - sampleMean) * (x - sampleMean)
+	}
+
+	kappa := n.Kappa + count
+	postMean := (n.Kappa*n.Mean + count*sampleMean) / kappa
+	alpha := n.Alpha + count/2
+	diff := sampleMean - n.Mean
+	beta := n.Beta + sqErr/2 + n.Kappa*count*diff*diff/(2*kappa)
+
+	variance = beta / math.Exp(sampleLogGamma(gen, alpha))
+	var noise float64
+	if gen != nil {
+		noise = gen.NormFloat64()
+	} else {
+		noise = rand.NormFloat64()
+	}
+	mean = postMean + noise*math.Sqrt(variance/kappa)
+	return
+}
+
+// GibbsSampler draws samples from the posterior over an
+// HMM's parameters given a set of observation sequences.
+//
+// Each iteration samples a hidden path for every sequence
+// using forward-filtering backward-sampling, and then
+// samples the parameters from their conjugate posteriors
+// given the paths.
+// Init, the rows of Transitions, and the rows of a
+// TabularEmitter have symmetric Dirichlet priors, while
+// every component of a GaussianEmitter has an independent
+// Normal-Inverse-Gamma prior.
+//
+// The structure of the initial model is preserved: states,
+// transitions, and observations with no entry in the
+// initial model keep a probability of 0.
+// Other emitters are not supported.
+type GibbsSampler struct {
+	// InitPrior, TransPrior, and EmitPrior are the
+	// Dirichlet concentration parameters for the initial
+	// distribution, the transitions, and the tabular
+	// emissions, respectively.
+	// If one is 0, then 1 is used.
+	InitPrior  float64
+	TransPrior float64
+	EmitPrior  float64
+
+	// GaussianPrior is the prior for Gaussian emissions.
+	// If nil, a vague prior with Mean 0, Kappa 0.01,
+	// Alpha 1, and Beta 1 is used.
+	GaussianPrior *NormalInvGamma
+
+	// BurnIn is the number of initial iterations whose
+	// parameters are discarded.
+	BurnIn int
+
+	// NumSamples is the number of posterior samples to
+	// produce.
+	// If it is 0, then 100 is used.
+	NumSamples int
+
+	// Thin is the number of iterations per sample after
+	// the burn-in period.
+	// If it is 0, then 1 is used.
+	Thin int
+
+	// Parallelism is the number of sequences to process
+	// concurrently.
+	// If it is 0, then GOMAXPROCS is used.
+	// It does not affect the results.
+	Parallelism int
+
+	// Gen, if non-nil, is the source of randomness.
+	// A seeded Gen makes the results reproducible.
+	Gen *rand.Rand
+}
+
+// A GibbsResult stores the samples and diagnostics from a
+// GibbsSampler.
+type GibbsResult struct {
+	// Samples stores the posterior parameter samples.
+	Samples []*HMM
+
+	// LogLikelihoods stores, for every iteration including
+	// the burn-in, the log-likelihood of the data under the
+	// parameters used to sample the hidden paths.
+	// The first entry corresponds to the initial model.
+	LogLikelihoods []float64
+
+	// Occupancy stores, for every iteration, the number of
+	// timesteps assigned to each emitting state.
+	Occupancy []map[State]int
+}
+
+// EffectiveSampleSize estimates the number of independent
+// samples that a correlated trace is worth.
+//
+// It uses the initial positive sequence estimator of the
+// trace's autocorrelation time.
+func EffectiveSampleSize(trace []float64) float64 {
+	n := len(trace)
+	if n < 2 {
+		return float64(n)
+	}
+	var mean float64
+	for _, x := range trace {
+		mean += x
+	}
+	mean /= float64(n)
+	autocov := func(lag int) float64 {
+		var sum float64
+		for i := 0; i+lag < n; i++ {
+			sum += (trace[i] - mean) * (trace[i+lag] - mean)
+		}
+		return sum / float64(n)
+	}
+	variance := autocov(0)
+	if variance == 0 {
+		return float64(n)
+	}
+	tau := -1.0
+	for lag := 0; lag+1 < n; lag += 2 {
+		pair := (autocov(lag) + autocov(lag+1)) / variance
+		if pair <= 0 {
+			break
+		}
+		tau += 2 * pair
+	}
+	return float64(n) / math.Max(tau, 1)
+}
+
+// Run runs the sampler starting from the parameters of h.
+func (g *GibbsSampler) Run(h *HMM, data [][]Obs) *GibbsResult {
+	numSamples := g.NumSamples
+	if numSamples == 0 {
+		numSamples = 100
+	}
+	thin := g.Thin
+	if thin == 0 {
+		thin = 1
+	}
+	supports := newGibbsSupports(h)
+
+	res := &GibbsResult{}
+	numIters := g.BurnIn + numSamples*thin
+	for iter := 0; iter < numIters; iter++ {
+		stats, ll := g.samplePaths(h, data)
+		res.LogLikelihoods = append(res.LogLikelihoods, ll)
+		res.Occupancy = append(res.Occupancy, stats.Occupancy(h))
+		h = g.sampleParams(h, supports, stats)
+		if iter >= g.BurnIn && (iter-g.BurnIn+1)%thin == 0 {
+			res.Samples = append(res.Samples, h)
+		}
+	}
+	return res
+}
+
+// samplePaths samples hidden paths for every sequence and
+// tallies up the resulting counts.
+// It also returns the log-likelihood of the data.
+func (g *GibbsSampler) samplePaths(h *HMM, data [][]Obs) (*gibbsStats, float64) {
+	numWorkers := g.Parallelism
+	if numWorkers == 0 {
+		numWorkers = runtime.GOMAXPROCS(0)
+	}
+	sampler := newPathSampler(h)
+
+	// Every sequence gets its own seed, drawn up front, and
+	// the paths are tallied in order, so that the results
+	// only depend on Gen, not on Parallelism or goroutine
+	// scheduling.
+	seeds := make([]int64, len(data))
+	for i := range seeds {
+		if g.Gen != nil {
+			seeds[i] = g.Gen.Int63()
+		} else {
+			seeds[i] = rand.Int63()
+		}
+	}
+
+	paths := make([][]int, len(data))
+	lls := make([]float64, len(data))
+	var wg sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for j := worker; j < len(data); j += numWorkers {
+				gen := rand.New(rand.NewSource(seeds[j]))
+				paths[j], lls[j] = sampler.Sample(gen, data[j])
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	stats := newGibbsStats(h)
+	var ll float64
+	for j, path := range paths {
+		if path != nil {
+			stats.Add(sampler.c, path, data[j])
+		}
+		ll += lls[j]
+	}
+	return stats, ll
+}
+
+// sampleParams samples new parameters given the counts
+// from the hidden paths.
+func (g *GibbsSampler) sampleParams(h *HMM, supports *gibbsSupports,
+	stats *gibbsStats) *HMM {
+	initPrior := g.InitPrior
+	if initPrior == 0 {
+		initPrior = 1
+	}
+	transPrior := g.TransPrior
+	if transPrior == 0 {
+		transPrior = 1
+	}
+	emitPrior := g.EmitPrior
+	if emitPrior == 0 {
+		emitPrior = 1
+	}
+
+	res := *h
+	res.Init = map[State]float64{}
+	var conc []float64
+	for _, idx := range supports.Init {
+		conc = append(conc, initPrior+stats.Init[idx])
+	}
+	for i, prob := range sampleLogDirichlet(g.Gen, conc) {
+		res.Init[h.States[supports.Init[i]]] = prob
+	}
+
+	res.Transitions = map[Transition]float64{}
+	for from, tos := range supports.Trans {
+		conc = conc[:0]
+		for _, to := range tos {
+			conc = append(conc, transPrior+stats.Trans[from][to])
+		}
+		for i, prob := range sampleLogDirichlet(g.Gen, conc) {
+			t := Transition{From: h.States[from], To: h.States[tos[i]]}
+			res.Transitions[t] = prob
+		}
+	}
+
+	switch emitter := h.Emitter.(type) {
+	case TabularEmitter:
+		res.Emitter = g.sampleTabular(h, supports, stats, emitPrior)
+	case GaussianEmitter:
+		res.Emitter = g.sampleGaussian(h, emitter, stats)
+	default:
+		panic("unsupported emitter type")
+	}
+	return &res
+}
+
+func (g *GibbsSampler) sampleTabular(h *HMM, supports *gibbsSupports, stats *gibbsStats,
+	prior float64) TabularEmitter {
+	res := TabularEmitter{}
+	for state, obses := range supports.Emit {
+		if obses == nil {
+			continue
+		}
+		counts := map[Obs]float64{}
+		for _, obs := range stats.Emit[state] {
+			if !isMissing(obs) {
+				counts[obs]++
+			}
+		}
+		conc := make([]float64, len(obses))
+		for i, obs := range obses {
+			conc[i] = prior + counts[obs]
+		}
+		row := map[Obs]float64{}
+		for i, prob := range sampleLogDirichlet(g.Gen, conc) {
+			row[obses[i]] = prob
+		}
+		res[h.States[state]] = row
+	}
+	return res
+}
+
+func (g *GibbsSampler) sampleGaussian(h *HMM, e GaussianEmitter,
+	stats *gibbsStats) GaussianEmitter {
+	prior := g.GaussianPrior
+	if prior == nil {
+		prior = &NormalInvGamma{Kappa: 0.01, Alpha: 1, Beta: 1}
+	}
+	res := GaussianEmitter{}
+	for stateIdx, state := range h.States {
+		old, ok := e[state]
+		if !ok {
+			continue
+		}
+		dist := &Gaussian{
+			Mean: make([]float64, len(old.Mean)),
+			Var:  make([]float64, len(old.Var)),
+		}
+		for i := range dist.Mean {
+			var values []float64
+			for _, obs := range stats.Emit[stateIdx] {
+				switch obs := obs.(type) {
+				case []float64:
+					values = append(values, obs[i])
+				case PartialObs:
+					if obs.Observed[i] {
+						values = append(values, obs.Obs.([]float64)[i])
+					}
+				}
+			}
+			dist.Mean[i], dist.Var[i] = prior.Posterior(g.Gen, values)
+		}
+		res[state] = dist
+	}
+	return res
+}
+
+// gibbsSupports stores the parameters of a model which
+// may have non-zero probabilities, in a fixed order.
+type gibbsSupports struct {
+	Init  []int
+	Trans [][]int
+
+	// Emit is only set for tabular emitters.
+	Emit [][]Obs
+}
+
+func newGibbsSupports(h *HMM) *gibbsSupports {
+	res := &gibbsSupports{Trans: make([][]int, len(h.States))}
+	for i, state := range h.States {
+		if _, ok := h.Init[state]; ok {
+			res.Init = append(res.Init, i)
+		}
+	}
+	for i, from := range h.States {
+		for j, to := range h.States {
+			if _, ok := h.Transitions[Transition{From: from, To: to}]; ok {
+				res.Trans[i] = append(res.Trans[i], j)
+			}
+		}
+	}
+	if te, ok := h.Emitter.(TabularEmitter); ok {
+		res.Emit = make([][]Obs, len(h.States))
+		for i, state := range h.States {
+			if row, ok := te[state]; ok {
+				res.Emit[i] = sortedObs(row)
+			}
+		}
+	}
+	return res
+}
+
+// gibbsStats stores the counts from a set of hidden paths.
+type gibbsStats struct {
+	Init  []float64
+	Trans [][]float64
+
+	// Emit stores the observations assigned to each state.
+	Emit [][]Obs
+}
+
+func newGibbsStats(h *HMM) *gibbsStats {
+	res := &gibbsStats{
+		Init:  make([]float64, len(h.States)),
+		Trans: make([][]float64, len(h.States)),
+		Emit:  make([][]Obs, len(h.States)),
+	}
+	for i := range res.Trans {
+		res.Trans[i] = make([]float64, len(h.States))
+	}
+	return res
+}
+
+// Add adds the counts from a path of state indices, which
+// should include silent states but not the terminal state.
+func (g *gibbsStats) Add(c *hmmCache, path []int, obs []Obs) {
+	if c.Terminal >= 0 {
+		path = append(append([]int{}, path...), c.Terminal)
+	}
+	if len(path) == 0 {
+		return
+	}
+	g.Init[path[0]]++
+	var t int
+	for i, state := range path {
+		if i > 0 {
+			g.Trans[path[i-1]][state]++
+		}
+		if !c.Silent[state] {
+			g.Emit[state] = append(g.Emit[state], obs[t])
+			t++
+		}
+	}
+}
+
+// Occupancy counts the timesteps assigned to each state.
+func (g *gibbsStats) Occupancy(h *HMM) map[State]int {
+	res := map[State]int{}
+	for i, obses := range g.Emit {
+		if len(obses) > 0 {
+			res[h.States[i]] = len(obses)
+		}
+	}
+	return res
+}
+
+// pathSampler implements forward-filtering
+// backward-sampling.
+type pathSampler struct {
+	h     *HMM
+	c     *hmmCache
+	trans [][]float64
+
+	// reach stores the result of reachTarget for every
+	// target state, if the model has silent states.
+	reach []*fastStateMap
+	init  []fastTransition
+}
+
+func newPathSampler(h *HMM) *pathSampler {
+	c := newHMMCache(h)
+	res := &pathSampler{
+		h:     h,
+		c:     c,
+		trans: denseTransitions(c, len(h.States)),
+	}
+	if len(c.SilentOrder) > 0 {
+		res.reach = make([]*fastStateMap, len(h.States))
+		for i := range h.States {
+			if c.isTarget(i) {
+				res.reach[i] = c.reachTarget(h, i)
+			}
+		}
+		newFastStateMapFrom(h, h.Init).Iter(func(state int, prob float64) {
+			res.init = append(res.init, fastTransition{From: -1, To: state, Prob: prob})
+		})
+	}
+	return res
+}
+
+// Sample samples a path of state indices and computes the
+// log-likelihood of the observations.
+//
+// If the observations are impossible, the path is nil.
+func (p *pathSampler) Sample(gen *rand.Rand, obs []Obs) ([]int, float64) {
+	c := p.c
+	if len(obs) == 0 {
+		ll := emptyLogLikelihood(c)
+		if math.IsInf(ll, -1) {
+			return nil, ll
+		} else if c.Terminal < 0 {
+			return []int{}, ll
+		}
+		return append([]int{}, p.silentPath(gen, -1, c.Terminal)...), ll
+	}
+
+	var forward [][]float64
+	for joints := range forwardProbs(c, p.h, obs, nil) {
+		probs := negInfSlice(len(p.h.States))
+		for state, prob := range joints {
+			probs[c.S2I[state]] = prob
+		}
+		forward = append(forward, probs)
+	}
+
+	weights := forward[len(obs)-1]
+	if c.Terminal >= 0 {
+		weights = finalTransitionProbs(c, weights)
+	}
+	ll := math.Inf(-1)
+	for _, w := range weights {
+		ll = addLogs(ll, w)
+	}
+	if math.IsInf(ll, -1) {
+		return nil, ll
+	}
+
+	emitting := make([]int, len(obs))
+	emitting[len(obs)-1] = sampleLogIndex(gen, weights)
+	for t := len(obs) - 2; t >= 0; t-- {
+		weights = make([]float64, len(p.h.States))
+		for state, prob := range forward[t] {
+			weights[state] = prob + p.trans[state][emitting[t+1]]
+		}
+		emitting[t] = sampleLogIndex(gen, weights)
+	}
+
+	var path []int
+	prev := -1
+	for _, state := range emitting {
+		path = append(path, p.silentPath(gen, prev, state)...)
+		path = append(path, state)
+		prev = state
+	}
+	if c.Terminal >= 0 {
+		path = append(path, p.silentPath(gen, prev, c.Terminal)...)
+	}
+	return path, ll
+}
+
+// silentPath samples the silent states visited between
+// the state from (or the start of the sequence, if from is
+// -1) and the target state, conditioned on reaching the
+// target without making an emission.
+func (p *pathSampler) silentPath(gen *rand.Rand, from, target int) []int {
+	if p.reach == nil {
+		return nil
+	}
+	reach := p.reach[target]
+	var res []int
+	for {
+		edges := p.init
+		if from >= 0 {
+			edges = p.c.Outgoing[from]
+		}
+		weights := negInfSlice(len(edges))
+		for i, edge := range edges {
+			if prob, ok := reach.Get(edge.To); ok {
+				weights[i] = edge.Prob + prob
+			}
+		}
+		next := edges[sampleLogIndex(gen, weights)].To
+		if next == target {
+			return res
+		}
+		res = append(res, next)
+		from = next
+	}
+}
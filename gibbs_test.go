@@ -0,0 +1,195 @@
+package hmm
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestSampleHidden(t *testing.T) {
+	tests := []struct {
+		h   *HMM
+		obs []Obs
+	}{
+		{testingHMM(), []Obs{}},
+		{testingHMM(), []Obs{"x", "z", "y"}},
+		{silentTestingHMM(), []Obs{"x"}},
+		{silentTestingHMM(), []Obs{"x", "y", "y"}},
+	}
+	gen := rand.New(rand.NewSource(1337))
+	const numSamples = 20000
+	for i, test := range tests {
+		ll := LogLikelihood(test.h, test.obs)
+		counts := map[string]int{}
+		probs := map[string]float64{}
+		for j := 0; j < numSamples; j++ {
+			path := SampleHidden(gen, test.h, test.obs)
+			key := fmt.Sprint(path)
+			counts[key]++
+			probs[key] = math.Exp(silentPathLogProb(test.h, path, test.obs) - ll)
+		}
+		var total float64
+		for key, count := range counts {
+			total += probs[key]
+			actual := float64(count) / numSamples
+			if math.Abs(actual-probs[key]) > 0.02 {
+				t.Errorf("test %d: path %s: expected frequency %f but got %f", i, key,
+					probs[key], actual)
+			}
+		}
+		if math.Abs(total-1) > 0.01 {
+			t.Errorf("test %d: sampled paths only cover probability %f", i, total)
+		}
+	}
+
+	if SampleHidden(gen, testingHMM(), []Obs{"w"}) != nil {
+		t.Error("expected nil path for impossible observations")
+	}
+}
+
+func TestGibbsSamplerTabular(t *testing.T) {
+	gen := rand.New(rand.NewSource(1337))
+	target := testingHMM()
+	var data [][]Obs
+	for i := 0; i < 300; i++ {
+		_, obs := target.Sample(gen)
+		data = append(data, obs)
+	}
+	init := RandomHMM(gen, target.States, target.TerminalState, []Obs{"x", "y", "z"})
+	delete(init.Transitions, Transition{From: "A", To: "B"})
+
+	sampler := &GibbsSampler{
+		BurnIn:     30,
+		NumSamples: 10,
+		Thin:       2,
+		Gen:        gen,
+	}
+	res := sampler.Run(init, data)
+	if len(res.Samples) != 10 {
+		t.Fatalf("expected 10 samples but got %d", len(res.Samples))
+	}
+	if len(res.LogLikelihoods) != 50 || len(res.Occupancy) != 50 {
+		t.Fatalf("unexpected diagnostic lengths: %d, %d", len(res.LogLikelihoods),
+			len(res.Occupancy))
+	}
+
+	expected := totalLogLikelihood(target, data)
+	for i, sample := range res.Samples {
+		if _, ok := sample.Transitions[Transition{From: "A", To: "B"}]; ok {
+			t.Errorf("sample %d: transition should have been pruned", i)
+		}
+		actual := totalLogLikelihood(sample, data)
+		if actual < expected*1.05 {
+			t.Errorf("sample %d: log-likelihood %f is much worse than %f", i, actual, expected)
+		}
+	}
+	if res.LogLikelihoods[len(res.LogLikelihoods)-1] <= res.LogLikelihoods[0] {
+		t.Error("log-likelihood did not improve")
+	}
+}
+
+func TestGibbsSamplerGaussian(t *testing.T) {
+	gen := rand.New(rand.NewSource(1337))
+	target := gaussianTestingHMM()
+	var data [][]Obs
+	for i := 0; i < 200; i++ {
+		_, obs := target.Sample(gen)
+		data = append(data, obs)
+	}
+	data[0][0] = nil
+	if len(data[1]) > 0 {
+		data[1][0] = PartialObs{Obs: data[1][0], Observed: []bool{true, false}}
+	}
+
+	init := gaussianTestingHMM()
+	init.Emitter = GaussianEmitter{
+		"A": &Gaussian{Mean: []float64{0.5, 0.5}, Var: []float64{1, 1}},
+		"B": &Gaussian{Mean: []float64{-0.5, 0}, Var: []float64{1, 1}},
+	}
+	sampler := &GibbsSampler{BurnIn: 30, NumSamples: 5, Gen: gen}
+	res := sampler.Run(init, data)
+
+	expected := totalLogLikelihood(target, data)
+	for i, sample := range res.Samples {
+		actual := totalLogLikelihood(sample, data)
+		if actual < expected-0.05*math.Abs(expected) {
+			t.Errorf("sample %d: log-likelihood %f is much worse than %f", i, actual, expected)
+		}
+	}
+}
+
+func TestGibbsSamplerReproducible(t *testing.T) {
+	target := testingHMM()
+	run := func(parallelism int) *GibbsResult {
+		gen := rand.New(rand.NewSource(42))
+		var data [][]Obs
+		for i := 0; i < 50; i++ {
+			_, obs := target.Sample(gen)
+			data = append(data, obs)
+		}
+		init := RandomHMM(gen, target.States, target.TerminalState, []Obs{"x", "y", "z"})
+		sampler := &GibbsSampler{NumSamples: 5, Parallelism: parallelism, Gen: gen}
+		return sampler.Run(init, data)
+	}
+	res := run(1)
+	if !reflect.DeepEqual(res, run(1)) {
+		t.Error("results differ between runs with the same seed")
+	}
+	if !reflect.DeepEqual(res, run(3)) {
+		t.Error("results depend on Parallelism")
+	}
+}
+
+func TestEffectiveSampleSize(t *testing.T) {
+	gen := rand.New(rand.NewSource(1337))
+	independent := make([]float64, 5000)
+	correlated := make([]float64, 5000)
+	for i := range independent {
+		independent[i] = gen.NormFloat64()
+		if i > 0 {
+			correlated[i] = 0.9*correlated[i-1] + gen.NormFloat64()
+		}
+	}
+	if ess := EffectiveSampleSize(independent); ess < 4000 {
+		t.Errorf("independent trace: unexpected ESS %f", ess)
+	}
+	// The autocorrelation time of an AR(1) process is
+	// (1 + 0.9) / (1 - 0.9) = 19.
+	if ess := EffectiveSampleSize(correlated); ess < 5000/19.0/2 || ess > 5000/19.0*2 {
+		t.Errorf("correlated trace: unexpected ESS %f", ess)
+	}
+}
+
+// silentPathLogProb computes the joint log probability of
+// the observations and a path which may include silent
+// states.
+func silentPathLogProb(h *HMM, path []State, obs []Obs) float64 {
+	silent := silentSet(h)
+	if h.TerminalState != nil {
+		path = append(append([]State{}, path...), h.TerminalState)
+	}
+	if len(path) == 0 {
+		return 0
+	}
+	prob, ok := h.Init[path[0]]
+	if !ok {
+		return math.Inf(-1)
+	}
+	var t int
+	for i, state := range path {
+		if i > 0 {
+			trans, ok := h.Transitions[Transition{From: path[i-1], To: state}]
+			if !ok {
+				return math.Inf(-1)
+			}
+			prob += trans
+		}
+		if !silent[state] && state != h.TerminalState {
+			prob += h.Emitter.LogProbs(obs[t], state)[0]
+			t++
+		}
+	}
+	return prob
+}
@@ -0,0 +1,386 @@
+package hmm
+
+import (
+	"math"
+	"math/rand"
+)
+
+// StickyHDPHMM fits a sticky hierarchical Dirichlet process
+// HMM, which infers the number of hidden states from the
+// data.
+//
+// The model uses the weak-limit approximation, truncating
+// the number of states to MaxStates.
+// A global distribution over states is drawn from
+// Dir(Gamma/MaxStates, ...), and each row of the transition
+// matrix is drawn from a Dirichlet centered around the
+// global distribution with concentration Alpha, plus an
+// extra Kappa for the self-transition.
+// Inference uses blocked Gibbs sampling, where each sweep
+// samples every hidden path with forward-filtering
+// backward-sampling before sampling the parameters.
+//
+// Hidden states are represented as ints.
+type StickyHDPHMM struct {
+	// MaxStates is the truncation level.
+	// If it is 0, then 20 is used.
+	MaxStates int
+
+	// Alpha and Gamma are the concentration parameters of
+	// the transition rows and the global distribution.
+	// If one is 0, then 1 is used.
+	Alpha float64
+	Gamma float64
+
+	// Kappa is the extra self-transition mass.
+	// Larger values favor staying in a state.
+	Kappa float64
+
+	// TerminalState, if non-nil, is used as the terminal
+	// state of the model.
+	// It must not be an int.
+	//
+	// Transitions to the terminal state have a Dirichlet
+	// prior concentration of 1.
+	TerminalState State
+
+	// Obs lists the possible observations.
+	// If it is non-nil, then a TabularEmitter is used,
+	// where each row has a symmetric Dirichlet prior with
+	// concentration EmitPrior (or 1, if EmitPrior is 0).
+	//
+	// If Obs is nil, observations are []float64 vectors of
+	// dimension Dim, and a GaussianEmitter is used with the
+	// prior GaussianPrior (see GibbsSampler).
+	Obs           []Obs
+	EmitPrior     float64
+	Dim           int
+	GaussianPrior *NormalInvGamma
+
+	// Iterations is the number of Gibbs sweeps.
+	// If it is 0, then 100 is used.
+	Iterations int
+
+	// Parallelism is the number of sequences to process
+	// concurrently.
+	// If it is 0, then GOMAXPROCS is used.
+	// It does not affect the results.
+	Parallelism int
+
+	// Gen, if non-nil, is the source of randomness.
+	// A seeded Gen makes the results reproducible.
+	Gen *rand.Rand
+}
+
+// An HDPResult is the result of StickyHDPHMM inference.
+type HDPResult struct {
+	// HMM is the final sample, with the states that were
+	// not visited by the final hidden paths removed.
+	// The remaining states are numbered from 0.
+	HMM *HMM
+
+	// LogLikelihoods stores the log-likelihood of the data
+	// at each sweep.
+	LogLikelihoods []float64
+
+	// NumStates stores the number of states visited by the
+	// hidden paths at each sweep.
+	NumStates []int
+}
+
+// Run runs blocked Gibbs sampling on the data.
+func (s *StickyHDPHMM) Run(data [][]Obs) *HDPResult {
+	numStates := s.MaxStates
+	if numStates == 0 {
+		numStates = 20
+	}
+	iterations := s.Iterations
+	if iterations == 0 {
+		iterations = 100
+	}
+
+	h := s.initialHMM(numStates)
+	sampler := &GibbsSampler{
+		EmitPrior:     s.EmitPrior,
+		GaussianPrior: s.GaussianPrior,
+		Parallelism:   s.Parallelism,
+		Gen:           s.Gen,
+	}
+	supports := newGibbsSupports(h)
+
+	// Start from uniformly random paths.
+	stats := newGibbsStats(h)
+	cache := newHMMCache(h)
+	for _, seq := range data {
+		path := make([]int, len(seq))
+		for i := range path {
+			path[i] = s.intn(numStates)
+		}
+		stats.Add(cache, path, seq)
+	}
+
+	beta := make([]float64, numStates)
+	for i := range beta {
+		beta[i] = 1 / float64(numStates)
+	}
+
+	res := &HDPResult{}
+	for iter := 0; iter <= iterations; iter++ {
+		beta = s.sampleBeta(beta, stats, numStates)
+		h = s.sampleParams(h, beta, stats, numStates)
+		if _, ok := h.Emitter.(TabularEmitter); ok {
+			h.Emitter = sampler.sampleTabular(h, supports, stats, s.emitPrior())
+		} else {
+			h.Emitter = sampler.sampleGaussian(h, h.Emitter.(GaussianEmitter), stats)
+		}
+		if iter == iterations {
+			break
+		}
+		var ll float64
+		stats, ll = sampler.samplePaths(h, data)
+		res.LogLikelihoods = append(res.LogLikelihoods, ll)
+		res.NumStates = append(res.NumStates, len(stats.Occupancy(h)))
+	}
+
+	res.HMM = removeUnusedStates(h, stats.Occupancy(h))
+	return res
+}
+
+func (s *StickyHDPHMM) initialHMM(numStates int) *HMM {
+	h := &HMM{
+		TerminalState: s.TerminalState,
+		Init:          map[State]float64{},
+		Transitions:   map[Transition]float64{},
+	}
+	for i := 0; i < numStates; i++ {
+		h.States = append(h.States, i)
+	}
+	if s.TerminalState != nil {
+		h.States = append(h.States, s.TerminalState)
+	}
+	if s.Obs != nil {
+		emitter := TabularEmitter{}
+		for i := 0; i < numStates; i++ {
+			emitter[i] = map[Obs]float64{}
+			for _, obs := range s.Obs {
+				emitter[i][obs] = -math.Log(float64(len(s.Obs)))
+			}
+		}
+		h.Emitter = emitter
+	} else {
+		emitter := GaussianEmitter{}
+		for i := 0; i < numStates; i++ {
+			emitter[i] = &Gaussian{
+				Mean: make([]float64, s.Dim),
+				Var:  make([]float64, s.Dim),
+			}
+		}
+		h.Emitter = emitter
+	}
+	return h
+}
+
+// sampleBeta samples the global state distribution using
+// auxiliary table counts for the hidden paths.
+func (s *StickyHDPHMM) sampleBeta(beta []float64, stats *gibbsStats,
+	numStates int) []float64 {
+	alpha, gamma, kappa := s.concentrations()
+	rho := kappa / (alpha + kappa)
+
+	tables := make([]float64, numStates)
+	for k := 0; k < numStates; k++ {
+		tables[k] += float64(s.sampleTables(int(stats.Init[k]), alpha*beta[k]))
+	}
+	for j := 0; j < numStates; j++ {
+		for k := 0; k < numStates; k++ {
+			count := int(stats.Trans[j][k])
+			if j != k {
+				tables[k] += float64(s.sampleTables(count, alpha*beta[k]))
+				continue
+			}
+			numTables := s.sampleTables(count, alpha*beta[k]+kappa)
+
+			// Remove the tables which were created by the
+			// sticky self-transition mass.
+			overrideProb := rho / (rho + beta[j]*(1-rho))
+			for i := 0; i < numTables; i++ {
+				if s.float64() < overrideProb {
+					numTables--
+				}
+			}
+			tables[k] += float64(numTables)
+		}
+	}
+
+	conc := make([]float64, numStates)
+	for k := range conc {
+		conc[k] = gamma/float64(numStates) + tables[k]
+	}
+	logBeta := sampleLogDirichlet(s.Gen, conc)
+	res := make([]float64, numStates)
+	for k, logProb := range logBeta {
+		res[k] = math.Exp(logProb)
+	}
+	return res
+}
+
+// sampleTables samples the number of tables occupied by
+// count customers in a Chinese restaurant process with the
+// given concentration.
+func (s *StickyHDPHMM) sampleTables(count int, conc float64) int {
+	var res int
+	for i := 0; i < count; i++ {
+		if s.float64() < conc/(conc+float64(i)) {
+			res++
+		}
+	}
+	return res
+}
+
+// sampleParams samples the initial and transition
+// probabilities.
+func (s *StickyHDPHMM) sampleParams(h *HMM, beta []float64, stats *gibbsStats,
+	numStates int) *HMM {
+	alpha, _, kappa := s.concentrations()
+	res := *h
+	res.Init = map[State]float64{}
+	res.Transitions = map[Transition]float64{}
+
+	sampleRow := func(counts []float64, self int) []float64 {
+		conc := make([]float64, numStates)
+		for k := range conc {
+			conc[k] = alpha*beta[k] + counts[k]
+		}
+		if self >= 0 {
+			conc[self] += kappa
+		}
+		if h.TerminalState != nil {
+			conc = append(conc, 1+counts[numStates])
+		}
+		return sampleLogDirichlet(s.Gen, conc)
+	}
+
+	for k, prob := range sampleRow(stats.Init, -1) {
+		res.Init[h.States[k]] = prob
+	}
+	for j := 0; j < numStates; j++ {
+		for k, prob := range sampleRow(stats.Trans[j], j) {
+			res.Transitions[Transition{From: h.States[j], To: h.States[k]}] = prob
+		}
+	}
+	return &res
+}
+
+func (s *StickyHDPHMM) concentrations() (alpha, gamma, kappa float64) {
+	alpha, gamma, kappa = s.Alpha, s.Gamma, s.Kappa
+	if alpha == 0 {
+		alpha = 1
+	}
+	if gamma == 0 {
+		gamma = 1
+	}
+	return
+}
+
+func (s *StickyHDPHMM) emitPrior() float64 {
+	if s.EmitPrior == 0 {
+		return 1
+	}
+	return s.EmitPrior
+}
+
+func (s *StickyHDPHMM) float64() float64 {
+	if s.Gen != nil {
+		return s.Gen.Float64()
+	}
+	return rand.Float64()
+}
+
+func (s *StickyHDPHMM) intn(n int) int {
+	if s.Gen != nil {
+		return s.Gen.Intn(n)
+	}
+	return rand.Intn(n)
+}
+
+// removeUnusedStates creates a copy of h containing only
+// the terminal state and the int states in used.
+// The remaining states are renumbered, and the initial and
+// transition probabilities are renormalized.
+func removeUnusedStates(h *HMM, used map[State]int) *HMM {
+	mapping := map[State]State{}
+	res := &HMM{
+		TerminalState: h.TerminalState,
+		Init:          map[State]float64{},
+		Transitions:   map[Transition]float64{},
+	}
+	var numUsed int
+	for _, state := range h.States {
+		if state == h.TerminalState {
+			mapping[state] = state
+		} else if used[state] > 0 {
+			mapping[state] = numUsed
+			numUsed++
+		} else {
+			continue
+		}
+		res.States = append(res.States, mapping[state])
+	}
+
+	// The states are visited in order so that the sums,
+	// and thus the probabilities, are reproducible.
+	total := math.Inf(-1)
+	for _, state := range h.States {
+		prob, ok1 := h.Init[state]
+		newState, ok2 := mapping[state]
+		if ok1 && ok2 {
+			res.Init[newState] = prob
+			total = addLogs(total, prob)
+		}
+	}
+	for state := range res.Init {
+		res.Init[state] -= total
+	}
+
+	for _, oldFrom := range h.States {
+		from, ok := mapping[oldFrom]
+		if !ok {
+			continue
+		}
+		var row []Transition
+		total := math.Inf(-1)
+		for _, oldTo := range h.States {
+			prob, ok1 := h.Transitions[Transition{From: oldFrom, To: oldTo}]
+			to, ok2 := mapping[oldTo]
+			if ok1 && ok2 {
+				t := Transition{From: from, To: to}
+				res.Transitions[t] = prob
+				row = append(row, t)
+				total = addLogs(total, prob)
+			}
+		}
+		for _, t := range row {
+			res.Transitions[t] -= total
+		}
+	}
+
+	switch emitter := h.Emitter.(type) {
+	case TabularEmitter:
+		newEmitter := TabularEmitter{}
+		for state, row := range emitter {
+			if newState, ok := mapping[state]; ok {
+				newEmitter[newState] = row
+			}
+		}
+		res.Emitter = newEmitter
+	case GaussianEmitter:
+		newEmitter := GaussianEmitter{}
+		for state, dist := range emitter {
+			if newState, ok := mapping[state]; ok {
+				newEmitter[newState] = dist
+			}
+		}
+		res.Emitter = newEmitter
+	}
+	return res
+}
@@ -0,0 +1,136 @@
+package hmm
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestStickyHDPHMMGaussian(t *testing.T) {
+	gen := rand.New(rand.NewSource(1337))
+	target := &HMM{
+		States: []State{"A", "B", "C", "T"},
+		Emitter: GaussianEmitter{
+			"A": &Gaussian{Mean: []float64{-5}, Var: []float64{0.5}},
+			"B": &Gaussian{Mean: []float64{0}, Var: []float64{0.5}},
+			"C": &Gaussian{Mean: []float64{5}, Var: []float64{0.5}},
+		},
+		TerminalState: "T",
+		Init: map[State]float64{
+			"A": math.Log(0.5),
+			"B": math.Log(0.3),
+			"C": math.Log(0.2),
+		},
+		Transitions: map[Transition]float64{},
+	}
+	for _, from := range []State{"A", "B", "C"} {
+		for _, to := range []State{"A", "B", "C"} {
+			prob := 0.03
+			if from == to {
+				prob = 0.92
+			}
+			target.Transitions[Transition{From: from, To: to}] = math.Log(prob)
+		}
+		target.Transitions[Transition{From: from, To: "T"}] = math.Log(0.02)
+	}
+	var data [][]Obs
+	for i := 0; i < 20; i++ {
+		_, obs := target.Sample(gen)
+		data = append(data, obs)
+	}
+
+	hdp := &StickyHDPHMM{
+		MaxStates:     10,
+		Kappa:         10,
+		TerminalState: "end",
+		Dim:           1,
+		Iterations:    50,
+		Gen:           gen,
+	}
+	res := hdp.Run(data)
+	if len(res.LogLikelihoods) != 50 || len(res.NumStates) != 50 {
+		t.Fatalf("unexpected diagnostic lengths: %d, %d", len(res.LogLikelihoods),
+			len(res.NumStates))
+	}
+
+	numStates := len(res.HMM.States) - 1
+	if numStates < 3 || numStates > 5 {
+		t.Errorf("expected about 3 states but got %d", numStates)
+	}
+	if res.HMM.States[numStates] != "end" {
+		t.Errorf("unexpected states: %v", res.HMM.States)
+	}
+	for i := 0; i < numStates; i++ {
+		if res.HMM.States[i] != i {
+			t.Errorf("unexpected states: %v", res.HMM.States)
+		}
+	}
+
+	expected := totalLogLikelihood(target, data)
+	if actual := totalLogLikelihood(res.HMM, data); actual < expected-0.05*math.Abs(expected) {
+		t.Errorf("log-likelihood %f is much worse than %f", actual, expected)
+	}
+}
+
+func TestStickyHDPHMMTabular(t *testing.T) {
+	gen := rand.New(rand.NewSource(1337))
+	target := testingHMM()
+	var data [][]Obs
+	for i := 0; i < 100; i++ {
+		_, obs := target.Sample(gen)
+		data = append(data, obs)
+	}
+	hdp := &StickyHDPHMM{
+		MaxStates:     8,
+		TerminalState: "end",
+		Obs:           []Obs{"x", "y", "z"},
+		Iterations:    30,
+		Gen:           gen,
+	}
+	res := hdp.Run(data)
+	if len(res.HMM.States) > 9 {
+		t.Errorf("too many states: %v", res.HMM.States)
+	}
+
+	initTotal := math.Inf(-1)
+	for _, prob := range res.HMM.Init {
+		initTotal = addLogs(initTotal, prob)
+	}
+	if math.Abs(initTotal) > 1e-8 {
+		t.Errorf("initial distribution sums to %f", math.Exp(initTotal))
+	}
+
+	expected := totalLogLikelihood(target, data)
+	if actual := totalLogLikelihood(res.HMM, data); actual < expected*1.1 {
+		t.Errorf("log-likelihood %f is much worse than %f", actual, expected)
+	}
+}
+
+func TestStickyHDPHMMReproducible(t *testing.T) {
+	target := testingHMM()
+	run := func(parallelism int) *HDPResult {
+		gen := rand.New(rand.NewSource(42))
+		var data [][]Obs
+		for i := 0; i < 50; i++ {
+			_, obs := target.Sample(gen)
+			data = append(data, obs)
+		}
+		hdp := &StickyHDPHMM{
+			MaxStates:     5,
+			TerminalState: "end",
+			Obs:           []Obs{"x", "y", "z"},
+			Iterations:    10,
+			Parallelism:   parallelism,
+			Gen:           gen,
+		}
+		return hdp.Run(data)
+	}
+	res := run(1)
+	if !reflect.DeepEqual(res, run(1)) {
+		t.Error("results differ between runs with the same seed")
+	}
+	if !reflect.DeepEqual(res, run(3)) {
+		t.Error("results depend on Parallelism")
+	}
+}
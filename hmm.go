@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math"
 	"math/rand"
+	"sort"
 
 	"github.com/unixpickle/essentials"
 	"github.com/unixpickle/serializer"
@@ -14,6 +15,10 @@ func init() {
 	serializer.RegisterTypedDeserializer((&HMM{}).SerializerType(), DeserializeHMM)
 }
 
+// ErrSilentCycle is the panic value used when the silent
+// states of an HMM contain a cycle.
+var ErrSilentCycle = errors.New("cycle of silent states")
+
 // State is a discrete state in an HMM.
 // States must be comparable with the == operator.
 type State interface{}
@@ -39,6 +44,17 @@ type HMM struct {
 	// computed without accounting for termination.
 	TerminalState State
 
+	// SilentStates lists the states, other than the
+	// TerminalState, which do not produce an emission.
+	// When the model enters a silent state, it moves on to
+	// the next state without consuming an observation.
+	//
+	// Transitions between silent states must not form a
+	// cycle.
+	// Inference algorithms panic with ErrSilentCycle if
+	// they encounter such a cycle.
+	SilentStates []State
+
 	// Init stores the initial state distribution.
 	// It maps states to log probabilities.
 	// If a state is absent, it has 0 probability.
@@ -51,48 +67,69 @@ type HMM struct {
 }
 
 // DeserializeHMM deserializes an HMM.
+//
+// Data produced by older versions of Serialize can still
+// be read, while data from newer versions is rejected.
 func DeserializeHMM(d []byte) (h *HMM, err error) {
 	defer essentials.AddCtxTo("deserialize HMM", &err)
 
-	var terminalIdx int
+	version, body, err := readFormatHeader(d)
+	if err != nil {
+		return nil, err
+	} else if version == 0 {
+		return deserializeHMMV0(body)
+	}
+
 	var states []serializer.Serializer
-	var initStates []serializer.Serializer
+	var terminalIdx int
+	var silentIdxs []int
+	var initIdxs []int
 	var initProbs []float64
-	var transitionStates []serializer.Serializer
+	var transitionIdxs []int
 	var transitionProbs []float64
 	var emitter Emitter
-	err = serializer.DeserializeAny(d, &terminalIdx, &states, &initStates, &initProbs,
-		&transitionStates, &transitionProbs, &emitter)
+	err = serializer.DeserializeAny(body, &states, &terminalIdx, &silentIdxs, &initIdxs,
+		&initProbs, &transitionIdxs, &transitionProbs, &emitter)
 	if err != nil {
 		return nil, err
 	}
-	if len(transitionStates)%2 != 0 || len(transitionProbs) != len(transitionStates)/2 ||
-		len(initProbs) != len(initStates) || terminalIdx >= len(states) {
+	if len(transitionIdxs) != len(transitionProbs)*2 || len(initIdxs) != len(initProbs) ||
+		terminalIdx < -1 || terminalIdx >= len(states) {
 		return nil, errors.New("invalid slice size")
-	} else if !serializersComparable(states, initStates, transitionStates) {
-		return nil, errors.New("State or Obs not comparable")
+	} else if !serializersComparable(states) {
+		return nil, errors.New("State not comparable")
+	}
+	for _, idxs := range [][]int{silentIdxs, initIdxs, transitionIdxs} {
+		for _, idx := range idxs {
+			if idx < 0 || idx >= len(states) {
+				return nil, errors.New("state index out of bounds")
+			}
+		}
 	}
 	h = &HMM{
 		Emitter:     emitter,
 		Init:        map[State]float64{},
 		Transitions: map[Transition]float64{},
 	}
+	for _, state := range states {
+		h.States = append(h.States, fromSerializer(state))
+	}
 	if terminalIdx >= 0 {
-		h.TerminalState = states[terminalIdx]
+		h.TerminalState = h.States[terminalIdx]
 	}
-	for _, state := range states {
-		h.States = append(h.States, state)
+	for _, idx := range silentIdxs {
+		h.SilentStates = append(h.SilentStates, h.States[idx])
+	}
+	for i, idx := range initIdxs {
+		h.Init[h.States[idx]] = initProbs[i]
 	}
 	for i, prob := range transitionProbs {
 		t := Transition{
-			From: transitionStates[i*2],
-			To:   transitionStates[i*2+1],
+			From: h.States[transitionIdxs[i*2]],
+			To:   h.States[transitionIdxs[i*2+1]],
 		}
 		h.Transitions[t] = prob
 	}
-	for i, state := range initStates {
-		h.Init[state] = initProbs[i]
-	}
 	return h, nil
 }
 
@@ -136,14 +173,19 @@ func RandomHMM(gen *rand.Rand, states []State, terminal State, obs []Obs) *HMM {
 // Sample samples a sequence of observations and hidden
 // states from the model.
 //
+// The resulting state sequence includes any silent states
+// that were visited, so it may be longer than the
+// observation sequence.
+//
 // Sample requires that h.TerminalState is set.
 // Otherwise, the sequence would go on forever and no
 // sample would be complete.
 //
-// If gen is not nil, it may be used instead of the
-// global routines in package rand.
-// However, even gen is not nil, there is no guarantee
-// that it will be used consistently across runs.
+// If gen is not nil, it is used instead of the global
+// routines in package rand.
+// States are visited in a fixed order, so a generator with
+// the same seed produces the same sample, as long as the
+// Emitter samples reproducibly.
 func (h *HMM) Sample(gen *rand.Rand) ([]State, []Obs) {
 	if h.TerminalState == nil {
 		panic("cannot sample without a terminal state")
@@ -153,11 +195,15 @@ func (h *HMM) Sample(gen *rand.Rand) ([]State, []Obs) {
 	var obs []Obs
 
 	state := h.sampleStart(gen)
+	silent := silentSet(h)
+	es := newEmitSampler(h.Emitter)
 
 	var ts *transSampler
 	for state != h.TerminalState {
 		states = append(states, state)
-		obs = append(obs, h.Emitter.Sample(gen, state))
+		if !silent[state] {
+			obs = append(obs, es.Sample(gen, state))
+		}
 		if ts == nil {
 			ts = newTransSampler(h.States, h.Transitions)
 		}
@@ -167,8 +213,8 @@ func (h *HMM) Sample(gen *rand.Rand) ([]State, []Obs) {
 	return states, obs
 }
 
-// SampleLen is like Sample, but it limits the sampled
-// sequence length.
+// SampleLen is like Sample, but it limits the length of
+// the sampled observation sequence.
 // Unlike Sample, SampleLen can be used without a terminal
 // state.
 func (h *HMM) SampleLen(gen *rand.Rand, maxLen int) ([]State, []Obs) {
@@ -176,11 +222,15 @@ func (h *HMM) SampleLen(gen *rand.Rand, maxLen int) ([]State, []Obs) {
 	var obs []Obs
 
 	state := h.sampleStart(gen)
+	silent := silentSet(h)
+	es := newEmitSampler(h.Emitter)
 
 	var ts *transSampler
-	for i := 0; i < maxLen && state != h.TerminalState; i++ {
+	for len(obs) < maxLen && state != h.TerminalState {
 		states = append(states, state)
-		obs = append(obs, h.Emitter.Sample(gen, state))
+		if !silent[state] {
+			obs = append(obs, es.Sample(gen, state))
+		}
 		if ts == nil {
 			ts = newTransSampler(h.States, h.Transitions)
 		}
@@ -193,9 +243,11 @@ func (h *HMM) SampleLen(gen *rand.Rand, maxLen int) ([]State, []Obs) {
 func (h *HMM) sampleStart(gen *rand.Rand) State {
 	var states []State
 	var probs []float64
-	for state, logProb := range h.Init {
-		states = append(states, state)
-		probs = append(probs, math.Exp(logProb))
+	for _, state := range h.States {
+		if logProb, ok := h.Init[state]; ok {
+			states = append(states, state)
+			probs = append(probs, math.Exp(logProb))
+		}
 	}
 	return states[sampleIndex(gen, probs)]
 }
@@ -208,59 +260,187 @@ func (h *HMM) SerializerType() string {
 
 // Serialize serializes the HMM.
 //
-// This requires that the States and Emitter implement the
+// This requires that the Emitter implement the
 // serializer.Serializer interface.
+// The States must either implement serializer.Serializer
+// or be plain comparable values, such as strings, numbers,
+// bools, or types registered with RegisterType.
+//
+// The encoding is deterministic: serializing the same HMM
+// always produces the same bytes, as long as the Emitter
+// serializes deterministically.
+// It begins with a format version, which DeserializeHMM
+// uses to read data from older versions of this package.
 func (h *HMM) Serialize() (data []byte, err error) {
 	defer essentials.AddCtxTo("serialize HMM", &err)
-	terminalIdx := -1
 	var states []serializer.Serializer
-	var initStates []serializer.Serializer
-	var initProbs []float64
-	var transitionStates []serializer.Serializer
-	var transitionProbs []float64
-	for i, state := range h.States {
-		stateSer, ok := state.(serializer.Serializer)
-		if !ok {
-			return nil, fmt.Errorf("not a Serializer: %T", state)
+	for _, state := range h.States {
+		stateSer, err := toSerializer(state)
+		if err != nil {
+			return nil, err
 		}
 		states = append(states, stateSer)
-		if state == h.TerminalState {
-			terminalIdx = i
+	}
+
+	s2i := statesToIndices(h)
+	stateIndex := func(state State) (int, error) {
+		if idx, ok := s2i[state]; ok {
+			return idx, nil
 		}
+		return 0, fmt.Errorf("unknown state: %v", state)
 	}
-	for state, prob := range h.Init {
-		initStates = append(initStates, state.(serializer.Serializer))
-		initProbs = append(initProbs, prob)
+
+	terminalIdx := -1
+	if idx, ok := s2i[h.TerminalState]; ok {
+		terminalIdx = idx
 	}
+	var silentIdxs []int
+	for _, state := range h.SilentStates {
+		idx, err := stateIndex(state)
+		if err != nil {
+			return nil, err
+		}
+		silentIdxs = append(silentIdxs, idx)
+	}
+
+	var initIdxs []int
+	for state := range h.Init {
+		idx, err := stateIndex(state)
+		if err != nil {
+			return nil, err
+		}
+		initIdxs = append(initIdxs, idx)
+	}
+	sort.Ints(initIdxs)
+	initProbs := make([]float64, len(initIdxs))
+	for i, idx := range initIdxs {
+		initProbs[i] = h.Init[h.States[idx]]
+	}
+
+	var transitions []fastTransition
 	for trans, prob := range h.Transitions {
-		transitionStates = append(transitionStates, trans.From.(serializer.Serializer),
-			trans.To.(serializer.Serializer))
-		transitionProbs = append(transitionProbs, prob)
+		from, err := stateIndex(trans.From)
+		if err != nil {
+			return nil, err
+		}
+		to, err := stateIndex(trans.To)
+		if err != nil {
+			return nil, err
+		}
+		transitions = append(transitions, fastTransition{From: from, To: to, Prob: prob})
+	}
+	sort.Slice(transitions, func(i, j int) bool {
+		t1, t2 := transitions[i], transitions[j]
+		return t1.From < t2.From || (t1.From == t2.From && t1.To < t2.To)
+	})
+	var transitionIdxs []int
+	var transitionProbs []float64
+	for _, t := range transitions {
+		transitionIdxs = append(transitionIdxs, t.From, t.To)
+		transitionProbs = append(transitionProbs, t.Prob)
+	}
+
+	body, err := serializer.SerializeAny(states, terminalIdx, silentIdxs, initIdxs,
+		initProbs, transitionIdxs, transitionProbs, h.Emitter)
+	if err != nil {
+		return nil, err
+	}
+	return append(writeFormatHeader(hmmFormatVersion), body...), nil
+}
+
+// MarshalBinary encodes the HMM using Serialize, so that
+// it can be used with encoding/gob.
+func (h *HMM) MarshalBinary() ([]byte, error) {
+	return h.Serialize()
+}
+
+// UnmarshalBinary decodes an HMM encoded with
+// MarshalBinary.
+func (h *HMM) UnmarshalBinary(data []byte) error {
+	res, err := DeserializeHMM(data)
+	if err != nil {
+		return err
 	}
-	return serializer.SerializeAny(terminalIdx, states, initStates, initProbs,
-		transitionStates, transitionProbs, h.Emitter)
+	*h = *res
+	return nil
 }
 
+// transSampler samples transitions, visiting the targets
+// of each state in the order of the model's states so that
+// sampling is reproducible.
+//
+// The targets of a state are found the first time that
+// state is sampled from.
 type transSampler struct {
+	States      []State
+	Transitions map[Transition]float64
+
 	Targets map[State][]State
 	Probs   map[State][]float64
 }
 
 func newTransSampler(states []State, trans map[Transition]float64) *transSampler {
-	res := &transSampler{
-		Targets: map[State][]State{},
-		Probs:   map[State][]float64{},
+	return &transSampler{
+		States:      states,
+		Transitions: trans,
+		Targets:     map[State][]State{},
+		Probs:       map[State][]float64{},
 	}
-	for tr, logProb := range trans {
-		res.Targets[tr.From] = append(res.Targets[tr.From], tr.To)
-		res.Probs[tr.From] = append(res.Probs[tr.From], math.Exp(logProb))
-	}
-	return res
 }
 
 func (t *transSampler) Sample(gen *rand.Rand, from State) State {
-	if len(t.Targets[from]) == 0 {
+	targets, ok := t.Targets[from]
+	if !ok {
+		for _, to := range t.States {
+			if logProb, ok := t.Transitions[Transition{From: from, To: to}]; ok {
+				targets = append(targets, to)
+				t.Probs[from] = append(t.Probs[from], math.Exp(logProb))
+			}
+		}
+		t.Targets[from] = targets
+	}
+	if len(targets) == 0 {
 		panic(fmt.Sprintf("no transitions from %v", from))
 	}
-	return t.Targets[from][sampleIndex(gen, t.Probs[from])]
+	return targets[sampleIndex(gen, t.Probs[from])]
+}
+
+// emitSampler samples observations from an Emitter.
+// For a TabularEmitter, each row is sorted once, the first
+// time it is used, so that sampling is reproducible.
+type emitSampler struct {
+	Emitter Emitter
+
+	Obs   map[State][]Obs
+	Probs map[State][]float64
+}
+
+func newEmitSampler(e Emitter) *emitSampler {
+	return &emitSampler{
+		Emitter: e,
+		Obs:     map[State][]Obs{},
+		Probs:   map[State][]float64{},
+	}
+}
+
+func (e *emitSampler) Sample(gen *rand.Rand, state State) Obs {
+	tabular, ok := e.Emitter.(TabularEmitter)
+	if !ok {
+		return e.Emitter.Sample(gen, state)
+	}
+	obses, ok := e.Obs[state]
+	if !ok {
+		row := tabular[state]
+		if len(row) == 0 {
+			panic("no entries for the given state")
+		}
+		obses = sortedObs(row)
+		probs := make([]float64, len(obses))
+		for i, obs := range obses {
+			probs[i] = math.Exp(row[obs])
+		}
+		e.Obs[state] = obses
+		e.Probs[state] = probs
+	}
+	return obses[sampleIndex(gen, e.Probs[state])]
 }
@@ -0,0 +1,306 @@
+package hmm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/unixpickle/essentials"
+)
+
+// An HMMERModel is a profile HMM read from a HMMER3 file.
+type HMMERModel struct {
+	Name        string
+	Accession   string
+	Description string
+
+	// Alphabet lists the residues, as single-character
+	// strings, in the order used by the file.
+	Alphabet []Obs
+
+	// Length is the number of match states.
+	Length int
+
+	// Background stores the log probability of each
+	// residue under the background (null) model.
+	//
+	// HMMER3 files do not store the background explicitly,
+	// so this is taken from the insert emissions of node 0,
+	// which HMMER sets to the background frequencies.
+	Background map[Obs]float64
+
+	// HMM is the core profile model.
+	//
+	// Its states are strings: "M1" through "Mk" for match
+	// states, "I0" through "Ik" for insert states, "D1"
+	// through "Dk" for (silent) delete states, and "E" for
+	// the TerminalState, where k is the Length.
+	// The initial probabilities come from the begin state,
+	// which is node 0 in the file.
+	//
+	// Observations are residues from Alphabet, and the
+	// Emitter is a TabularEmitter.
+	HMM *HMM
+}
+
+// ReadHMMER reads every profile in a HMMER3 text file,
+// such as a Pfam HMM library.
+//
+// Only the core model is built, so sequences are scored
+// globally against the whole profile.
+// The flanking states that HMMER uses for local alignment
+// are not included.
+func ReadHMMER(r io.Reader) (models []*HMMERModel, err error) {
+	defer essentials.AddCtxTo("read HMMER", &err)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	p := &hmmerParser{Scanner: scanner}
+	for {
+		model, err := p.ParseModel()
+		if err != nil {
+			return nil, essentials.AddCtx(fmt.Sprintf("line %d", p.LineNum), err)
+		} else if model == nil {
+			return models, nil
+		}
+		models = append(models, model)
+	}
+}
+
+type hmmerParser struct {
+	Scanner *bufio.Scanner
+	LineNum int
+}
+
+// NextLine reads the next non-empty line.
+// It returns false at the end of the file.
+func (h *hmmerParser) NextLine() (string, bool, error) {
+	for h.Scanner.Scan() {
+		h.LineNum++
+		if line := h.Scanner.Text(); strings.TrimSpace(line) != "" {
+			return line, true, nil
+		}
+	}
+	return "", false, h.Scanner.Err()
+}
+
+// ParseModel parses the next model, returning nil if
+// there are no more models.
+func (h *hmmerParser) ParseModel() (*HMMERModel, error) {
+	line, ok, err := h.NextLine()
+	if err != nil || !ok {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "HMMER3") {
+		return nil, errors.New("expected HMMER3 header")
+	}
+
+	res := &HMMERModel{}
+	for {
+		line, ok, err := h.NextLine()
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, io.ErrUnexpectedEOF
+		}
+		fields := strings.Fields(line)
+		value := strings.TrimSpace(strings.TrimPrefix(line, fields[0]))
+		switch fields[0] {
+		case "NAME":
+			res.Name = value
+		case "ACC":
+			res.Accession = value
+		case "DESC":
+			res.Description = value
+		case "LENG":
+			res.Length, err = strconv.Atoi(value)
+			if err != nil || res.Length < 1 {
+				return nil, fmt.Errorf("invalid length: %s", value)
+			}
+		}
+		if fields[0] == "HMM" {
+			for _, residue := range fields[1:] {
+				res.Alphabet = append(res.Alphabet, residue)
+			}
+			break
+		}
+	}
+	if res.Length == 0 {
+		return nil, errors.New("missing LENG")
+	} else if len(res.Alphabet) == 0 {
+		return nil, errors.New("empty alphabet")
+	}
+
+	// Skip the transition header.
+	if _, ok, err := h.NextLine(); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	builder := newHMMERBuilder(res.Length)
+	insertLine, err := h.Fields()
+	if err != nil {
+		return nil, err
+	}
+	if insertLine[0] == "COMPO" {
+		if insertLine, err = h.Fields(); err != nil {
+			return nil, err
+		}
+	}
+	for node := 0; node <= res.Length; node++ {
+		if node > 0 {
+			matchLine, err := h.Fields()
+			if err != nil {
+				return nil, err
+			} else if len(matchLine) < len(res.Alphabet)+1 || matchLine[0] != strconv.Itoa(node) {
+				return nil, fmt.Errorf("invalid match emissions for node %d", node)
+			}
+			if err := builder.AddEmissions("M", node, res.Alphabet, matchLine[1:]); err != nil {
+				return nil, err
+			}
+			if insertLine, err = h.Fields(); err != nil {
+				return nil, err
+			}
+		}
+		if err := builder.AddEmissions("I", node, res.Alphabet, insertLine); err != nil {
+			return nil, err
+		}
+		transLine, err := h.Fields()
+		if err != nil {
+			return nil, err
+		}
+		if err := builder.AddTransitions(node, transLine); err != nil {
+			return nil, err
+		}
+	}
+	if line, ok, err := h.NextLine(); err != nil {
+		return nil, err
+	} else if !ok || strings.TrimSpace(line) != "//" {
+		return nil, errors.New("expected end of model")
+	}
+
+	res.HMM = builder.HMM
+	res.Background = builder.HMM.Emitter.(TabularEmitter)["I0"]
+	return res, nil
+}
+
+// Fields reads the fields of the next line, failing at the
+// end of the file.
+func (h *hmmerParser) Fields() ([]string, error) {
+	line, ok, err := h.NextLine()
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return strings.Fields(line), nil
+}
+
+type hmmerBuilder struct {
+	Length int
+	HMM    *HMM
+}
+
+func newHMMERBuilder(length int) *hmmerBuilder {
+	h := &HMM{
+		Emitter:       TabularEmitter{},
+		TerminalState: "E",
+		Init:          map[State]float64{},
+		Transitions:   map[Transition]float64{},
+	}
+	for node := 0; node <= length; node++ {
+		if node > 0 {
+			h.States = append(h.States, hmmerState("M", node), hmmerState("D", node))
+			h.SilentStates = append(h.SilentStates, hmmerState("D", node))
+		}
+		h.States = append(h.States, hmmerState("I", node))
+	}
+	h.States = append(h.States, h.TerminalState)
+	return &hmmerBuilder{Length: length, HMM: h}
+}
+
+// AddEmissions adds a state's emission scores.
+func (h *hmmerBuilder) AddEmissions(kind string, node int, alphabet []Obs,
+	fields []string) error {
+	if len(fields) < len(alphabet) {
+		return fmt.Errorf("missing emissions for node %d", node)
+	}
+	dist := map[Obs]float64{}
+	for i, residue := range alphabet {
+		prob, err := parseHMMERScore(fields[i])
+		if err != nil {
+			return err
+		}
+		if !math.IsInf(prob, -1) {
+			dist[residue] = prob
+		}
+	}
+	h.HMM.Emitter.(TabularEmitter)[hmmerState(kind, node)] = dist
+	return nil
+}
+
+// AddTransitions adds a node's transition scores, in the
+// order m->m, m->i, m->d, i->m, i->i, d->m, d->d.
+func (h *hmmerBuilder) AddTransitions(node int, fields []string) error {
+	if len(fields) != 7 {
+		return fmt.Errorf("expected 7 transitions for node %d", node)
+	}
+	next := func(kind string) State {
+		if node == h.Length {
+			return h.HMM.TerminalState
+		}
+		return hmmerState(kind, node+1)
+	}
+	targets := [7]Transition{
+		{From: hmmerState("M", node), To: next("M")},
+		{From: hmmerState("M", node), To: hmmerState("I", node)},
+		{From: hmmerState("M", node), To: next("D")},
+		{From: hmmerState("I", node), To: next("M")},
+		{From: hmmerState("I", node), To: hmmerState("I", node)},
+		{From: hmmerState("D", node), To: next("M")},
+		{From: hmmerState("D", node), To: next("D")},
+	}
+	for i, field := range fields {
+		prob, err := parseHMMERScore(field)
+		if err != nil {
+			return err
+		} else if math.IsInf(prob, -1) {
+			continue
+		}
+		trans := targets[i]
+		if node == 0 && i >= 5 {
+			// There is no delete state in node 0.
+			continue
+		} else if node == h.Length && (i == 2 || i == 6) {
+			return fmt.Errorf("transition to nonexistent delete state in node %d", node)
+		}
+		if trans.From == "M0" {
+			// Node 0's match state is the begin state.
+			h.HMM.Init[trans.To] = prob
+		} else {
+			h.HMM.Transitions[trans] = prob
+		}
+	}
+	return nil
+}
+
+func hmmerState(kind string, node int) State {
+	return kind + strconv.Itoa(node)
+}
+
+// parseHMMERScore parses a negative natural log
+// probability, where "*" indicates a probability of 0.
+func parseHMMERScore(field string) (float64, error) {
+	if field == "*" {
+		return math.Inf(-1), nil
+	}
+	score, err := strconv.ParseFloat(field, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid score: %s", field)
+	}
+	return -score, nil
+}
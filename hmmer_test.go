@@ -0,0 +1,138 @@
+package hmm
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestReadHMMER(t *testing.T) {
+	models, err := ReadHMMER(strings.NewReader(hmmerTestingFile()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(models) != 2 {
+		t.Fatalf("expected 2 models but got %d", len(models))
+	}
+	model := models[0]
+	if model.Name != "test" || model.Accession != "PF00000.1" ||
+		model.Description != "A test profile" || model.Length != 2 {
+		t.Errorf("unexpected metadata: %+v", model)
+	}
+	if models[1].Name != "second" {
+		t.Errorf("unexpected second model: %s", models[1].Name)
+	}
+	if fmt.Sprint(model.Alphabet) != "[A C G T]" {
+		t.Errorf("unexpected alphabet: %v", model.Alphabet)
+	}
+	if math.Abs(model.Background["G"]-math.Log(0.25)) > 1e-4 {
+		t.Errorf("unexpected background: %v", model.Background)
+	}
+
+	h := model.HMM
+	expectedStates := []State{"I0", "M1", "D1", "I1", "M2", "D2", "I2", "E"}
+	if !stateSeqsEqual(h.States, expectedStates) {
+		t.Errorf("expected states %v but got %v", expectedStates, h.States)
+	}
+	if !stateSeqsEqual(h.SilentStates, []State{"D1", "D2"}) {
+		t.Errorf("unexpected silent states: %v", h.SilentStates)
+	}
+	if _, ok := h.Emitter.(TabularEmitter)["M1"]["T"]; ok {
+		t.Error("zero-probability emission should be absent")
+	}
+
+	// Sum over the paths which emit a single residue.
+	probs := map[string]float64{}
+	emit := func(state State, residue string) float64 {
+		return math.Exp(h.Emitter.LogProbs(residue, state)[0])
+	}
+	trans := func(from, to State) float64 {
+		return math.Exp(h.Transitions[Transition{From: from, To: to}])
+	}
+	init := func(state State) float64 {
+		return math.Exp(h.Init[state])
+	}
+	for _, residue := range []string{"A", "C", "G", "T"} {
+		probs[residue] = init("M1")*emit("M1", residue)*trans("M1", "D2")*trans("D2", "E") +
+			init("D1")*trans("D1", "M2")*emit("M2", residue)*trans("M2", "E")
+		actual := LogLikelihood(h, []Obs{residue})
+		if math.Abs(actual-math.Log(probs[residue])) > 1e-4 {
+			t.Errorf("residue %s: expected %f but got %f", residue, math.Log(probs[residue]),
+				actual)
+		}
+	}
+
+	path := MostLikely(h, []Obs{"A", "C"})
+	if !stateSeqsEqual(path, []State{"M1", "M2"}) {
+		t.Errorf("unexpected most likely path: %v", path)
+	}
+}
+
+func TestReadHMMERErrors(t *testing.T) {
+	valid := hmmerTestingFile()
+	invalid := map[string][2]string{
+		"bad header":     {"HMMER3/f", "HMMER2.0"},
+		"missing LENG":   {"LENG  2\n", ""},
+		"bad node index": {"\n      2 ", "\n      3 "},
+		"bad score":      {"1.38629", "x.38629"},
+		"too few":        {" 0.00000        *\n      1", "\n      1"},
+		"missing end":    {"//\nHMMER3/f", "HMMER3/f"},
+		"terminal delete": {"0.00000        *        *  0.00000",
+			"0.00000        *  0.00000  0.00000"},
+		"unexpected EOF":   {valid[strings.LastIndex(valid, "      2 "):], ""},
+		"empty alphabet":   {"A        C        G        T\n", "\n"},
+		"missing emission": {" 1.38629  1.38629\n", " 1.38629\n"},
+	}
+	for name, replacement := range invalid {
+		data := strings.Replace(valid, replacement[0], replacement[1], 1)
+		if data == valid {
+			t.Fatalf("%s: replacement not found", name)
+		}
+		if _, err := ReadHMMER(strings.NewReader(data)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func hmmerTestingFile() string {
+	score := func(probs ...float64) string {
+		var parts []string
+		for _, p := range probs {
+			if p == 0 {
+				parts = append(parts, fmt.Sprintf("%8s", "*"))
+			} else {
+				parts = append(parts, fmt.Sprintf("%8.5f", 0-math.Log(p)))
+			}
+		}
+		return strings.Join(parts, " ")
+	}
+	model := func(name string) string {
+		return `HMMER3/f [3.1b2 | February 2015]
+NAME  ` + name + `
+ACC   PF00000.1
+DESC  A test profile
+LENG  2
+ALPH  DNA
+RF    no
+MM    no
+CONS  yes
+CS    no
+MAP   yes
+STATS LOCAL MSV      -9.4043  0.71847
+HMM          A        C        G        T
+            m->m     m->i     m->d     i->m     i->i     d->m     d->d
+  COMPO   ` + score(0.4, 0.3, 0.2, 0.1) + `
+          ` + score(0.25, 0.25, 0.25, 0.25) + `
+          ` + score(0.7, 0.1, 0.2, 0.6, 0.4, 1, 0) + `
+      1   ` + score(0.6, 0.3, 0.1, 0) + `      1 a - -
+          ` + score(0.25, 0.25, 0.25, 0.25) + `
+          ` + score(0.8, 0.1, 0.1, 0.9, 0.1, 0.5, 0.5) + `
+      2   ` + score(0.1, 0.7, 0.1, 0.1) + `      2 c - -
+          ` + score(0.25, 0.25, 0.25, 0.25) + `
+          ` + score(1, 0, 0, 1, 0, 1, 0) + `
+//
+`
+	}
+	return model("test") + model("second")
+}
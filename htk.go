@@ -0,0 +1,687 @@
+package hmm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/unixpickle/essentials"
+)
+
+// ReadHTK reads the HMM definitions (~h macros) from an
+// HTK master macro file (MMF) in text format, returning
+// the HMMs by name.
+//
+// An HTK model with N states becomes an HMM with int
+// states 2 through N, matching HTK's state numbers.
+// HTK's non-emitting entry state 1 is not included, and
+// its transitions become the Init probabilities.
+// The non-emitting exit state N becomes the TerminalState,
+// unless no state can move to it, in which case it is left
+// out and the HMM has no TerminalState.
+//
+// The Emitter is a GaussianEmitter if every state has a
+// single mixture component, or a MixtureEmitter
+// otherwise.
+//
+// Global options (~o) and shared ~s, ~t, ~m, ~u, and ~v
+// macros are supported.
+// Only single-stream models with diagonal covariances are
+// supported.
+func ReadHTK(r io.Reader) (models map[string]*HMM, err error) {
+	defer essentials.AddCtxTo("read HTK", &err)
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := tokenizeHTK(string(data))
+	if err != nil {
+		return nil, err
+	}
+	p := &htkParser{
+		Tokens:  tokens,
+		States:  map[string]*GaussianMixture{},
+		TransPs: map[string][][]float64{},
+		MixPDFs: map[string]*Gaussian{},
+		Means:   map[string][]float64{},
+		Vars:    map[string][]float64{},
+	}
+	models = map[string]*HMM{}
+	for !p.Done() {
+		macro := p.Next()
+		if macro.Kind != htkMacro {
+			return nil, fmt.Errorf("expected macro but got %q", macro.Text)
+		}
+		if macro.Text == "~o" {
+			if err := p.ParseOptions(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		name, err := p.Name()
+		if err != nil {
+			return nil, err
+		}
+		switch macro.Text {
+		case "~h":
+			if _, ok := models[name]; ok {
+				return nil, fmt.Errorf("duplicate HMM: %s", name)
+			}
+			models[name], err = p.ParseHMM()
+		case "~s":
+			p.States[name], err = p.ParseStateInfo()
+		case "~t":
+			p.TransPs[name], err = p.ParseTransP()
+		case "~m":
+			p.MixPDFs[name], err = p.ParseMixPDF()
+		case "~u":
+			p.Means[name], err = p.ParseVector("<MEAN>")
+		case "~v":
+			p.Vars[name], err = p.ParseVector("<VARIANCE>")
+		default:
+			return nil, fmt.Errorf("unsupported macro: %s", macro.Text)
+		}
+		if err != nil {
+			return nil, essentials.AddCtx(name, err)
+		}
+	}
+	return models, nil
+}
+
+// WriteHTK writes HMMs as ~h macros in an HTK master
+// macro file, preceded by the global options.
+// The models are written in order of their names.
+//
+// This is the inverse of ReadHTK.
+// Every HMM must have a GaussianEmitter or MixtureEmitter,
+// and all the Gaussians must have the same dimension.
+// The non-terminal states are written in the order of
+// h.States, and HTK's exit state is the TerminalState.
+// If an HMM has no TerminalState, then the exit state is
+// unreachable, so ReadHTK reads it back without one.
+// Silent states other than the TerminalState are not
+// supported.
+func WriteHTK(w io.Writer, models map[string]*HMM) (err error) {
+	defer essentials.AddCtxTo("write HTK", &err)
+
+	var names []string
+	for name := range models {
+		if strings.ContainsAny(name, "\"\n") {
+			return fmt.Errorf("invalid model name: %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	mixtures := map[string]MixtureEmitter{}
+	vecSize := -1
+	for _, name := range names {
+		emitter, err := htkMixtures(models[name].Emitter)
+		if err != nil {
+			return essentials.AddCtx(name, err)
+		}
+		for _, mixture := range emitter {
+			for _, comp := range mixture.Components {
+				if vecSize == -1 {
+					vecSize = len(comp.Mean)
+				} else if len(comp.Mean) != vecSize || len(comp.Var) != vecSize {
+					return essentials.AddCtx(name, errors.New("mismatching dimensions"))
+				}
+			}
+		}
+		mixtures[name] = emitter
+	}
+	if vecSize == -1 {
+		return errors.New("no Gaussians to determine vector size")
+	}
+
+	buf := bufio.NewWriter(w)
+	fmt.Fprintf(buf, "~o\n<STREAMINFO> 1 %d\n<VECSIZE> %d<NULLD><USER><DIAGC>\n", vecSize,
+		vecSize)
+	for _, name := range names {
+		if err := writeHTKModel(buf, name, models[name], mixtures[name]); err != nil {
+			return essentials.AddCtx(name, err)
+		}
+	}
+	return buf.Flush()
+}
+
+func writeHTKModel(w io.Writer, name string, h *HMM, mixtures MixtureEmitter) error {
+	silent := silentSet(h)
+	var emitting []State
+	for _, state := range h.States {
+		if state == h.TerminalState {
+			continue
+		} else if silent[state] {
+			return fmt.Errorf("unsupported silent state: %v", state)
+		}
+		emitting = append(emitting, state)
+	}
+	numStates := len(emitting) + 2
+	indices := map[State]int{}
+	for i, state := range emitting {
+		indices[state] = i + 1
+	}
+	if h.TerminalState != nil {
+		indices[h.TerminalState] = numStates - 1
+	}
+
+	transP := newMatrix(numStates, numStates)
+	for state, prob := range h.Init {
+		idx, ok := indices[state]
+		if !ok {
+			return fmt.Errorf("unknown state: %v", state)
+		}
+		transP[0][idx] = math.Exp(prob)
+	}
+	for trans, prob := range h.Transitions {
+		from, ok1 := indices[trans.From]
+		to, ok2 := indices[trans.To]
+		if !ok1 || !ok2 {
+			return fmt.Errorf("unknown state in transition: %v", trans)
+		} else if from == numStates-1 {
+			return errors.New("transition out of terminal state")
+		}
+		transP[from][to] = math.Exp(prob)
+	}
+
+	fmt.Fprintf(w, "~h \"%s\"\n<BEGINHMM>\n<NUMSTATES> %d\n", name, numStates)
+	for i, state := range emitting {
+		mixture, ok := mixtures[state]
+		if !ok {
+			return fmt.Errorf("no emission distribution for state: %v", state)
+		}
+		fmt.Fprintf(w, "<STATE> %d\n", i+2)
+		if len(mixture.Components) != 1 {
+			fmt.Fprintf(w, "<NUMMIXES> %d\n", len(mixture.Components))
+		}
+		for j, comp := range mixture.Components {
+			if len(mixture.Components) != 1 {
+				fmt.Fprintf(w, "<MIXTURE> %d %s\n", j+1,
+					htkFloat(math.Exp(mixture.LogWeights[j])))
+			}
+			fmt.Fprintf(w, "<MEAN> %d\n%s\n", len(comp.Mean), htkFloats(comp.Mean))
+			fmt.Fprintf(w, "<VARIANCE> %d\n%s\n", len(comp.Var), htkFloats(comp.Var))
+			gConst := float64(len(comp.Var)) * math.Log(2*math.Pi)
+			for _, v := range comp.Var {
+				gConst += math.Log(v)
+			}
+			fmt.Fprintf(w, "<GCONST> %s\n", htkFloat(gConst))
+		}
+	}
+	fmt.Fprintf(w, "<TRANSP> %d\n", numStates)
+	for _, row := range transP {
+		fmt.Fprintln(w, htkFloats(row))
+	}
+	_, err := fmt.Fprintln(w, "<ENDHMM>")
+	return err
+}
+
+// htkMixtures converts a supported Emitter into a
+// MixtureEmitter.
+func htkMixtures(e Emitter) (MixtureEmitter, error) {
+	switch e := e.(type) {
+	case MixtureEmitter:
+		for _, mixture := range e {
+			if len(mixture.LogWeights) != len(mixture.Components) {
+				return nil, errors.New("mismatching weights and components")
+			}
+		}
+		return e, nil
+	case GaussianEmitter:
+		res := MixtureEmitter{}
+		for state, dist := range e {
+			res[state] = &GaussianMixture{
+				LogWeights: []float64{0},
+				Components: []*Gaussian{dist},
+			}
+		}
+		return res, nil
+	default:
+		return nil, fmt.Errorf("unsupported emitter: %T", e)
+	}
+}
+
+func htkFloat(x float64) string {
+	return strconv.FormatFloat(x, 'e', -1, 64)
+}
+
+func htkFloats(xs []float64) string {
+	var parts []string
+	for _, x := range xs {
+		parts = append(parts, htkFloat(x))
+	}
+	return " " + strings.Join(parts, " ")
+}
+
+type htkTokenKind int
+
+const (
+	htkKeyword htkTokenKind = iota
+	htkMacro
+	htkString
+	htkWord
+)
+
+type htkToken struct {
+	Kind htkTokenKind
+	Text string
+}
+
+// tokenizeHTK splits an MMF into tokens.
+// Keywords are converted to upper case, since HTK treats
+// them case-insensitively.
+func tokenizeHTK(data string) ([]htkToken, error) {
+	var res []htkToken
+	for {
+		data = strings.TrimLeft(data, " \t\r\n")
+		if data == "" {
+			return res, nil
+		}
+		switch data[0] {
+		case '<':
+			end := strings.IndexByte(data, '>')
+			if end == -1 {
+				return nil, errors.New("unterminated keyword")
+			}
+			res = append(res, htkToken{Kind: htkKeyword, Text: strings.ToUpper(data[:end+1])})
+			data = data[end+1:]
+		case '"':
+			end := strings.IndexByte(data[1:], '"')
+			if end == -1 {
+				return nil, errors.New("unterminated string")
+			}
+			res = append(res, htkToken{Kind: htkString, Text: data[1 : end+1]})
+			data = data[end+2:]
+		case '~':
+			if len(data) < 2 {
+				return nil, errors.New("incomplete macro")
+			}
+			res = append(res, htkToken{Kind: htkMacro, Text: strings.ToLower(data[:2])})
+			data = data[2:]
+		default:
+			end := strings.IndexAny(data, " \t\r\n<\"")
+			if end == -1 {
+				end = len(data)
+			}
+			res = append(res, htkToken{Kind: htkWord, Text: data[:end]})
+			data = data[end:]
+		}
+	}
+}
+
+type htkParser struct {
+	Tokens []htkToken
+
+	VecSize int
+
+	States  map[string]*GaussianMixture
+	TransPs map[string][][]float64
+	MixPDFs map[string]*Gaussian
+	Means   map[string][]float64
+	Vars    map[string][]float64
+}
+
+func (p *htkParser) Done() bool {
+	return len(p.Tokens) == 0
+}
+
+func (p *htkParser) Peek() htkToken {
+	if p.Done() {
+		return htkToken{Kind: htkKeyword, Text: "<EOF>"}
+	}
+	return p.Tokens[0]
+}
+
+func (p *htkParser) Next() htkToken {
+	res := p.Peek()
+	if !p.Done() {
+		p.Tokens = p.Tokens[1:]
+	}
+	return res
+}
+
+// PeekIs checks if the next token is the given keyword
+// or macro.
+func (p *htkParser) PeekIs(text string) bool {
+	tok := p.Peek()
+	return (tok.Kind == htkKeyword || tok.Kind == htkMacro) && tok.Text == text
+}
+
+func (p *htkParser) Expect(keyword string) error {
+	if tok := p.Next(); tok.Kind != htkKeyword || tok.Text != keyword {
+		return fmt.Errorf("expected %s but got %q", keyword, tok.Text)
+	}
+	return nil
+}
+
+func (p *htkParser) Name() (string, error) {
+	tok := p.Next()
+	if tok.Kind != htkString && tok.Kind != htkWord {
+		return "", fmt.Errorf("expected macro name but got %q", tok.Text)
+	}
+	return tok.Text, nil
+}
+
+func (p *htkParser) Int() (int, error) {
+	tok := p.Next()
+	if tok.Kind == htkWord {
+		if res, err := strconv.Atoi(tok.Text); err == nil {
+			return res, nil
+		}
+	}
+	return 0, fmt.Errorf("expected integer but got %q", tok.Text)
+}
+
+func (p *htkParser) Float() (float64, error) {
+	tok := p.Next()
+	if tok.Kind == htkWord {
+		if res, err := strconv.ParseFloat(tok.Text, 64); err == nil {
+			return res, nil
+		}
+	}
+	return 0, fmt.Errorf("expected number but got %q", tok.Text)
+}
+
+// ParseOptions parses global options, either in a ~o
+// macro or at the start of an HMM definition.
+func (p *htkParser) ParseOptions() error {
+	for !p.Done() && p.Peek().Kind == htkKeyword && !p.PeekIs("<NUMSTATES>") {
+		switch p.Next().Text {
+		case "<STREAMINFO>":
+			numStreams, err := p.Int()
+			if err != nil {
+				return err
+			} else if numStreams != 1 {
+				return errors.New("multiple streams are not supported")
+			}
+			if _, err := p.Int(); err != nil {
+				return err
+			}
+		case "<VECSIZE>":
+			size, err := p.Int()
+			if err != nil {
+				return err
+			}
+			p.VecSize = size
+		case "<FULLC>", "<LLTC>", "<XFORMC>":
+			return errors.New("only diagonal covariances are supported")
+		}
+	}
+	return nil
+}
+
+func (p *htkParser) ParseHMM() (*HMM, error) {
+	if err := p.Expect("<BEGINHMM>"); err != nil {
+		return nil, err
+	}
+	if err := p.ParseOptions(); err != nil {
+		return nil, err
+	}
+	if err := p.Expect("<NUMSTATES>"); err != nil {
+		return nil, err
+	}
+	numStates, err := p.Int()
+	if err != nil {
+		return nil, err
+	} else if numStates < 2 {
+		return nil, errors.New("fewer than two states")
+	}
+
+	mixtures := map[State]*GaussianMixture{}
+	for p.PeekIs("<STATE>") {
+		p.Next()
+		idx, err := p.Int()
+		if err != nil {
+			return nil, err
+		} else if idx < 2 || idx >= numStates {
+			return nil, fmt.Errorf("state index out of bounds: %d", idx)
+		} else if _, ok := mixtures[idx]; ok {
+			return nil, fmt.Errorf("duplicate state: %d", idx)
+		}
+		if p.PeekIs("~s") {
+			p.Next()
+			name, err := p.Name()
+			if err != nil {
+				return nil, err
+			}
+			if mixtures[idx] = p.States[name]; mixtures[idx] == nil {
+				return nil, fmt.Errorf("undefined state macro: %s", name)
+			}
+		} else if mixtures[idx], err = p.ParseStateInfo(); err != nil {
+			return nil, err
+		}
+	}
+	if len(mixtures) != numStates-2 {
+		return nil, errors.New("missing state definitions")
+	}
+
+	var transP [][]float64
+	if p.PeekIs("~t") {
+		p.Next()
+		name, err := p.Name()
+		if err != nil {
+			return nil, err
+		}
+		if transP = p.TransPs[name]; transP == nil {
+			return nil, fmt.Errorf("undefined transition macro: %s", name)
+		}
+	} else if transP, err = p.ParseTransP(); err != nil {
+		return nil, err
+	}
+	if len(transP) != numStates {
+		return nil, errors.New("mismatching transition matrix size")
+	}
+	if err := p.Expect("<ENDHMM>"); err != nil {
+		return nil, err
+	}
+
+	return htkModel(transP, mixtures)
+}
+
+func (p *htkParser) ParseStateInfo() (*GaussianMixture, error) {
+	numMixes := 1
+	if p.PeekIs("<NUMMIXES>") {
+		p.Next()
+		var err error
+		if numMixes, err = p.Int(); err != nil {
+			return nil, err
+		}
+	}
+	res := &GaussianMixture{}
+	if !p.PeekIs("<MIXTURE>") {
+		pdf, err := p.ParseMixPDFRef()
+		if err != nil {
+			return nil, err
+		}
+		res.LogWeights = []float64{0}
+		res.Components = []*Gaussian{pdf}
+		return res, nil
+	}
+	for p.PeekIs("<MIXTURE>") {
+		p.Next()
+		if idx, err := p.Int(); err != nil {
+			return nil, err
+		} else if idx < 1 || idx > numMixes {
+			return nil, fmt.Errorf("mixture index out of bounds: %d", idx)
+		}
+		weight, err := p.Float()
+		if err != nil {
+			return nil, err
+		} else if weight < 0 {
+			return nil, errors.New("negative mixture weight")
+		}
+		pdf, err := p.ParseMixPDFRef()
+		if err != nil {
+			return nil, err
+		}
+		res.LogWeights = append(res.LogWeights, math.Log(weight))
+		res.Components = append(res.Components, pdf)
+	}
+	return res, nil
+}
+
+func (p *htkParser) ParseMixPDFRef() (*Gaussian, error) {
+	if !p.PeekIs("~m") {
+		return p.ParseMixPDF()
+	}
+	p.Next()
+	name, err := p.Name()
+	if err != nil {
+		return nil, err
+	}
+	res, ok := p.MixPDFs[name]
+	if !ok {
+		return nil, fmt.Errorf("undefined mixture macro: %s", name)
+	}
+	return res, nil
+}
+
+func (p *htkParser) ParseMixPDF() (*Gaussian, error) {
+	mean, err := p.parseVectorRef("~u", "<MEAN>", p.Means)
+	if err != nil {
+		return nil, err
+	}
+	variance, err := p.parseVectorRef("~v", "<VARIANCE>", p.Vars)
+	if err != nil {
+		return nil, err
+	}
+	if len(mean) != len(variance) {
+		return nil, errors.New("mismatching mean and variance sizes")
+	} else if p.VecSize != 0 && len(mean) != p.VecSize {
+		return nil, errors.New("vector size does not match <VECSIZE>")
+	}
+	for _, v := range variance {
+		if v <= 0 {
+			return nil, errors.New("non-positive variance")
+		}
+	}
+	if p.PeekIs("<GCONST>") {
+		// The constant is recomputed when needed.
+		p.Next()
+		if _, err := p.Float(); err != nil {
+			return nil, err
+		}
+	}
+	return &Gaussian{Mean: mean, Var: variance}, nil
+}
+
+func (p *htkParser) parseVectorRef(macro, keyword string,
+	macros map[string][]float64) ([]float64, error) {
+	if !p.PeekIs(macro) {
+		return p.ParseVector(keyword)
+	}
+	p.Next()
+	name, err := p.Name()
+	if err != nil {
+		return nil, err
+	}
+	res, ok := macros[name]
+	if !ok {
+		return nil, fmt.Errorf("undefined %s macro: %s", keyword, name)
+	}
+	return res, nil
+}
+
+func (p *htkParser) ParseVector(keyword string) ([]float64, error) {
+	if err := p.Expect(keyword); err != nil {
+		return nil, err
+	}
+	size, err := p.Int()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]float64, size)
+	for i := range res {
+		if res[i], err = p.Float(); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (p *htkParser) ParseTransP() ([][]float64, error) {
+	if err := p.Expect("<TRANSP>"); err != nil {
+		return nil, err
+	}
+	size, err := p.Int()
+	if err != nil {
+		return nil, err
+	}
+	res := newMatrix(size, size)
+	for _, row := range res {
+		for j := range row {
+			if row[j], err = p.Float(); err != nil {
+				return nil, err
+			} else if row[j] < 0 {
+				return nil, errors.New("negative transition probability")
+			}
+		}
+	}
+	return res, nil
+}
+
+// htkModel creates an HMM from HTK's transition matrix
+// and state distributions.
+func htkModel(transP [][]float64, mixtures map[State]*GaussianMixture) (*HMM, error) {
+	numStates := len(transP)
+	for i, row := range transP {
+		if row[0] != 0 {
+			return nil, errors.New("transition into entry state")
+		} else if i == numStates-1 {
+			for _, prob := range row {
+				if prob != 0 {
+					return nil, errors.New("transition out of exit state")
+				}
+			}
+		}
+	}
+
+	// An unreachable exit state means there is no terminal
+	// state, which is how WriteHTK records its absence.
+	lastState := numStates - 1
+	var terminal State
+	for _, row := range transP[:numStates-1] {
+		if row[numStates-1] != 0 {
+			lastState = numStates
+			terminal = numStates
+			break
+		}
+	}
+
+	res := &HMM{
+		TerminalState: terminal,
+		Init:          map[State]float64{},
+		Transitions:   map[Transition]float64{},
+	}
+	for i := 2; i <= lastState; i++ {
+		res.States = append(res.States, i)
+	}
+	for to := 2; to <= lastState; to++ {
+		if prob := transP[0][to-1]; prob > 0 {
+			res.Init[to] = math.Log(prob)
+		}
+		for from := 2; from < numStates; from++ {
+			if prob := transP[from-1][to-1]; prob > 0 {
+				res.Transitions[Transition{From: from, To: to}] = math.Log(prob)
+			}
+		}
+	}
+
+	singles := GaussianEmitter{}
+	for state, mixture := range mixtures {
+		if len(mixture.Components) != 1 {
+			res.Emitter = MixtureEmitter(mixtures)
+			return res, nil
+		}
+		singles[state] = mixture.Components[0]
+	}
+	res.Emitter = singles
+	return res, nil
+}
@@ -0,0 +1,253 @@
+package hmm
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+const htkTestingMMF = `~o
+<STREAMINFO> 1 2
+<VECSIZE> 2<NULLD><MFCC><DiagC>
+~v "var1"
+<Variance> 2
+ 1.0 0.5
+~s "shared"
+<NUMMIXES> 2
+<MIXTURE> 1 0.3
+<MEAN> 2 1.0 -2.0
+<VARIANCE> 2 2.0 0.5
+<MIXTURE> 2 0.7
+<MEAN> 2 0.0 1.0
+<VARIANCE> 2 1.0 3.0
+~t "trans"
+<TRANSP> 4
+ 0.0 0.6 0.4 0.0
+ 0.0 0.5 0.3 0.2
+ 0.0 0.0 0.9 0.1
+ 0.0 0.0 0.0 0.0
+~h "single"
+<BEGINHMM>
+<NUMSTATES> 3
+<STATE> 2
+<MEAN> 2
+ 3.0 4.0
+~v "var1"
+<GCONST> 1.234
+<TRANSP> 3
+ 0.0 1.0 0.0
+ 0.0 0.75 0.25
+ 0.0 0.0 0.0
+<ENDHMM>
+~h "mixture"
+<BeginHMM>
+<NumStates> 4
+<State> 2
+~s "shared"
+<State> 3
+<MEAN> 2 1.0 1.0
+<VARIANCE> 2 1.0 1.0
+~t "trans"
+<EndHMM>
+`
+
+func TestReadHTK(t *testing.T) {
+	models, err := ReadHTK(strings.NewReader(htkTestingMMF))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(models) != 2 {
+		t.Fatalf("unexpected models: %v", models)
+	}
+
+	single := models["single"]
+	expected := &HMM{
+		States:        []State{2, 3},
+		TerminalState: 3,
+		Init:          map[State]float64{2: 0},
+		Transitions: map[Transition]float64{
+			Transition{From: 2, To: 2}: math.Log(0.75),
+			Transition{From: 2, To: 3}: math.Log(0.25),
+		},
+	}
+	checkHTKModelsEqual(t, expected, single)
+	dist := single.Emitter.(GaussianEmitter)[2]
+	if !floatSlicesClose(dist.Mean, []float64{3, 4}) ||
+		!floatSlicesClose(dist.Var, []float64{1, 0.5}) {
+		t.Errorf("unexpected Gaussian: %v", dist)
+	}
+
+	mixture := models["mixture"]
+	expected = &HMM{
+		States:        []State{2, 3, 4},
+		TerminalState: 4,
+		Init:          map[State]float64{2: math.Log(0.6), 3: math.Log(0.4)},
+		Transitions: map[Transition]float64{
+			Transition{From: 2, To: 2}: math.Log(0.5),
+			Transition{From: 2, To: 3}: math.Log(0.3),
+			Transition{From: 2, To: 4}: math.Log(0.2),
+			Transition{From: 3, To: 3}: math.Log(0.9),
+			Transition{From: 3, To: 4}: math.Log(0.1),
+		},
+	}
+	checkHTKModelsEqual(t, expected, mixture)
+	emitter := mixture.Emitter.(MixtureEmitter)
+	x := []float64{0.5, -1}
+	actual, expectedProb := emitter[2].LogProb(x), testingMixture().LogProb(x)
+	if math.Abs(actual-expectedProb) > 1e-8 {
+		t.Errorf("expected log density %f but got %f", expectedProb, actual)
+	}
+	if n := len(emitter[3].Components); n != 1 {
+		t.Errorf("expected 1 component but got %d", n)
+	}
+}
+
+func TestHTKRoundTrip(t *testing.T) {
+	models, err := ReadHTK(strings.NewReader(htkTestingMMF))
+	if err != nil {
+		t.Fatal(err)
+	}
+	named := gaussianTestingHMM()
+	models["named"] = named
+
+	var buf bytes.Buffer
+	if err := WriteHTK(&buf, models); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := ReadHTK(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, model := range models {
+		if name != "named" {
+			checkHTKModelsEqual(t, model, decoded[name])
+		}
+	}
+
+	// The named states are renumbered.
+	h := decoded["named"]
+	x := []float64{0.5, -1}
+	for i, state := range []State{"A", "B"} {
+		expected := named.Emitter.LogProbs(x, state)[0]
+		actual := h.Emitter.LogProbs(x, i+2)[0]
+		if math.Abs(actual-expected) > 1e-8 {
+			t.Errorf("state %v: expected log density %f but got %f", state, expected, actual)
+		}
+	}
+	for _, seq := range [][]Obs{{x}, {x, []float64{1, 2}}} {
+		expected := LogLikelihood(named, seq)
+		if actual := LogLikelihood(h, seq); math.Abs(actual-expected) > 1e-8 {
+			t.Errorf("expected log-likelihood %f but got %f", expected, actual)
+		}
+	}
+}
+
+func TestHTKNoTerminal(t *testing.T) {
+	named := gaussianTestingHMM()
+	named.States = []State{"A", "B"}
+	named.TerminalState = nil
+	named.Transitions = map[Transition]float64{
+		Transition{From: "A", To: "A"}: math.Log(0.6),
+		Transition{From: "A", To: "B"}: math.Log(0.4),
+		Transition{From: "B", To: "A"}: math.Log(0.5),
+		Transition{From: "B", To: "B"}: math.Log(0.5),
+	}
+
+	var buf bytes.Buffer
+	if err := WriteHTK(&buf, map[string]*HMM{"endless": named}); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := ReadHTK(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &HMM{
+		States: []State{2, 3},
+		Init: map[State]float64{
+			2: math.Log(0.3),
+			3: math.Log(0.7),
+		},
+		Transitions: map[Transition]float64{
+			Transition{From: 2, To: 2}: math.Log(0.6),
+			Transition{From: 2, To: 3}: math.Log(0.4),
+			Transition{From: 3, To: 2}: math.Log(0.5),
+			Transition{From: 3, To: 3}: math.Log(0.5),
+		},
+	}
+	checkHTKModelsEqual(t, expected, decoded["endless"])
+}
+
+func TestHTKErrors(t *testing.T) {
+	invalid := map[string][2]string{
+		"multiple streams":  {"<STREAMINFO> 1 2", "<STREAMINFO> 2 1 1"},
+		"full covariance":   {"<DiagC>", "<FULLC>"},
+		"vector size":       {"<VECSIZE> 2", "<VECSIZE> 3"},
+		"undefined macro":   {`~t "trans"` + "\n<EndHMM>", `~t "other"` + "\n<EndHMM>"},
+		"duplicate state":   {"<State> 3\n", "<State> 2\n"},
+		"bad state index":   {"<STATE> 2\n<MEAN>", "<STATE> 3\n<MEAN>"},
+		"exit transition":   {" 0.0 0.0 0.0\n<ENDHMM>", " 0.0 0.0 1.0\n<ENDHMM>"},
+		"unknown macro":     {"~h \"single\"", "~z \"single\""},
+		"bad number":        {"3.0 4.0", "3.0 four"},
+		"missing end":       {"<EndHMM>", ""},
+		"negative variance": {"1.0 0.5", "1.0 -0.5"},
+	}
+	for name, replacement := range invalid {
+		data := strings.Replace(htkTestingMMF, replacement[0], replacement[1], 1)
+		if data == htkTestingMMF {
+			t.Fatalf("%s: replacement not found", name)
+		}
+		if _, err := ReadHTK(strings.NewReader(data)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	if err := WriteHTK(&bytes.Buffer{}, map[string]*HMM{"x": testingHMM()}); err == nil {
+		t.Error("expected error for tabular emitter")
+	}
+	h := gaussianTestingHMM()
+	h.SilentStates = []State{"B"}
+	if err := WriteHTK(&bytes.Buffer{}, map[string]*HMM{"x": h}); err == nil {
+		t.Error("expected error for silent state")
+	}
+}
+
+func checkHTKModelsEqual(t *testing.T, expected, actual *HMM) {
+	if !stateSeqsEqual(expected.States, actual.States) {
+		t.Errorf("expected states %v but got %v", expected.States, actual.States)
+	}
+	if expected.TerminalState != actual.TerminalState {
+		t.Errorf("expected terminal %v but got %v", expected.TerminalState,
+			actual.TerminalState)
+	}
+	if len(expected.Init) != len(actual.Init) {
+		t.Errorf("expected init %v but got %v", expected.Init, actual.Init)
+	}
+	for state, prob := range expected.Init {
+		if math.Abs(actual.Init[state]-prob) > 1e-8 {
+			t.Errorf("init %v: expected %f but got %f", state, prob, actual.Init[state])
+		}
+	}
+	if len(expected.Transitions) != len(actual.Transitions) {
+		t.Errorf("expected transitions %v but got %v", expected.Transitions,
+			actual.Transitions)
+	}
+	for trans, prob := range expected.Transitions {
+		if math.Abs(actual.Transitions[trans]-prob) > 1e-8 {
+			t.Errorf("transition %v: expected %f but got %f", trans, prob,
+				actual.Transitions[trans])
+		}
+	}
+}
+
+func floatSlicesClose(v1, v2 []float64) bool {
+	if len(v1) != len(v2) {
+		return false
+	}
+	for i, x := range v1 {
+		if math.Abs(x-v2[i]) > 1e-8 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,544 @@
+package hmm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/unixpickle/essentials"
+)
+
+// jsonTolerance is the maximum amount by which a decoded
+// distribution may fail to sum to 1.
+const jsonTolerance = 1e-4
+
+// A ProbSpace determines how probabilities are written in
+// the JSON format.
+type ProbSpace string
+
+const (
+	LogSpace    ProbSpace = "log"
+	LinearSpace ProbSpace = "linear"
+)
+
+// EncodeJSON encodes an HMM as human-readable JSON.
+//
+// States and observations must be strings, ints, or
+// float64 values, and the emitter must be a TabularEmitter.
+// Every state in h.Init and h.Transitions must be in
+// h.States.
+// Other numeric types are rejected, since DecodeJSON could
+// not restore their types.
+// Entries are written in a deterministic order: states in
+// the order of h.States, and observations sorted by their
+// JSON encodings.
+//
+// JSON cannot represent infinities, so when encoding in
+// log space, entries with probability 0 are omitted.
+func EncodeJSON(h *HMM, space ProbSpace) (data []byte, err error) {
+	defer essentials.AddCtxTo("encode JSON HMM", &err)
+	if err := checkProbSpace(space); err != nil {
+		return nil, err
+	}
+	emitter, ok := h.Emitter.(TabularEmitter)
+	if !ok {
+		return nil, fmt.Errorf("unsupported emitter type: %T", h.Emitter)
+	}
+
+	known := map[State]bool{}
+	for _, state := range h.States {
+		known[state] = true
+	}
+	for state := range h.Init {
+		if !known[state] {
+			return nil, fmt.Errorf("unknown initial state: %v", state)
+		}
+	}
+	for t := range h.Transitions {
+		if !known[t.From] || !known[t.To] {
+			return nil, fmt.Errorf("unknown state in transition: %v -> %v", t.From, t.To)
+		}
+	}
+
+	res := &jsonHMM{Space: space}
+	for _, state := range h.States {
+		value, err := jsonValue(state)
+		if err != nil {
+			return nil, err
+		}
+		res.States = append(res.States, value)
+	}
+	if h.TerminalState != nil {
+		res.Terminal, err = jsonValue(h.TerminalState)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, state := range h.SilentStates {
+		value, err := jsonValue(state)
+		if err != nil {
+			return nil, err
+		}
+		res.Silent = append(res.Silent, value)
+	}
+
+	res.Init = []jsonStateProb{}
+	for _, state := range h.States {
+		if prob, ok := h.Init[state]; ok && includeJSONProb(prob, space) {
+			value, _ := jsonValue(state)
+			res.Init = append(res.Init, jsonStateProb{
+				State: value,
+				Prob:  encodeJSONProb(prob, space),
+			})
+		}
+	}
+
+	res.Transitions = []jsonTransition{}
+	for _, from := range h.States {
+		for _, to := range h.States {
+			prob, ok := h.Transitions[Transition{From: from, To: to}]
+			if ok && includeJSONProb(prob, space) {
+				fromValue, _ := jsonValue(from)
+				toValue, _ := jsonValue(to)
+				res.Transitions = append(res.Transitions, jsonTransition{
+					From: fromValue,
+					To:   toValue,
+					Prob: encodeJSONProb(prob, space),
+				})
+			}
+		}
+	}
+
+	res.Emitter, err = encodeJSONTabular(emitter, h.States, space)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(res, "", "  ")
+}
+
+// DecodeJSON decodes an HMM from the format produced by
+// EncodeJSON.
+//
+// Numbers are decoded as ints if they are integers, and as
+// float64 values otherwise.
+//
+// Decoding is strict: unknown fields, unknown or duplicate
+// states, duplicate entries, invalid probabilities, and
+// distributions which do not sum to 1 are all errors.
+func DecodeJSON(data []byte) (h *HMM, err error) {
+	defer essentials.AddCtxTo("decode JSON HMM", &err)
+	var obj jsonHMM
+	if err := strictUnmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	space := obj.Space
+	if space == "" {
+		space = LogSpace
+	}
+	if err := checkProbSpace(space); err != nil {
+		return nil, err
+	}
+
+	h = &HMM{
+		Init:        map[State]float64{},
+		Transitions: map[Transition]float64{},
+	}
+	known := map[State]bool{}
+	for _, value := range obj.States {
+		state, err := decodeJSONValue(value)
+		if err != nil {
+			return nil, err
+		} else if known[state] {
+			return nil, fmt.Errorf("duplicate state: %v", state)
+		}
+		known[state] = true
+		h.States = append(h.States, state)
+	}
+	lookup := func(value interface{}) (State, error) {
+		state, err := decodeJSONValue(value)
+		if err != nil {
+			return nil, err
+		} else if !known[state] {
+			return nil, fmt.Errorf("unknown state: %v", state)
+		}
+		return state, nil
+	}
+
+	if obj.Terminal != nil {
+		if h.TerminalState, err = lookup(obj.Terminal); err != nil {
+			return nil, err
+		}
+	}
+	silent := map[State]bool{}
+	for _, value := range obj.Silent {
+		state, err := lookup(value)
+		if err != nil {
+			return nil, err
+		} else if silent[state] || state == h.TerminalState {
+			return nil, fmt.Errorf("invalid silent state: %v", state)
+		}
+		silent[state] = true
+		h.SilentStates = append(h.SilentStates, state)
+	}
+
+	for _, entry := range obj.Init {
+		state, err := lookup(entry.State)
+		if err != nil {
+			return nil, err
+		} else if _, ok := h.Init[state]; ok {
+			return nil, fmt.Errorf("duplicate initial probability: %v", state)
+		}
+		if h.Init[state], err = decodeJSONProb(entry.Prob, space); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkJSONDist(h.Init); err != nil {
+		return nil, fmt.Errorf("initial distribution: %s", err)
+	}
+
+	rows := map[State]map[State]float64{}
+	for _, entry := range obj.Transitions {
+		from, err := lookup(entry.From)
+		if err != nil {
+			return nil, err
+		}
+		to, err := lookup(entry.To)
+		if err != nil {
+			return nil, err
+		}
+		if from == h.TerminalState {
+			return nil, errors.New("transition out of terminal state")
+		}
+		t := Transition{From: from, To: to}
+		if _, ok := h.Transitions[t]; ok {
+			return nil, fmt.Errorf("duplicate transition: %v -> %v", from, to)
+		}
+		if h.Transitions[t], err = decodeJSONProb(entry.Prob, space); err != nil {
+			return nil, err
+		}
+		if rows[from] == nil {
+			rows[from] = map[State]float64{}
+		}
+		rows[from][to] = h.Transitions[t]
+	}
+	for _, state := range h.States {
+		if row, ok := rows[state]; ok {
+			if err := checkJSONDist(row); err != nil {
+				return nil, fmt.Errorf("transitions from %v: %s", state, err)
+			}
+		}
+	}
+
+	if obj.Emitter == nil {
+		return nil, errors.New("missing emitter")
+	} else if obj.Emitter.Space != "" {
+		return nil, errors.New("emitter cannot have its own space")
+	}
+	emitter, err := decodeJSONTabular(obj.Emitter, space, known)
+	if err != nil {
+		return nil, err
+	}
+	for state := range emitter {
+		if silent[state] || state == h.TerminalState {
+			return nil, fmt.Errorf("emissions for silent state: %v", state)
+		}
+	}
+	h.Emitter = emitter
+
+	s2i := statesToIndices(h)
+	if _, err := silentOrder(h, s2i, silentMask(h, s2i)); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// MarshalJSON encodes the HMM in log space.
+// See EncodeJSON.
+func (h *HMM) MarshalJSON() ([]byte, error) {
+	return EncodeJSON(h, LogSpace)
+}
+
+// UnmarshalJSON decodes the HMM.
+// See DecodeJSON.
+func (h *HMM) UnmarshalJSON(data []byte) error {
+	res, err := DecodeJSON(data)
+	if err != nil {
+		return err
+	}
+	*h = *res
+	return nil
+}
+
+// MarshalJSON encodes the TabularEmitter in log space.
+//
+// States and observations must be strings, ints, or
+// float64 values.
+// See EncodeJSON for details on the format.
+func (t TabularEmitter) MarshalJSON() (data []byte, err error) {
+	defer essentials.AddCtxTo("encode JSON TabularEmitter", &err)
+	var states []State
+	for state := range t {
+		states = append(states, state)
+	}
+	if err := sortJSONValues(states); err != nil {
+		return nil, err
+	}
+	obj, err := encodeJSONTabular(t, states, LogSpace)
+	if err != nil {
+		return nil, err
+	}
+	obj.Space = LogSpace
+	return json.Marshal(obj)
+}
+
+// UnmarshalJSON decodes the TabularEmitter, applying the
+// same validation as DecodeJSON.
+func (t *TabularEmitter) UnmarshalJSON(data []byte) (err error) {
+	defer essentials.AddCtxTo("decode JSON TabularEmitter", &err)
+	var obj jsonTabular
+	if err := strictUnmarshal(data, &obj); err != nil {
+		return err
+	}
+	space := obj.Space
+	if space == "" {
+		space = LogSpace
+	}
+	if err := checkProbSpace(space); err != nil {
+		return err
+	}
+	res, err := decodeJSONTabular(&obj, space, nil)
+	if err != nil {
+		return err
+	}
+	*t = res
+	return nil
+}
+
+type jsonHMM struct {
+	Space       ProbSpace        `json:"space"`
+	States      []interface{}    `json:"states"`
+	Terminal    interface{}      `json:"terminal,omitempty"`
+	Silent      []interface{}    `json:"silent,omitempty"`
+	Init        []jsonStateProb  `json:"init"`
+	Transitions []jsonTransition `json:"transitions"`
+	Emitter     *jsonTabular     `json:"emitter"`
+}
+
+type jsonStateProb struct {
+	State interface{} `json:"state"`
+	Prob  *float64    `json:"prob"`
+}
+
+type jsonTransition struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+	Prob *float64    `json:"prob"`
+}
+
+type jsonTabular struct {
+	// Space is only allowed for standalone emitters.
+	Space     ProbSpace      `json:"space,omitempty"`
+	Emissions []jsonEmission `json:"emissions"`
+}
+
+type jsonEmission struct {
+	State interface{} `json:"state"`
+	Obs   interface{} `json:"obs"`
+	Prob  *float64    `json:"prob"`
+}
+
+func encodeJSONTabular(t TabularEmitter, states []State,
+	space ProbSpace) (*jsonTabular, error) {
+	res := &jsonTabular{Emissions: []jsonEmission{}}
+	for _, state := range states {
+		row, ok := t[state]
+		if !ok {
+			continue
+		}
+		stateValue, err := jsonValue(state)
+		if err != nil {
+			return nil, err
+		}
+		var obses []State
+		for obs := range row {
+			obses = append(obses, obs)
+		}
+		if err := sortJSONValues(obses); err != nil {
+			return nil, err
+		}
+		for _, obs := range obses {
+			if !includeJSONProb(row[obs], space) {
+				continue
+			}
+			obsValue, _ := jsonValue(obs)
+			res.Emissions = append(res.Emissions, jsonEmission{
+				State: stateValue,
+				Obs:   obsValue,
+				Prob:  encodeJSONProb(row[obs], space),
+			})
+		}
+	}
+	return res, nil
+}
+
+// decodeJSONTabular decodes and validates an emitter.
+// If known is non-nil, it restricts the allowed states.
+func decodeJSONTabular(obj *jsonTabular, space ProbSpace,
+	known map[State]bool) (TabularEmitter, error) {
+	res := TabularEmitter{}
+	for _, entry := range obj.Emissions {
+		state, err := decodeJSONValue(entry.State)
+		if err != nil {
+			return nil, err
+		} else if known != nil && !known[state] {
+			return nil, fmt.Errorf("unknown state: %v", state)
+		}
+		obs, err := decodeJSONValue(entry.Obs)
+		if err != nil {
+			return nil, err
+		}
+		if res[state] == nil {
+			res[state] = map[Obs]float64{}
+		} else if _, ok := res[state][obs]; ok {
+			return nil, fmt.Errorf("duplicate emission: %v from %v", obs, state)
+		}
+		if res[state][obs], err = decodeJSONProb(entry.Prob, space); err != nil {
+			return nil, err
+		}
+	}
+	for state, row := range res {
+		dist := map[State]float64{}
+		for obs, prob := range row {
+			dist[obs] = prob
+		}
+		if err := checkJSONDist(dist); err != nil {
+			return nil, fmt.Errorf("emissions from %v: %s", state, err)
+		}
+	}
+	return res, nil
+}
+
+func strictUnmarshal(data []byte, obj interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(obj); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return errors.New("unexpected data after JSON object")
+	}
+	return nil
+}
+
+func checkProbSpace(space ProbSpace) error {
+	if space != LogSpace && space != LinearSpace {
+		return fmt.Errorf("unknown probability space: %q", space)
+	}
+	return nil
+}
+
+// jsonValue converts a state or observation into a value
+// that can be encoded as a JSON string or number.
+func jsonValue(x interface{}) (interface{}, error) {
+	switch x := x.(type) {
+	case string, int:
+		return x, nil
+	case float64:
+		if math.IsInf(x, 0) || math.IsNaN(x) {
+			return nil, fmt.Errorf("unsupported number: %v", x)
+		}
+		// Integral values get a decimal point so that they
+		// are not decoded as ints.
+		str := strconv.FormatFloat(x, 'g', -1, 64)
+		if !strings.ContainsAny(str, ".e") {
+			str += ".0"
+		}
+		return json.Number(str), nil
+	default:
+		return nil, fmt.Errorf("unsupported state or observation type: %T", x)
+	}
+}
+
+// decodeJSONValue converts a decoded JSON string or
+// number into a state or observation.
+func decodeJSONValue(x interface{}) (interface{}, error) {
+	switch x := x.(type) {
+	case string:
+		return x, nil
+	case json.Number:
+		if i, err := x.Int64(); err == nil && int64(int(i)) == i {
+			return int(i), nil
+		}
+		return x.Float64()
+	case nil:
+		return nil, errors.New("missing state or observation")
+	default:
+		return nil, fmt.Errorf("unsupported state or observation: %v", x)
+	}
+}
+
+// sortJSONValues sorts states or observations by their
+// JSON encodings.
+func sortJSONValues(values []State) error {
+	keys := map[State]string{}
+	for _, value := range values {
+		jsonVal, err := jsonValue(value)
+		if err != nil {
+			return err
+		}
+		data, _ := json.Marshal(jsonVal)
+		keys[value] = string(data)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return keys[values[i]] < keys[values[j]]
+	})
+	return nil
+}
+
+func includeJSONProb(logProb float64, space ProbSpace) bool {
+	return space == LinearSpace || !math.IsInf(logProb, -1)
+}
+
+func encodeJSONProb(logProb float64, space ProbSpace) *float64 {
+	res := logProb
+	if space == LinearSpace {
+		res = math.Exp(logProb)
+	}
+	return &res
+}
+
+// decodeJSONProb validates a probability and converts it
+// to the log domain.
+func decodeJSONProb(prob *float64, space ProbSpace) (float64, error) {
+	if prob == nil {
+		return 0, errors.New("missing probability")
+	}
+	if space == LinearSpace {
+		if !(*prob >= 0 && *prob <= 1+jsonTolerance) {
+			return 0, fmt.Errorf("invalid probability: %v", *prob)
+		}
+		return math.Log(*prob), nil
+	}
+	if !(*prob <= jsonTolerance) {
+		return 0, fmt.Errorf("invalid log probability: %v", *prob)
+	}
+	return *prob, nil
+}
+
+// checkJSONDist checks that log probabilities sum to 1.
+func checkJSONDist(dist map[State]float64) error {
+	total := math.Inf(-1)
+	for _, prob := range dist {
+		total = addLogs(total, prob)
+	}
+	if math.Abs(math.Exp(total)-1) > jsonTolerance {
+		return fmt.Errorf("probabilities sum to %f", math.Exp(total))
+	}
+	return nil
+}
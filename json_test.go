@@ -0,0 +1,232 @@
+package hmm
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	numeric := testingHMM()
+	numeric.States = []State{0, 1.5, 2, "D"}
+	numeric.Init = map[State]float64{0: math.Log(0.4), 2: math.Log(0.6)}
+	numeric.Transitions = map[Transition]float64{
+		Transition{From: 0, To: 1.5}:   math.Log(0.5),
+		Transition{From: 0, To: "D"}:   math.Log(0.5),
+		Transition{From: 1.5, To: 2}:   0,
+		Transition{From: 2, To: "D"}:   0,
+		Transition{From: 2, To: 1.5}:   math.Inf(-1),
+		Transition{From: 1.5, To: "D"}: math.Inf(-1),
+	}
+	numeric.Emitter = TabularEmitter{
+		0:   map[Obs]float64{1: math.Log(0.25), "x": math.Log(0.75)},
+		1.5: map[Obs]float64{2.5: math.Log(0.5), 3.0: math.Log(0.5)},
+		2:   map[Obs]float64{1: 0, "y": math.Inf(-1)},
+	}
+
+	for _, h := range []*HMM{testingHMM(), silentTestingHMM(), numeric} {
+		for _, space := range []ProbSpace{LogSpace, LinearSpace} {
+			data, err := EncodeJSON(h, space)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data2, _ := EncodeJSON(h, space)
+			if !bytes.Equal(data, data2) {
+				t.Error("encoding is not deterministic")
+			}
+			decoded, err := DecodeJSON(data)
+			if err != nil {
+				t.Fatalf("%s: %s", space, err)
+			}
+			checkJSONModelsEqual(t, h, decoded)
+		}
+	}
+
+	h := testingHMM()
+	data, err := json.Marshal(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded HMM
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	checkJSONModelsEqual(t, h, &decoded)
+}
+
+func TestJSONTabularEmitter(t *testing.T) {
+	emitter := testingHMM().Emitter.(TabularEmitter)
+	data, err := json.Marshal(emitter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded TabularEmitter
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != len(emitter) {
+		t.Errorf("expected %d rows but got %d", len(emitter), len(decoded))
+	}
+	for state, row := range emitter {
+		for obs, prob := range row {
+			if math.Abs(decoded[state][obs]-prob) > 1e-8 {
+				t.Errorf("emission %v from %v: expected %f but got %f", obs, state, prob,
+					decoded[state][obs])
+			}
+		}
+	}
+
+	linear := `{"space": "linear", "emissions": [
+		{"state": "A", "obs": "x", "prob": 0.25},
+		{"state": "A", "obs": "y", "prob": 0.75}
+	]}`
+	if err := json.Unmarshal([]byte(linear), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(decoded["A"]["y"]-math.Log(0.75)) > 1e-8 {
+		t.Errorf("unexpected emitter: %v", decoded)
+	}
+
+	bad := `{"emissions": [{"state": "A", "obs": "x", "prob": -1}]}`
+	if err := json.Unmarshal([]byte(bad), &decoded); err == nil {
+		t.Error("expected error for unnormalized emissions")
+	}
+}
+
+func TestJSONValidation(t *testing.T) {
+	valid := `{
+		"space": "linear",
+		"states": ["A", "S", "T"],
+		"terminal": "T",
+		"silent": ["S"],
+		"init": [{"state": "A", "prob": 1}],
+		"transitions": [
+			{"from": "A", "to": "S", "prob": 0.5},
+			{"from": "A", "to": "T", "prob": 0.5},
+			{"from": "S", "to": "A", "prob": 1}
+		],
+		"emitter": {"emissions": [{"state": "A", "obs": "x", "prob": 1}]}
+	}`
+	if _, err := DecodeJSON([]byte(valid)); err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := map[string][2]string{
+		"unknown field":        {`"space": "linear",`, `"space": "linear", "foo": 1,`},
+		"unknown space":        {`"space": "linear"`, `"space": "exp"`},
+		"duplicate state":      {`["A", "S", "T"]`, `["A", "S", "T", "A"]`},
+		"bad state type":       {`["A", "S", "T"]`, `["A", "S", "T", true]`},
+		"unknown terminal":     {`"terminal": "T"`, `"terminal": "U"`},
+		"terminal silent":      {`"silent": ["S"]`, `"silent": ["S", "T"]`},
+		"missing probability":  {`{"state": "A", "prob": 1}`, `{"state": "A"}`},
+		"negative probability": {`"to": "S", "prob": 0.5`, `"to": "S", "prob": -0.5`},
+		"unnormalized row":     {`"to": "S", "prob": 0.5`, `"to": "S", "prob": 0.6`},
+		"duplicate transition": {`{"from": "S", "to": "A", "prob": 1}`,
+			`{"from": "S", "to": "A", "prob": 1}, {"from": "S", "to": "A", "prob": 1}`},
+		"terminal transition": {`{"from": "S", "to": "A", "prob": 1}`,
+			`{"from": "S", "to": "A", "prob": 1}, {"from": "T", "to": "A", "prob": 1}`},
+		"silent emissions": {`{"state": "A", "obs": "x", "prob": 1}`,
+			`{"state": "A", "obs": "x", "prob": 1}, {"state": "S", "obs": "x", "prob": 1}`},
+		"silent cycle":    {`"to": "A", "prob": 1`, `"to": "S", "prob": 1`},
+		"missing emitter": {`"emitter"`, `"other"`},
+		"emitter space":   {`"emitter": {`, `"emitter": {"space": "linear", `},
+	}
+	for name, replacement := range invalid {
+		data := strings.Replace(valid, replacement[0], replacement[1], 1)
+		if data == valid {
+			t.Fatalf("%s: replacement not found", name)
+		}
+		if _, err := DecodeJSON([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	if _, err := DecodeJSON([]byte(valid + "{}")); err == nil {
+		t.Error("expected error for trailing data")
+	}
+	if _, err := DecodeJSON([]byte(strings.Replace(valid, "linear", "log", 1))); err == nil {
+		t.Error("expected error for positive log probabilities")
+	}
+}
+
+func TestJSONUnsupported(t *testing.T) {
+	h := testingHMM()
+	h.States[0] = struct{}{}
+	if _, err := EncodeJSON(h, LogSpace); err == nil {
+		t.Error("expected error for unsupported state")
+	}
+	for _, state := range []State{int64(1), uint8(1), float32(1.5)} {
+		h = testingHMM()
+		h.States[0] = state
+		if _, err := EncodeJSON(h, LogSpace); err == nil {
+			t.Errorf("expected error for %T state", state)
+		}
+	}
+	h = testingHMM()
+	h.Init["E"] = math.Inf(-1)
+	if _, err := EncodeJSON(h, LogSpace); err == nil {
+		t.Error("expected error for unknown initial state")
+	}
+	h = testingHMM()
+	h.Transitions[Transition{From: "A", To: "E"}] = math.Inf(-1)
+	if _, err := EncodeJSON(h, LogSpace); err == nil {
+		t.Error("expected error for unknown transition state")
+	}
+	h = gaussianTestingHMM()
+	if _, err := EncodeJSON(h, LogSpace); err == nil {
+		t.Error("expected error for unsupported emitter")
+	}
+}
+
+func checkJSONModelsEqual(t *testing.T, expected, actual *HMM) {
+	if !stateSeqsEqual(expected.States, actual.States) {
+		t.Errorf("expected states %v but got %v", expected.States, actual.States)
+	}
+	if !stateSeqsEqual(expected.SilentStates, actual.SilentStates) {
+		t.Errorf("expected silent states %v but got %v", expected.SilentStates,
+			actual.SilentStates)
+	}
+	if expected.TerminalState != actual.TerminalState {
+		t.Errorf("expected terminal %v but got %v", expected.TerminalState,
+			actual.TerminalState)
+	}
+	probsClose := func(p1, p2 float64) bool {
+		if math.IsInf(p1, -1) || math.IsInf(p2, -1) {
+			return math.IsInf(p1, -1) && math.IsInf(p2, -1)
+		}
+		return math.Abs(p1-p2) < 1e-8
+	}
+	param := func(prob float64, ok bool) float64 {
+		if !ok {
+			return math.Inf(-1)
+		}
+		return prob
+	}
+	for _, state := range expected.States {
+		p1, ok1 := expected.Init[state]
+		p2, ok2 := actual.Init[state]
+		if !probsClose(param(p1, ok1), param(p2, ok2)) {
+			t.Errorf("initial %v: expected %f but got %f", state, p1, p2)
+		}
+		for _, to := range expected.States {
+			trans := Transition{From: state, To: to}
+			p1, ok1 := expected.Transitions[trans]
+			p2, ok2 := actual.Transitions[trans]
+			if !probsClose(param(p1, ok1), param(p2, ok2)) {
+				t.Errorf("transition %v: expected %f but got %f", trans, p1, p2)
+			}
+		}
+	}
+	e1 := expected.Emitter.(TabularEmitter)
+	e2 := actual.Emitter.(TabularEmitter)
+	for state, row := range e1 {
+		for obs, prob := range row {
+			p2, ok := e2[state][obs]
+			if !probsClose(prob, param(p2, ok)) {
+				t.Errorf("emission %v from %v: expected %f but got %f", obs, state, prob, p2)
+			}
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package hmm
+
+import (
+	"math"
+	"sort"
+)
+
+// This file implements the small amount of dense linear
+// algebra needed for spectral learning.
+// Matrices are stored as slices of rows.
+
+func newMatrix(rows, cols int) [][]float64 {
+	res := make([][]float64, rows)
+	for i := range res {
+		res[i] = make([]float64, cols)
+	}
+	return res
+}
+
+func identityMatrix(n int) [][]float64 {
+	res := newMatrix(n, n)
+	for i := range res {
+		res[i][i] = 1
+	}
+	return res
+}
+
+func matMul(a, b [][]float64) [][]float64 {
+	res := newMatrix(len(a), len(b[0]))
+	for i, row := range a {
+		for k, x := range row {
+			if x == 0 {
+				continue
+			}
+			for j, y := range b[k] {
+				res[i][j] += x * y
+			}
+		}
+	}
+	return res
+}
+
+func matVec(a [][]float64, v []float64) []float64 {
+	res := make([]float64, len(a))
+	for i, row := range a {
+		for j, x := range row {
+			res[i] += x * v[j]
+		}
+	}
+	return res
+}
+
+func transpose(a [][]float64) [][]float64 {
+	res := newMatrix(len(a[0]), len(a))
+	for i, row := range a {
+		for j, x := range row {
+			res[j][i] = x
+		}
+	}
+	return res
+}
+
+func dot(v1, v2 []float64) float64 {
+	var res float64
+	for i, x := range v1 {
+		res += x * v2[i]
+	}
+	return res
+}
+
+// invertMatrix inverts a square matrix using Gauss-Jordan
+// elimination with partial pivoting.
+// It returns false if the matrix is singular.
+func invertMatrix(a [][]float64) ([][]float64, bool) {
+	n := len(a)
+	work := newMatrix(n, n)
+	for i, row := range a {
+		copy(work[i], row)
+	}
+	res := identityMatrix(n)
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(work[row][col]) > math.Abs(work[pivot][col]) {
+				pivot = row
+			}
+		}
+		if work[pivot][col] == 0 {
+			return nil, false
+		}
+		work[col], work[pivot] = work[pivot], work[col]
+		res[col], res[pivot] = res[pivot], res[col]
+
+		scale := 1 / work[col][col]
+		for j := 0; j < n; j++ {
+			work[col][j] *= scale
+			res[col][j] *= scale
+		}
+		for row := 0; row < n; row++ {
+			if row == col || work[row][col] == 0 {
+				continue
+			}
+			factor := work[row][col]
+			for j := 0; j < n; j++ {
+				work[row][j] -= factor * work[col][j]
+				res[row][j] -= factor * res[col][j]
+			}
+		}
+	}
+	return res, true
+}
+
+// pseudoInverse computes the pseudo-inverse of a matrix
+// with full row rank.
+// It returns false if the matrix is rank deficient.
+func pseudoInverse(a [][]float64) ([][]float64, bool) {
+	at := transpose(a)
+	inv, ok := invertMatrix(matMul(a, at))
+	if !ok {
+		return nil, false
+	}
+	return matMul(at, inv), true
+}
+
+// symmetricEigen computes the eigenvalues and eigenvectors
+// of a symmetric matrix using the Jacobi method.
+//
+// The eigenvalues are sorted in descending order, and the
+// eigenvectors are the corresponding columns of vectors.
+func symmetricEigen(a [][]float64) (values []float64, vectors [][]float64) {
+	n := len(a)
+	work := newMatrix(n, n)
+	for i, row := range a {
+		copy(work[i], row)
+	}
+	vecs := identityMatrix(n)
+	for sweep := 0; sweep < 100; sweep++ {
+		var offDiag, total float64
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				total += work[i][j] * work[i][j]
+				if i != j {
+					offDiag += work[i][j] * work[i][j]
+				}
+			}
+		}
+		if offDiag <= 1e-24*total {
+			break
+		}
+		for p := 0; p < n; p++ {
+			for q := p + 1; q < n; q++ {
+				if work[p][q] == 0 {
+					continue
+				}
+				theta := (work[q][q] - work[p][p]) / (2 * work[p][q])
+				t := 1 / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				if theta < 0 {
+					t = -t
+				}
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+				for k := 0; k < n; k++ {
+					kp, kq := work[k][p], work[k][q]
+					work[k][p] = c*kp - s*kq
+					work[k][q] = s*kp + c*kq
+				}
+				for k := 0; k < n; k++ {
+					pk, qk := work[p][k], work[q][k]
+					work[p][k] = c*pk - s*qk
+					work[q][k] = s*pk + c*qk
+				}
+				for k := 0; k < n; k++ {
+					kp, kq := vecs[k][p], vecs[k][q]
+					vecs[k][p] = c*kp - s*kq
+					vecs[k][q] = s*kp + c*kq
+				}
+			}
+		}
+	}
+
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return work[order[i]][order[i]] > work[order[j]][order[j]]
+	})
+	values = make([]float64, n)
+	vectors = newMatrix(n, n)
+	for newIdx, oldIdx := range order {
+		values[newIdx] = work[oldIdx][oldIdx]
+		for k := 0; k < n; k++ {
+			vectors[k][newIdx] = vecs[k][oldIdx]
+		}
+	}
+	return
+}
+
+// realEigen computes the eigenvalues and eigenvectors of a
+// square matrix whose eigenvalues are real and distinct,
+// using unshifted QR iterations.
+//
+// The eigenvectors are the columns of vectors.
+func realEigen(a [][]float64) (values []float64, vectors [][]float64) {
+	n := len(a)
+	work := newMatrix(n, n)
+	for i, row := range a {
+		copy(work[i], row)
+	}
+	q := identityMatrix(n)
+	for iter := 0; iter < 10000; iter++ {
+		var subDiag, total float64
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				total += work[i][j] * work[i][j]
+				if i > j {
+					subDiag += work[i][j] * work[i][j]
+				}
+			}
+		}
+		if subDiag <= 1e-24*total {
+			break
+		}
+		qStep, r := qrDecompose(work)
+		work = matMul(r, qStep)
+		q = matMul(q, qStep)
+	}
+
+	// Solve for the eigenvectors of the upper-triangular
+	// Schur form with back-substitution.
+	values = make([]float64, n)
+	schurVecs := newMatrix(n, n)
+	for i := 0; i < n; i++ {
+		values[i] = work[i][i]
+		schurVecs[i][i] = 1
+		for j := i - 1; j >= 0; j-- {
+			var sum float64
+			for l := j + 1; l <= i; l++ {
+				sum += work[j][l] * schurVecs[l][i]
+			}
+			denom := work[j][j] - values[i]
+			if math.Abs(denom) < 1e-12 {
+				denom = 1e-12
+			}
+			schurVecs[j][i] = -sum / denom
+		}
+	}
+	return values, matMul(q, schurVecs)
+}
+
+// qrDecompose computes a QR decomposition with modified
+// Gram-Schmidt.
+func qrDecompose(a [][]float64) (q, r [][]float64) {
+	n := len(a)
+	cols := transpose(a)
+	r = newMatrix(n, n)
+	for i := 0; i < n; i++ {
+		for j := 0; j < i; j++ {
+			r[j][i] = dot(cols[j], cols[i])
+			for k := range cols[i] {
+				cols[i][k] -= r[j][i] * cols[j][k]
+			}
+		}
+		r[i][i] = math.Sqrt(dot(cols[i], cols[i]))
+		if r[i][i] != 0 {
+			for k := range cols[i] {
+				cols[i][k] /= r[i][i]
+			}
+		}
+	}
+	return transpose(cols), r
+}
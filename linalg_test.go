@@ -0,0 +1,62 @@
+package hmm
+
+import (
+	"math"
+	"testing"
+)
+
+func TestInvertMatrix(t *testing.T) {
+	a := [][]float64{{0, 2, 1}, {1, 1, 0}, {3, 0, 4}}
+	inv, ok := invertMatrix(a)
+	if !ok {
+		t.Fatal("matrix should be invertible")
+	}
+	checkMatricesClose(t, matMul(a, inv), identityMatrix(3))
+
+	if _, ok := invertMatrix([][]float64{{1, 2}, {2, 4}}); ok {
+		t.Error("matrix should be singular")
+	}
+}
+
+func TestSymmetricEigen(t *testing.T) {
+	a := [][]float64{{4, 1, 2}, {1, 3, 0}, {2, 0, 5}}
+	values, vectors := symmetricEigen(a)
+	for i := 1; i < len(values); i++ {
+		if values[i] > values[i-1] {
+			t.Errorf("eigenvalues not sorted: %v", values)
+		}
+	}
+	checkEigenvectors(t, a, values, vectors)
+	checkMatricesClose(t, matMul(transpose(vectors), vectors), identityMatrix(3))
+}
+
+func TestRealEigen(t *testing.T) {
+	a := [][]float64{{2, 1, 0}, {0.5, 3, 1}, {0, 0.2, 0.5}}
+	values, vectors := realEigen(a)
+	checkEigenvectors(t, a, values, vectors)
+}
+
+func checkEigenvectors(t *testing.T, a [][]float64, values []float64, vectors [][]float64) {
+	cols := transpose(vectors)
+	for i, vec := range cols {
+		product := matVec(a, vec)
+		for j, x := range product {
+			if math.Abs(x-values[i]*vec[j]) > 1e-6 {
+				t.Errorf("eigenvector %d: expected %v to be %f times %v", i, product, values[i],
+					vec)
+				break
+			}
+		}
+	}
+}
+
+func checkMatricesClose(t *testing.T, actual, expected [][]float64) {
+	for i, row := range expected {
+		for j, x := range row {
+			if math.Abs(actual[i][j]-x) > 1e-6 {
+				t.Errorf("expected %v but got %v", expected, actual)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package hmm
+
+import "math/rand"
+
+// MiniBatchEM trains an HMM on a dataset using mini-batch
+// stepwise EM.
+//
+// Each epoch shuffles the dataset and splits it into
+// mini-batches.
+// The expected statistics of each mini-batch are computed
+// in parallel and interpolated into running statistics,
+// from which the parameters are re-estimated.
+// See OnlineEM for details.
+//
+// Like BaumWelch, MiniBatchEM requires a TabularEmitter.
+type MiniBatchEM struct {
+	// BatchSize is the number of sequences per mini-batch.
+	// If it is 0, then 32 is used.
+	BatchSize int
+
+	// Epochs is the number of passes over the dataset.
+	// If it is 0, then 1 is used.
+	Epochs int
+
+	// Schedule determines the step size for each
+	// mini-batch, counting across epochs.
+	// If nil, PowerSchedule(2, 0.7) is used.
+	Schedule StepSchedule
+
+	// Parallelism is the number of sequences to process
+	// concurrently.
+	// If it is 0, then GOMAXPROCS is used.
+	Parallelism int
+
+	// Gen, if non-nil, is used to shuffle the dataset.
+	Gen *rand.Rand
+
+	// AfterEpoch, if non-nil, is called with the current
+	// model at the end of each epoch.
+	AfterEpoch func(epoch int, h *HMM)
+}
+
+// Train runs mini-batch EM starting at h and returns the
+// trained model.
+func (m *MiniBatchEM) Train(h *HMM, data [][]Obs) *HMM {
+	batchSize := m.BatchSize
+	if batchSize == 0 {
+		batchSize = 32
+	}
+	epochs := m.Epochs
+	if epochs == 0 {
+		epochs = 1
+	}
+	online := &OnlineEM{
+		HMM:         h,
+		Schedule:    m.Schedule,
+		Parallelism: m.Parallelism,
+	}
+	for epoch := 0; epoch < epochs; epoch++ {
+		var perm []int
+		if m.Gen != nil {
+			perm = m.Gen.Perm(len(data))
+		} else {
+			perm = rand.Perm(len(data))
+		}
+		for i := 0; i < len(perm); i += batchSize {
+			var batch [][]Obs
+			for j := i; j < i+batchSize && j < len(perm); j++ {
+				batch = append(batch, data[perm[j]])
+			}
+			online.Step(batch)
+		}
+		if m.AfterEpoch != nil {
+			m.AfterEpoch(epoch, online.HMM)
+		}
+	}
+	return online.HMM
+}
@@ -0,0 +1,44 @@
+package hmm
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestMiniBatchEM(t *testing.T) {
+	gen := rand.New(rand.NewSource(1337))
+	target := testingHMM()
+	var samples [][]Obs
+	for i := 0; i < 200; i++ {
+		_, obs := target.Sample(gen)
+		samples = append(samples, obs)
+	}
+	logLikelihood := func(h *HMM) float64 {
+		var sum float64
+		for _, sample := range samples {
+			sum += LogLikelihood(h, sample)
+		}
+		return sum
+	}
+
+	initial := RandomHMM(gen, target.States, target.TerminalState, []Obs{"x", "y", "z"})
+	var epochs []int
+	trainer := &MiniBatchEM{
+		BatchSize: 20,
+		Epochs:    4,
+		Gen:       gen,
+		AfterEpoch: func(epoch int, h *HMM) {
+			epochs = append(epochs, epoch)
+		},
+	}
+	trained := trainer.Train(initial, samples)
+
+	if len(epochs) != 4 || epochs[3] != 3 {
+		t.Errorf("unexpected epoch callbacks: %v", epochs)
+	}
+	initialLikelihood := logLikelihood(initial)
+	finalLikelihood := logLikelihood(trained)
+	if finalLikelihood < initialLikelihood {
+		t.Errorf("likelihood decreased from %f to %f", initialLikelihood, finalLikelihood)
+	}
+}
@@ -0,0 +1,56 @@
+package hmm
+
+// A PartialObs is a vector observation for which only some
+// of the components were observed.
+//
+// Partial observations may only be used with emitters that
+// implement PartialEmitter.
+type PartialObs struct {
+	// Obs is the underlying observation.
+	// The values of missing components are ignored.
+	Obs Obs
+
+	// Observed indicates which components of Obs are
+	// present.
+	Observed []bool
+}
+
+// A PartialEmitter is an Emitter which can marginalize out
+// the missing components of a vector observation.
+type PartialEmitter interface {
+	Emitter
+
+	// PartialLogProbs is like LogProbs, but only the
+	// components of obs marked in observed are used.
+	// The remaining components are marginalized out.
+	PartialLogProbs(obs Obs, observed []bool, states ...State) []float64
+}
+
+// emissionLogProbs is like Emitter.LogProbs, except that it
+// supports missing and partially missing observations.
+//
+// A missing (nil) observation has probability 1 under
+// every state.
+func emissionLogProbs(e Emitter, obs Obs, states ...State) []float64 {
+	if obs == nil {
+		return make([]float64, len(states))
+	}
+	if partial, ok := obs.(PartialObs); ok {
+		pe, ok := e.(PartialEmitter)
+		if !ok {
+			panic("emitter cannot marginalize partial observations")
+		}
+		return pe.PartialLogProbs(partial.Obs, partial.Observed, states...)
+	}
+	return e.LogProbs(obs, states...)
+}
+
+// isMissing checks if an observation is at least partially
+// missing.
+func isMissing(obs Obs) bool {
+	if obs == nil {
+		return true
+	}
+	_, ok := obs.(PartialObs)
+	return ok
+}
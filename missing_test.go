@@ -0,0 +1,146 @@
+package hmm
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestMissingLogLikelihood(t *testing.T) {
+	h := testingHMM()
+	seq := []Obs{"x", nil, "y", nil}
+	expected := math.Inf(-1)
+	for _, o1 := range []Obs{"x", "y", "z"} {
+		for _, o2 := range []Obs{"x", "y", "z"} {
+			expected = addLogs(expected, LogLikelihood(h, []Obs{"x", o1, "y", o2}))
+		}
+	}
+	actual := LogLikelihood(h, seq)
+	if math.Abs(actual-expected) > 1e-4 {
+		t.Errorf("expected %f but got %f", expected, actual)
+	}
+	actual = NewForwardBackward(h, seq).LogLikelihood()
+	if math.Abs(actual-expected) > 1e-4 {
+		t.Errorf("expected %f but got %f", expected, actual)
+	}
+	if path := MostLikely(h, seq); len(path) != len(seq) {
+		t.Errorf("unexpected path: %v", path)
+	}
+}
+
+func TestMissingBaumWelch(t *testing.T) {
+	states := []State{0, 1, 2, 3}
+	obses := []Obs{"a", "b", "c"}
+	samples := [][]Obs{{"a", nil, "c"}, {nil, "b"}, {"c", "a", nil, "b"}}
+	h := RandomHMM(nil, states, 3, obses)
+	logLikelihood := func() float64 {
+		var sum float64
+		for _, sample := range samples {
+			sum += LogLikelihood(h, sample)
+		}
+		return sum
+	}
+	for i := 0; i < 3; i++ {
+		ch := make(chan []Obs, len(samples))
+		for _, sample := range samples {
+			ch <- sample
+		}
+		close(ch)
+		oldLikelihood := logLikelihood()
+		h = BaumWelch(h, ch, 0)
+		newLikelihood := logLikelihood()
+		if newLikelihood < oldLikelihood {
+			t.Errorf("expected new likelihood (%f) to be greater than %f", newLikelihood,
+				oldLikelihood)
+		}
+	}
+	for state, dist := range h.Emitter.(TabularEmitter) {
+		if _, ok := dist[nil]; ok {
+			t.Errorf("state %v emits missing observations", state)
+		}
+	}
+}
+
+func TestPartialObs(t *testing.T) {
+	h := gaussianTestingHMM()
+	seq := []Obs{
+		PartialObs{Obs: []float64{0.5, 0}, Observed: []bool{true, false}},
+		[]float64{-1, 2},
+		PartialObs{Obs: []float64{0, 1}, Observed: []bool{false, true}},
+	}
+
+	marginal := gaussianTestingHMM()
+	marginalSeq := []Obs{[]float64{0.5}, []float64{-1, 2}, []float64{1}}
+	var steps []GaussianEmitter
+	for _, observed := range [][]bool{{true, false}, {true, true}, {false, true}} {
+		emitter := GaussianEmitter{}
+		for state, dist := range h.Emitter.(GaussianEmitter) {
+			sub := &Gaussian{}
+			for i, present := range observed {
+				if present {
+					sub.Mean = append(sub.Mean, dist.Mean[i])
+					sub.Var = append(sub.Var, dist.Var[i])
+				}
+			}
+			emitter[state] = sub
+		}
+		steps = append(steps, emitter)
+	}
+	marginal.Emitter = timestepEmitter(steps)
+
+	expected := LogLikelihood(marginal, timestepObs(marginalSeq))
+	actual := LogLikelihood(h, seq)
+	if math.Abs(actual-expected) > 1e-4 {
+		t.Errorf("expected %f but got %f", expected, actual)
+	}
+}
+
+// timestepEmitter uses a different emitter at each
+// timestep, to be used with observations produced by
+// timestepObs.
+type timestepEmitter []GaussianEmitter
+
+func (t timestepEmitter) Sample(gen *rand.Rand, state State) Obs {
+	panic("not implemented")
+}
+
+func (t timestepEmitter) LogProbs(obs Obs, states ...State) []float64 {
+	o := obs.(timestepObsValue)
+	return t[o.Time].LogProbs(o.Value, states...)
+}
+
+type timestepObsValue struct {
+	Time  int
+	Value []float64
+}
+
+func timestepObs(seq []Obs) []Obs {
+	var res []Obs
+	for i, obs := range seq {
+		res = append(res, timestepObsValue{Time: i, Value: obs.([]float64)})
+	}
+	return res
+}
+
+func gaussianTestingHMM() *HMM {
+	return &HMM{
+		States: []State{"A", "B", "T"},
+		Emitter: GaussianEmitter{
+			"A": &Gaussian{Mean: []float64{0, 1}, Var: []float64{1, 2}},
+			"B": &Gaussian{Mean: []float64{-1, 0.5}, Var: []float64{0.5, 1}},
+		},
+		TerminalState: "T",
+		Init: map[State]float64{
+			"A": math.Log(0.3),
+			"B": math.Log(0.7),
+		},
+		Transitions: map[Transition]float64{
+			Transition{From: "A", To: "A"}: math.Log(0.5),
+			Transition{From: "A", To: "B"}: math.Log(0.3),
+			Transition{From: "A", To: "T"}: math.Log(0.2),
+			Transition{From: "B", To: "A"}: math.Log(0.4),
+			Transition{From: "B", To: "B"}: math.Log(0.4),
+			Transition{From: "B", To: "T"}: math.Log(0.2),
+		},
+	}
+}
@@ -0,0 +1,186 @@
+package hmm
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/serializer"
+)
+
+func init() {
+	serializer.RegisterTypedDeserializer(MixtureEmitter{}.SerializerType(),
+		DeserializeMixtureEmitter)
+}
+
+// A GaussianMixture is a weighted mixture of Gaussians
+// with diagonal covariance matrices.
+type GaussianMixture struct {
+	// LogWeights stores the log probability of each
+	// component.
+	LogWeights []float64
+
+	Components []*Gaussian
+}
+
+// LogProb computes the log density of the vector x.
+func (g *GaussianMixture) LogProb(x []float64) float64 {
+	return g.PartialLogProb(x, nil)
+}
+
+// PartialLogProb computes the marginal log density of the
+// components of x marked in observed.
+// If observed is nil, all the components are used.
+func (g *GaussianMixture) PartialLogProb(x []float64, observed []bool) float64 {
+	if len(g.LogWeights) != len(g.Components) {
+		panic("mismatching weights and components")
+	}
+	res := math.Inf(-1)
+	for i, comp := range g.Components {
+		res = addLogs(res, g.LogWeights[i]+comp.PartialLogProb(x, observed))
+	}
+	return res
+}
+
+// Sample samples a vector from the distribution.
+func (g *GaussianMixture) Sample(gen *rand.Rand) []float64 {
+	return g.Components[sampleLogIndex(gen, g.LogWeights)].Sample(gen)
+}
+
+// A MixtureEmitter is an Emitter which produces vector
+// observations from a Gaussian mixture for each state.
+//
+// Like GaussianEmitter, it uses []float64 observations and
+// implements PartialEmitter.
+type MixtureEmitter map[State]*GaussianMixture
+
+// DeserializeMixtureEmitter deserializes a
+// MixtureEmitter.
+func DeserializeMixtureEmitter(d []byte) (m MixtureEmitter, err error) {
+	defer essentials.AddCtxTo("deserialize MixtureEmitter", &err)
+	var states []serializer.Serializer
+	var numComps []int
+	var weights []float64
+	var means []float64
+	var vars []float64
+	err = serializer.DeserializeAny(d, &states, &numComps, &weights, &means, &vars)
+	if err != nil {
+		return nil, err
+	}
+	if len(numComps) != len(states) || len(means) != len(vars) ||
+		(len(weights) == 0 && len(means) != 0) ||
+		(len(weights) != 0 && len(means)%len(weights) != 0) {
+		return nil, errors.New("mismatching slice lengths")
+	} else if !serializersComparable(states) {
+		return nil, errors.New("State not comparable")
+	}
+	var totalComps int
+	for _, n := range numComps {
+		if n < 0 {
+			return nil, errors.New("negative component count")
+		}
+		totalComps += n
+	}
+	if totalComps != len(weights) {
+		return nil, errors.New("mismatching slice lengths")
+	}
+	m = MixtureEmitter{}
+	if totalComps == 0 {
+		return m, nil
+	}
+	dim := len(means) / totalComps
+	var compIdx int
+	for i, state := range states {
+		mixture := &GaussianMixture{}
+		for j := 0; j < numComps[i]; j++ {
+			mixture.LogWeights = append(mixture.LogWeights, weights[compIdx])
+			mixture.Components = append(mixture.Components, &Gaussian{
+				Mean: means[compIdx*dim : (compIdx+1)*dim],
+				Var:  vars[compIdx*dim : (compIdx+1)*dim],
+			})
+			compIdx++
+		}
+		m[fromSerializer(state)] = mixture
+	}
+	return m, nil
+}
+
+// Sample samples an observation from the state.
+func (m MixtureEmitter) Sample(gen *rand.Rand, state State) Obs {
+	dist, ok := m[state]
+	if !ok {
+		panic("no entries for the given state")
+	}
+	return dist.Sample(gen)
+}
+
+// LogProbs computes the conditional log densities.
+//
+// States without a mixture have a probability of 0.
+func (m MixtureEmitter) LogProbs(obs Obs, states ...State) []float64 {
+	return m.PartialLogProbs(obs, nil, states...)
+}
+
+// PartialLogProbs computes the marginal log densities of
+// the observed components of obs.
+func (m MixtureEmitter) PartialLogProbs(obs Obs, observed []bool,
+	states ...State) []float64 {
+	vec := obs.([]float64)
+	res := make([]float64, len(states))
+	for i, state := range states {
+		if dist, ok := m[state]; ok {
+			res[i] = dist.PartialLogProb(vec, observed)
+		} else {
+			res[i] = math.Inf(-1)
+		}
+	}
+	return res
+}
+
+// SerializerType returns the unique ID used to serialize
+// a MixtureEmitter with the serializer package.
+func (m MixtureEmitter) SerializerType() string {
+	return "github.com/unixpickle/hmm.MixtureEmitter"
+}
+
+// Serialize serializes the MixtureEmitter.
+//
+// For this to work, the states must either implement
+// serializer.Serializer or be plain comparable values (see
+// HMM.Serialize), and every Gaussian must have the same
+// dimensionality.
+//
+// States are written in a canonical order, so the same
+// MixtureEmitter always produces the same bytes.
+func (m MixtureEmitter) Serialize() (data []byte, err error) {
+	defer essentials.AddCtxTo("serialize MixtureEmitter", &err)
+	var rawStates []interface{}
+	for state := range m {
+		rawStates = append(rawStates, state)
+	}
+	sortedStates, states, err := sortedSerializers(rawStates)
+	if err != nil {
+		return nil, err
+	}
+	var numComps []int
+	var weights []float64
+	var means []float64
+	var vars []float64
+	for _, state := range sortedStates {
+		dist := m[state]
+		if len(dist.LogWeights) != len(dist.Components) {
+			return nil, errors.New("mismatching weights and components")
+		}
+		numComps = append(numComps, len(dist.Components))
+		for i, comp := range dist.Components {
+			if len(weights) > 0 && len(comp.Mean) != len(means)/len(weights) {
+				return nil, errors.New("mismatching dimensions")
+			}
+			weights = append(weights, dist.LogWeights[i])
+			means = append(means, comp.Mean...)
+			vars = append(vars, comp.Var...)
+		}
+	}
+	return serializer.SerializeAny(states, numComps, weights, means, vars)
+}
@@ -0,0 +1,73 @@
+package hmm
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/unixpickle/serializer"
+)
+
+func TestGaussianMixtureLogProb(t *testing.T) {
+	g := testingMixture()
+	x := []float64{0.5, -1}
+	expected := math.Log(0.3*normalDensity(0.5, 1, 2)*normalDensity(-1, -2, 0.5) +
+		0.7*normalDensity(0.5, 0, 1)*normalDensity(-1, 1, 3))
+	if actual := g.LogProb(x); math.Abs(actual-expected) > 1e-8 {
+		t.Errorf("expected %f but got %f", expected, actual)
+	}
+	expected = math.Log(0.3*normalDensity(-1, -2, 0.5) + 0.7*normalDensity(-1, 1, 3))
+	if actual := g.PartialLogProb(x, []bool{false, true}); math.Abs(actual-expected) > 1e-8 {
+		t.Errorf("expected %f but got %f", expected, actual)
+	}
+}
+
+func TestGaussianMixtureSample(t *testing.T) {
+	gen := rand.New(rand.NewSource(1337))
+	g := testingMixture()
+	var mean float64
+	const numSamples = 20000
+	for i := 0; i < numSamples; i++ {
+		mean += g.Sample(gen)[1] / numSamples
+	}
+	if expected := 0.3*-2 + 0.7*1; math.Abs(mean-expected) > 0.05 {
+		t.Errorf("expected mean %f but got %f", expected, mean)
+	}
+}
+
+func TestMixtureEmitterSerialize(t *testing.T) {
+	e1 := MixtureEmitter{
+		"A": testingMixture(),
+		"B": &GaussianMixture{
+			LogWeights: []float64{0},
+			Components: []*Gaussian{{Mean: []float64{-1, 0}, Var: []float64{1, 0.5}}},
+		},
+	}
+	data, err := serializer.SerializeAny(e1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e2 MixtureEmitter
+	if err := serializer.DeserializeAny(data, &e2); err != nil {
+		t.Fatal(err)
+	}
+	obs := []float64{0.5, 1.5}
+	states := []State{"A", "B", "C"}
+	probs1 := e1.LogProbs(obs, states...)
+	probs2 := e2.LogProbs(obs, states...)
+	for i, p1 := range probs1 {
+		if p1 != probs2[i] && math.Abs(p1-probs2[i]) > 1e-8 {
+			t.Errorf("state %v: expected %f but got %f", states[i], p1, probs2[i])
+		}
+	}
+}
+
+func testingMixture() *GaussianMixture {
+	return &GaussianMixture{
+		LogWeights: []float64{math.Log(0.3), math.Log(0.7)},
+		Components: []*Gaussian{
+			{Mean: []float64{1, -2}, Var: []float64{2, 0.5}},
+			{Mean: []float64{0, 1}, Var: []float64{1, 3}},
+		},
+	}
+}
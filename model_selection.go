@@ -0,0 +1,223 @@
+package hmm
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// A ParamCounter is an Emitter which can count its free
+// parameters.
+type ParamCounter interface {
+	NumParams() int
+}
+
+// NumParams counts the free parameters of an HMM.
+//
+// Absent transitions and initial states, as well as those
+// with zero probability, are not counted.
+// Each distribution contributes one fewer parameter than
+// its number of entries, since it must sum to 1.
+// The terminal state and silent states have no emission
+// parameters.
+//
+// The HMM's Emitter must implement ParamCounter.
+func NumParams(h *HMM) int {
+	counter, ok := h.Emitter.(ParamCounter)
+	if !ok {
+		panic(fmt.Sprintf("cannot count parameters of %T", h.Emitter))
+	}
+	res := emittingRows(h, counter).NumParams()
+
+	var initCount int
+	for _, prob := range h.Init {
+		if !math.IsInf(prob, -1) {
+			initCount++
+		}
+	}
+	res += distParams(initCount)
+
+	fromCounts := map[State]int{}
+	for trans, prob := range h.Transitions {
+		if !math.IsInf(prob, -1) {
+			fromCounts[trans.From]++
+		}
+	}
+	for _, count := range fromCounts {
+		res += distParams(count)
+	}
+	return res
+}
+
+// emittingRows removes the rows of the terminal state and
+// silent states from the built-in emitters, since they may
+// contain entries which are never used.
+func emittingRows(h *HMM, counter ParamCounter) ParamCounter {
+	skip := silentSet(h)
+	if h.TerminalState != nil {
+		skip[h.TerminalState] = true
+	}
+	switch emitter := counter.(type) {
+	case TabularEmitter:
+		res := TabularEmitter{}
+		for state, row := range emitter {
+			if !skip[state] {
+				res[state] = row
+			}
+		}
+		return res
+	case GaussianEmitter:
+		res := GaussianEmitter{}
+		for state, dist := range emitter {
+			if !skip[state] {
+				res[state] = dist
+			}
+		}
+		return res
+	case MixtureEmitter:
+		res := MixtureEmitter{}
+		for state, dist := range emitter {
+			if !skip[state] {
+				res[state] = dist
+			}
+		}
+		return res
+	}
+	return counter
+}
+
+// NumParams counts the free parameters of the emitter.
+func (t TabularEmitter) NumParams() int {
+	var res int
+	for _, dist := range t {
+		var count int
+		for _, prob := range dist {
+			if !math.IsInf(prob, -1) {
+				count++
+			}
+		}
+		res += distParams(count)
+	}
+	return res
+}
+
+// NumParams counts the free parameters of the emitter.
+func (g GaussianEmitter) NumParams() int {
+	var res int
+	for _, dist := range g {
+		res += len(dist.Mean) + len(dist.Var)
+	}
+	return res
+}
+
+// NumParams counts the free parameters of the emitter.
+func (m MixtureEmitter) NumParams() int {
+	var res int
+	for _, dist := range m {
+		res += distParams(len(dist.Components))
+		for _, comp := range dist.Components {
+			res += len(comp.Mean) + len(comp.Var)
+		}
+	}
+	return res
+}
+
+// AIC computes the Akaike information criterion from a
+// log-likelihood and the number of free parameters.
+// Lower values are better.
+func AIC(logLikelihood float64, numParams int) float64 {
+	return 2*float64(numParams) - 2*logLikelihood
+}
+
+// BIC computes the Bayesian information criterion from a
+// log-likelihood, the number of free parameters, and the
+// number of observations.
+// Lower values are better.
+func BIC(logLikelihood float64, numParams, numObs int) float64 {
+	return float64(numParams)*math.Log(float64(numObs)) - 2*logLikelihood
+}
+
+// StateCountSelection chooses the number of hidden states
+// by training a model for each candidate count and scoring
+// it with an information criterion.
+type StateCountSelection struct {
+	// MinStates and MaxStates are the inclusive bounds on
+	// the number of states to try.
+	MinStates int
+	MaxStates int
+
+	// Init creates the initial model for a number of
+	// states, e.g. using RandomHMM.
+	Init func(numStates int) *HMM
+
+	// Iterations is the number of BaumWelch steps for each
+	// model.
+	Iterations int
+
+	// UseAIC selects AIC for ranking instead of BIC.
+	UseAIC bool
+
+	// Parallelism is passed to BaumWelch.
+	Parallelism int
+}
+
+// A ModelScore describes a trained model from a
+// StateCountSelection.
+type ModelScore struct {
+	NumStates int
+	HMM       *HMM
+
+	// LogLikelihood is the training log-likelihood.
+	LogLikelihood float64
+
+	NumParams int
+	AIC       float64
+	BIC       float64
+}
+
+// Run trains and scores a model for each state count.
+// The results are sorted from best to worst according to
+// the chosen criterion.
+//
+// For BIC, the number of observations is the total
+// number of timesteps in the data.
+func (s *StateCountSelection) Run(data [][]Obs) []*ModelScore {
+	var numObs int
+	for _, seq := range data {
+		numObs += len(seq)
+	}
+
+	var res []*ModelScore
+	for n := s.MinStates; n <= s.MaxStates; n++ {
+		h := s.Init(n)
+		for i := 0; i < s.Iterations; i++ {
+			h = BaumWelch(h, obsChan(data), s.Parallelism)
+		}
+		score := &ModelScore{
+			NumStates:     n,
+			HMM:           h,
+			LogLikelihood: totalLogLikelihood(h, data),
+			NumParams:     NumParams(h),
+		}
+		score.AIC = AIC(score.LogLikelihood, score.NumParams)
+		score.BIC = BIC(score.LogLikelihood, score.NumParams, numObs)
+		res = append(res, score)
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		if s.UseAIC {
+			return res[i].AIC < res[j].AIC
+		}
+		return res[i].BIC < res[j].BIC
+	})
+	return res
+}
+
+// distParams computes the number of free parameters in a
+// distribution with the given number of outcomes.
+func distParams(numOutcomes int) int {
+	if numOutcomes == 0 {
+		return 0
+	}
+	return numOutcomes - 1
+}
@@ -0,0 +1,76 @@
+package hmm
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestNumParams(t *testing.T) {
+	h := testingHMM()
+	// Init: 3 - 1 = 2
+	// Transitions: (3 - 1) + (4 - 1) + (4 - 1) = 8
+	// Emissions: (2 - 1) + (3 - 1) + (3 - 1) = 5
+	if actual := NumParams(h); actual != 15 {
+		t.Errorf("expected 15 but got %d", actual)
+	}
+
+	h.Transitions[Transition{From: "A", To: "D"}] = math.Inf(-1)
+	if actual := NumParams(h); actual != 15 {
+		t.Errorf("expected 15 but got %d", actual)
+	}
+
+	h = silentTestingHMM()
+	// Init: 1, Transitions: 2 + 1 + 2, Emissions: 1 + 1
+	// The unused rows of S and T are not counted.
+	emitter := h.Emitter.(TabularEmitter)
+	for _, state := range []State{"S", "T"} {
+		emitter[state] = map[Obs]float64{"x": math.Log(0.5), "y": math.Log(0.5)}
+	}
+	if actual := NumParams(h); actual != 8 {
+		t.Errorf("expected 8 but got %d", actual)
+	}
+
+	h = gaussianTestingHMM()
+	// Init: 1, Transitions: 2 + 2, Emissions: 4 + 4
+	if actual := NumParams(h); actual != 13 {
+		t.Errorf("expected 13 but got %d", actual)
+	}
+}
+
+func TestStateCountSelection(t *testing.T) {
+	gen := rand.New(rand.NewSource(1337))
+	target := testingHMM()
+	var data [][]Obs
+	var numObs int
+	for i := 0; i < 50; i++ {
+		_, obs := target.Sample(gen)
+		data = append(data, obs)
+		numObs += len(obs)
+	}
+
+	s := &StateCountSelection{
+		MinStates: 1,
+		MaxStates: 4,
+		Init: func(numStates int) *HMM {
+			states := []State{"end"}
+			for i := 0; i < numStates; i++ {
+				states = append(states, i)
+			}
+			return RandomHMM(gen, states, "end", []Obs{"x", "y", "z"})
+		},
+		Iterations: 5,
+	}
+	res := s.Run(data)
+	if len(res) != 4 {
+		t.Fatalf("expected 4 results but got %d", len(res))
+	}
+	for i, score := range res {
+		if expected := BIC(score.LogLikelihood, score.NumParams, numObs); score.BIC != expected {
+			t.Errorf("expected BIC %f but got %f", expected, score.BIC)
+		}
+		if i > 0 && score.BIC < res[i-1].BIC {
+			t.Errorf("results are not sorted by BIC")
+		}
+	}
+}
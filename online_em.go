@@ -0,0 +1,175 @@
+package hmm
+
+import "math"
+
+// A StepSchedule determines the step size for each update
+// of an incremental trainer.
+// Steps are numbered starting at 0.
+type StepSchedule func(step int) float64
+
+// PowerSchedule creates a StepSchedule which decays like
+// (step+offset)^-decay.
+//
+// For stepwise EM to converge, decay should be in the
+// range (0.5, 1], and offset should be at least 1.
+func PowerSchedule(offset, decay float64) StepSchedule {
+	return func(step int) float64 {
+		return math.Pow(float64(step)+offset, -decay)
+	}
+}
+
+// OnlineEM trains an HMM with stepwise EM.
+//
+// Rather than collecting statistics over the entire
+// dataset, OnlineEM maintains a running average of the
+// expected statistics from each mini-batch, and updates
+// the model after every mini-batch.
+// Thus, it is suitable for datasets which do not fit in
+// memory and for never-ending data streams.
+//
+// Like BaumWelch, OnlineEM requires a TabularEmitter.
+type OnlineEM struct {
+	// HMM is the current model.
+	// It is replaced after every step.
+	HMM *HMM
+
+	// Schedule determines the weight of each mini-batch in
+	// the running statistics.
+	// If nil, PowerSchedule(2, 0.7) is used.
+	Schedule StepSchedule
+
+	// Parallelism is the number of sequences to process
+	// concurrently.
+	// If it is 0, then GOMAXPROCS is used.
+	Parallelism int
+
+	// NumSteps is the number of steps taken so far.
+	NumSteps int
+
+	stats *baumWelch
+}
+
+// NewOnlineEM creates an OnlineEM starting at the model h.
+func NewOnlineEM(h *HMM) *OnlineEM {
+	return &OnlineEM{HMM: h}
+}
+
+// Step updates the model with a mini-batch of sequences.
+func (o *OnlineEM) Step(batch [][]Obs) {
+	if len(batch) == 0 {
+		return
+	}
+	data := make(chan []Obs, len(batch))
+	for _, seq := range batch {
+		data <- seq
+	}
+	close(data)
+	batchStats := baumWelchWorkers(o.HMM, o.Parallelism, func(bw *baumWelch) {
+		for sample := range data {
+			bw.Accumulate(sample, nil, 1)
+		}
+	})
+	batchStats.expandSilent()
+
+	schedule := o.Schedule
+	if schedule == nil {
+		schedule = PowerSchedule(2, 0.7)
+	}
+	stepSize := math.Min(1, schedule(o.NumSteps))
+	if o.stats == nil || stepSize == 1 {
+		o.stats = newBaumWelch(o.HMM)
+	}
+	o.stats.Interpolate(batchStats, math.Log(1-stepSize),
+		math.Log(stepSize/float64(len(batch))))
+	o.NumSteps++
+
+	snapshot := o.stats.Copy()
+	snapshot.HMM = o.HMM
+	snapshot.normalizeTallies()
+	o.HMM = snapshot.Result()
+}
+
+// Run reads sequences from data in mini-batches of the
+// given size, taking a step for each mini-batch, until
+// data is closed.
+// A final, smaller mini-batch is used for any leftover
+// sequences.
+//
+// If afterStep is non-nil, it is called with the new
+// model after every step.
+func (o *OnlineEM) Run(data <-chan []Obs, batchSize int, afterStep func(h *HMM)) {
+	var batch [][]Obs
+	step := func() {
+		o.Step(batch)
+		batch = nil
+		if afterStep != nil {
+			afterStep(o.HMM)
+		}
+	}
+	for seq := range data {
+		batch = append(batch, seq)
+		if len(batch) == batchSize {
+			step()
+		}
+	}
+	if len(batch) > 0 {
+		step()
+	}
+}
+
+// Interpolate sets the statistics in b to a linear
+// combination of the statistics in b and other, using the
+// given log coefficients.
+//
+// Both b and other should have expanded silent states.
+func (b *baumWelch) Interpolate(other *baumWelch, coeff, otherCoeff float64) {
+	mix := func(dst, src *fastStateMap) {
+		dst.AddAll(coeff)
+		src.Iter(func(state int, val float64) {
+			dst.AddLog(state, val+otherCoeff)
+		})
+	}
+	mix(b.InitTally, other.InitTally)
+	b.InitTotal = addLogs(b.InitTotal+coeff, other.InitTotal+otherCoeff)
+	for i, tally := range b.TransTally {
+		mix(tally, other.TransTally[i])
+	}
+	mix(b.FromStateTotals, other.FromStateTotals)
+	for i, tally := range b.EmitTally {
+		for obs := range tally {
+			tally[obs] += coeff
+		}
+		for obs, val := range other.EmitTally[i] {
+			addToObs(tally, obs, val+otherCoeff)
+		}
+	}
+	mix(b.EmitTotals, other.EmitTotals)
+}
+
+// Copy creates a deep copy of the statistics in b.
+func (b *baumWelch) Copy() *baumWelch {
+	res := &baumWelch{
+		HMM:           b.HMM,
+		Cache:         b.Cache,
+		TerminalIndex: b.TerminalIndex,
+
+		InitTally: b.InitTally.Copy(),
+		InitTotal: b.InitTotal,
+
+		TransTally:      make([]*fastStateMap, len(b.TransTally)),
+		FromStateTotals: b.FromStateTotals.Copy(),
+
+		EmitTally:  make([]map[Obs]float64, len(b.EmitTally)),
+		EmitTotals: b.EmitTotals.Copy(),
+	}
+	for i, tally := range b.TransTally {
+		res.TransTally[i] = tally.Copy()
+	}
+	for i, tally := range b.EmitTally {
+		res.EmitTally[i] = map[Obs]float64{}
+		for obs, val := range tally {
+			res.EmitTally[i][obs] = val
+		}
+	}
+	return res
+}
@@ -0,0 +1,71 @@
+package hmm
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestPowerSchedule(t *testing.T) {
+	schedule := PowerSchedule(2, 0.5)
+	for step, expected := range []float64{1 / math.Sqrt(2), 1 / math.Sqrt(3), 0.5} {
+		if actual := schedule(step); math.Abs(actual-expected) > 1e-8 {
+			t.Errorf("step %d: expected %f but got %f", step, expected, actual)
+		}
+	}
+}
+
+func TestOnlineEM(t *testing.T) {
+	gen := rand.New(rand.NewSource(1337))
+	target := testingHMM()
+	var samples [][]Obs
+	for i := 0; i < 200; i++ {
+		_, obs := target.Sample(gen)
+		samples = append(samples, obs)
+	}
+	logLikelihood := func(h *HMM) float64 {
+		var sum float64
+		for _, sample := range samples {
+			sum += LogLikelihood(h, sample)
+		}
+		return sum
+	}
+
+	initial := RandomHMM(gen, target.States, target.TerminalState, []Obs{"x", "y", "z"})
+	o := NewOnlineEM(initial)
+	for epoch := 0; epoch < 5; epoch++ {
+		data := make(chan []Obs, len(samples))
+		for _, sample := range samples {
+			data <- sample
+		}
+		close(data)
+		var numSteps int
+		o.Run(data, 16, func(h *HMM) {
+			numSteps++
+		})
+		if numSteps != 13 {
+			t.Errorf("expected 13 steps but got %d", numSteps)
+		}
+	}
+
+	initialLikelihood := logLikelihood(initial)
+	finalLikelihood := logLikelihood(o.HMM)
+	if finalLikelihood < initialLikelihood {
+		t.Errorf("likelihood decreased from %f to %f", initialLikelihood, finalLikelihood)
+	}
+
+	for state, prob := range o.HMM.Init {
+		if math.IsNaN(prob) {
+			t.Errorf("initial state %v has NaN probability", state)
+		}
+	}
+	transSums := map[State]float64{}
+	for trans, prob := range o.HMM.Transitions {
+		transSums[trans.From] += math.Exp(prob)
+	}
+	for state, sum := range transSums {
+		if math.Abs(sum-1) > 1e-4 {
+			t.Errorf("transitions from %v sum to %f", state, sum)
+		}
+	}
+}
@@ -1,20 +1,71 @@
 package hmm
 
-import "math"
+import (
+	"math"
+	"sort"
+)
 
 // hmmCache caches a fast transition matrix and a state to
 // index mapping.
+//
+// If the HMM has silent states, then Init and Transitions
+// are the closure of the model over its silent states.
+// In other words, they only lead to emitting states and
+// the terminal state, and each probability accounts for
+// all of the silent paths between the two endpoints.
 type hmmCache struct {
 	S2I         map[State]int
+	Init        *fastStateMap
 	Transitions []fastTransition
+
+	// Terminal is the index of the terminal state, or -1.
+	Terminal int
+
+	// Silent indicates which states are silent.
+	// The terminal state is considered silent.
+	Silent []bool
+
+	// SilentOrder stores the non-terminal silent states in
+	// topological order.
+	SilentOrder []int
+
+	// The following fields are only set if SilentOrder is
+	// non-empty.
+	//
+	// Outgoing stores the model's actual transitions,
+	// grouped by source state.
+	//
+	// InitClosure and Closure store, for the initial
+	// distribution and each emitting state respectively,
+	// the probability of reaching every state without
+	// making an emission.
+	Outgoing    [][]fastTransition
+	InitClosure *fastStateMap
+	Closure     []*fastStateMap
 }
 
 func newHMMCache(h *HMM) *hmmCache {
 	s2i := statesToIndices(h)
-	return &hmmCache{
-		S2I:         s2i,
-		Transitions: fastTransitions(h, s2i),
+	res := &hmmCache{
+		S2I:      s2i,
+		Terminal: -1,
+		Silent:   silentMask(h, s2i),
+	}
+	if h.TerminalState != nil {
+		res.Terminal = s2i[h.TerminalState]
+	}
+	order, err := silentOrder(h, s2i, res.Silent)
+	if err != nil {
+		panic(err)
 	}
+	res.SilentOrder = order
+	if len(order) == 0 {
+		res.Init = newFastStateMapFrom(h, h.Init)
+		res.Transitions = fastTransitions(h, s2i)
+	} else {
+		res.computeClosure(h)
+	}
+	return res
 }
 
 // statesToIndices creates a mapping from states to their
@@ -38,6 +89,9 @@ type fastTransition struct {
 
 // fastTransitions converts the model's transition matrix
 // to a more efficient-to-use format.
+//
+// The transitions are sorted by state index, so that sums
+// over them are reproducible.
 func fastTransitions(h *HMM, s2i map[State]int) []fastTransition {
 	res := make([]fastTransition, 0, len(h.Transitions))
 	for trans, prob := range h.Transitions {
@@ -47,6 +101,10 @@ func fastTransitions(h *HMM, s2i map[State]int) []fastTransition {
 			Prob: prob,
 		})
 	}
+	sort.Slice(res, func(i, j int) bool {
+		t1, t2 := res[i], res[j]
+		return t1.From < t2.From || (t1.From == t2.From && t1.To < t2.To)
+	})
 	return res
 }
 
@@ -110,6 +168,15 @@ func (f *fastStateMap) AddAll(x float64) {
 	}
 }
 
+// Copy creates a copy of f.
+func (f *fastStateMap) Copy() *fastStateMap {
+	return &fastStateMap{
+		h:       f.h,
+		values:  append([]float64{}, f.values...),
+		present: append([]bool{}, f.present...),
+	}
+}
+
 // Iter iterates over the entries of f.
 func (f *fastStateMap) Iter(handler func(state int, val float64)) {
 	for i, present := range f.present {
@@ -0,0 +1,617 @@
+package hmm
+
+import (
+	"math"
+	"math/rand"
+	"runtime"
+	"sync"
+)
+
+// PairState is a hidden state in a PairHMM.
+type PairState int
+
+// These are the possible states of a PairHMM.
+const (
+	// PairMatch emits one observation from each sequence.
+	PairMatch PairState = iota
+
+	// PairInsertX emits an observation from the first
+	// sequence only.
+	PairInsertX
+
+	// PairInsertY emits an observation from the second
+	// sequence only.
+	PairInsertY
+
+	// PairEnd is the terminal state, which signals the end
+	// of both sequences.
+	PairEnd
+)
+
+const numPairEmitters = 3
+
+// An ObsPair is the observation emitted by PairMatch.
+type ObsPair struct {
+	X Obs
+	Y Obs
+}
+
+// A SeqPair is a pair of unaligned observation sequences.
+type SeqPair struct {
+	X []Obs
+	Y []Obs
+}
+
+// An AlignedPair is one column of an alignment.
+// X and Y are indices into the two sequences.
+// An index of -1 indicates a gap.
+type AlignedPair struct {
+	X int
+	Y int
+}
+
+// A PairHMM is a hidden Markov model which jointly emits
+// two observation sequences, implicitly aligning them.
+type PairHMM struct {
+	// Emitter produces an ObsPair for PairMatch, and a
+	// single observation for PairInsertX and PairInsertY.
+	Emitter Emitter
+
+	// Init stores the initial state distribution.
+	// It maps states to log probabilities.
+	// If a state is absent, it has 0 probability.
+	//
+	// An initial PairEnd produces two empty sequences.
+	Init map[PairState]float64
+
+	// Transitions stores the log probability for every
+	// allowed transition, where the From and To fields are
+	// PairStates.
+	// If a transition is absent, it has 0 probability.
+	//
+	// Transitions to PairEnd end both sequences.
+	Transitions map[Transition]float64
+}
+
+// RandomPairHMM creates a PairHMM with random parameters
+// and a TabularEmitter.
+// The observations xObs and yObs are the possible values
+// in the first and second sequence, respectively.
+//
+// If gen is non-nil, it is used to generate all of the
+// random parameters.
+//
+// RandomPairHMM may be used to generate starting points
+// for PairBaumWelch.
+func RandomPairHMM(gen *rand.Rand, xObs, yObs []Obs) *PairHMM {
+	res := &PairHMM{
+		Emitter:     TabularEmitter{},
+		Init:        map[PairState]float64{},
+		Transitions: map[Transition]float64{},
+	}
+	allStates := []PairState{PairMatch, PairInsertX, PairInsertY, PairEnd}
+	for i, prob := range randomDist(gen, len(allStates)) {
+		res.Init[allStates[i]] = prob
+	}
+	for _, from := range allStates[:numPairEmitters] {
+		for i, prob := range randomDist(gen, len(allStates)) {
+			res.Transitions[Transition{From: from, To: allStates[i]}] = prob
+		}
+	}
+
+	emitter := res.Emitter.(TabularEmitter)
+	var pairs []Obs
+	for _, x := range xObs {
+		for _, y := range yObs {
+			pairs = append(pairs, ObsPair{X: x, Y: y})
+		}
+	}
+	for state, obses := range map[PairState][]Obs{
+		PairMatch:   pairs,
+		PairInsertX: xObs,
+		PairInsertY: yObs,
+	} {
+		emitter[state] = map[Obs]float64{}
+		for i, prob := range randomDist(gen, len(obses)) {
+			emitter[state][obses[i]] = prob
+		}
+	}
+	return res
+}
+
+// PairLogLikelihood computes the log-likelihood of the
+// pair of sequences, marginalizing over all alignments.
+func PairLogLikelihood(p *PairHMM, x, y []Obs) float64 {
+	return newPairLattice(p, x, y).Forward()
+}
+
+// PairMostLikely returns the most probable alignment of
+// the two sequences.
+//
+// If no alignment can explain the sequences, nil is
+// returned.
+func PairMostLikely(p *PairHMM, x, y []Obs) []AlignedPair {
+	l := newPairLattice(p, x, y)
+
+	// Store, for each state and position, the best log
+	// probability and the previous state on the best path.
+	// A previous state of -1 indicates the start.
+	var probs [numPairEmitters][][]float64
+	var prevs [numPairEmitters][][]PairState
+	for s := range probs {
+		probs[s] = l.newTable()
+		prevs[s] = make([][]PairState, len(x)+1)
+		for i := range prevs[s] {
+			prevs[s][i] = make([]PairState, len(y)+1)
+		}
+	}
+
+	for i := 0; i <= len(x); i++ {
+		for j := 0; j <= len(y); j++ {
+			for s := PairState(0); s < numPairEmitters; s++ {
+				pi, pj, ok := pairPrevCell(s, i, j)
+				if !ok {
+					continue
+				}
+				best := math.Inf(-1)
+				bestPrev := PairState(-1)
+				if pi == 0 && pj == 0 {
+					best = l.Init[s]
+				} else {
+					for prev := PairState(0); prev < numPairEmitters; prev++ {
+						prob := probs[prev][pi][pj] + l.Trans[prev][s]
+						if prob > best {
+							best = prob
+							bestPrev = prev
+						}
+					}
+				}
+				probs[s][i][j] = best + l.emission(s, i, j)
+				prevs[s][i][j] = bestPrev
+			}
+		}
+	}
+
+	best := l.Init[PairEnd]
+	bestState := PairState(-1)
+	if len(x) > 0 || len(y) > 0 {
+		best = math.Inf(-1)
+		for s := PairState(0); s < numPairEmitters; s++ {
+			prob := probs[s][len(x)][len(y)] + l.Trans[s][PairEnd]
+			if prob > best {
+				best = prob
+				bestState = s
+			}
+		}
+	}
+	if math.IsInf(best, -1) {
+		return nil
+	}
+
+	res := []AlignedPair{}
+	i, j := len(x), len(y)
+	for state := bestState; state >= 0; {
+		col := AlignedPair{X: -1, Y: -1}
+		if state != PairInsertY {
+			col.X = i - 1
+		}
+		if state != PairInsertX {
+			col.Y = j - 1
+		}
+		res = append(res, col)
+		prev := prevs[state][i][j]
+		i, j, _ = pairPrevCell(state, i, j)
+		state = prev
+	}
+	for i := 0; i < len(res)/2; i++ {
+		res[i], res[len(res)-(i+1)] = res[len(res)-(i+1)], res[i]
+	}
+	return res
+}
+
+// PairForwardBackward stores the results of the forward
+// and backward algorithms on a PairHMM.
+type PairForwardBackward struct {
+	// Algorithm inputs.
+	PairHMM *PairHMM
+	X       []Obs
+	Y       []Obs
+
+	lattice       *pairLattice
+	logLikelihood float64
+	forward       [numPairEmitters][][]float64
+	backward      [numPairEmitters][][]float64
+}
+
+// NewPairForwardBackward runs the forward-backward
+// algorithm on the pair of sequences.
+func NewPairForwardBackward(p *PairHMM, x, y []Obs) *PairForwardBackward {
+	l := newPairLattice(p, x, y)
+	res := &PairForwardBackward{
+		PairHMM: p,
+		X:       x,
+		Y:       y,
+		lattice: l,
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		res.logLikelihood = l.Forward()
+		res.forward = l.ForwardTables
+		wg.Done()
+	}()
+	go func() {
+		res.backward = l.Backward()
+		wg.Done()
+	}()
+	wg.Wait()
+	return res
+}
+
+// LogLikelihood returns the log-likelihood of the pair of
+// sequences.
+func (p *PairForwardBackward) LogLikelihood() float64 {
+	return p.logLikelihood
+}
+
+// MatchProb returns the log posterior probability that
+// p.X[i] is aligned to p.Y[j].
+func (p *PairForwardBackward) MatchProb(i, j int) float64 {
+	return p.stateProb(PairMatch, i+1, j+1)
+}
+
+// stateProb computes the log posterior probability that
+// the state emitted the cell (i, j).
+func (p *PairForwardBackward) stateProb(state PairState, i, j int) float64 {
+	return p.forward[state][i][j] + p.backward[state][i][j] - p.logLikelihood
+}
+
+// PairBaumWelch applies a step of the Baum-Welch algorithm
+// to the PairHMM, using unaligned sequence pairs.
+// It returns a new *PairHMM with updated parameters.
+//
+// The parallelism argument specifies the number of
+// samples to process concurrently.
+// If it is 0, then GOMAXPROCS is used.
+//
+// The PairHMM must use a TabularEmitter.
+func PairBaumWelch(p *PairHMM, data <-chan SeqPair, parallelism int) *PairHMM {
+	if parallelism == 0 {
+		parallelism = runtime.GOMAXPROCS(0)
+	}
+	bw := newPairBaumWelch()
+	var wg sync.WaitGroup
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			for sample := range data {
+				bw.Accumulate(NewPairForwardBackward(p, sample.X, sample.Y))
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	return bw.Result()
+}
+
+type pairBaumWelch struct {
+	InitTally  map[State]float64
+	TransTally map[Transition]float64
+	EmitTally  [numPairEmitters]map[Obs]float64
+
+	UpdateLock sync.Mutex
+}
+
+func newPairBaumWelch() *pairBaumWelch {
+	res := &pairBaumWelch{
+		InitTally:  map[State]float64{},
+		TransTally: map[Transition]float64{},
+	}
+	for i := range res.EmitTally {
+		res.EmitTally[i] = map[Obs]float64{}
+	}
+	return res
+}
+
+func (b *pairBaumWelch) Accumulate(fb *PairForwardBackward) {
+	if math.IsInf(fb.logLikelihood, -1) {
+		return
+	}
+	l := fb.lattice
+
+	initTally := map[State]float64{}
+	transTally := map[Transition]float64{}
+	var emitTally [numPairEmitters]map[Obs]float64
+	for i := range emitTally {
+		emitTally[i] = map[Obs]float64{}
+	}
+
+	if len(fb.X) == 0 && len(fb.Y) == 0 {
+		initTally[PairEnd] = 0
+	}
+
+	for i := 0; i <= len(fb.X); i++ {
+		for j := 0; j <= len(fb.Y); j++ {
+			for s := PairState(0); s < numPairEmitters; s++ {
+				pi, pj, ok := pairPrevCell(s, i, j)
+				if !ok {
+					continue
+				}
+				prob := fb.stateProb(s, i, j)
+				if math.IsInf(prob, -1) {
+					continue
+				}
+				addToObs(emitTally[s], l.obs(s, i, j), prob)
+				if pi == 0 && pj == 0 {
+					prob := l.Init[s] + l.emission(s, i, j) + fb.backward[s][i][j] -
+						fb.logLikelihood
+					addToState(initTally, s, prob)
+					continue
+				}
+				for prev := PairState(0); prev < numPairEmitters; prev++ {
+					prob := fb.forward[prev][pi][pj] + l.Trans[prev][s] +
+						l.emission(s, i, j) + fb.backward[s][i][j] - fb.logLikelihood
+					addToTransition(transTally, Transition{From: prev, To: s}, prob)
+				}
+			}
+		}
+	}
+	if len(fb.X) > 0 || len(fb.Y) > 0 {
+		for s := PairState(0); s < numPairEmitters; s++ {
+			prob := fb.forward[s][len(fb.X)][len(fb.Y)] + l.Trans[s][PairEnd] -
+				fb.logLikelihood
+			addToTransition(transTally, Transition{From: s, To: PairEnd}, prob)
+		}
+	}
+
+	b.UpdateLock.Lock()
+	defer b.UpdateLock.Unlock()
+	for state, prob := range initTally {
+		addToState(b.InitTally, state, prob)
+	}
+	for trans, prob := range transTally {
+		addToTransition(b.TransTally, trans, prob)
+	}
+	for i, tally := range emitTally {
+		for obs, prob := range tally {
+			addToObs(b.EmitTally[i], obs, prob)
+		}
+	}
+}
+
+func (b *pairBaumWelch) Result() *PairHMM {
+	res := &PairHMM{
+		Emitter:     TabularEmitter{},
+		Init:        map[PairState]float64{},
+		Transitions: map[Transition]float64{},
+	}
+
+	initTotal := math.Inf(-1)
+	for _, prob := range b.InitTally {
+		initTotal = addLogs(initTotal, prob)
+	}
+	for state, prob := range b.InitTally {
+		res.Init[state.(PairState)] = prob - initTotal
+	}
+
+	fromTotals := map[State]float64{}
+	for trans, prob := range b.TransTally {
+		addToState(fromTotals, trans.From, prob)
+	}
+	for trans, prob := range b.TransTally {
+		res.Transitions[trans] = prob - fromTotals[trans.From]
+	}
+
+	emitter := res.Emitter.(TabularEmitter)
+	for state, tally := range b.EmitTally {
+		total := math.Inf(-1)
+		for _, prob := range tally {
+			total = addLogs(total, prob)
+		}
+		dist := map[Obs]float64{}
+		for obs, prob := range tally {
+			dist[obs] = prob - total
+		}
+		emitter[PairState(state)] = dist
+	}
+
+	return res
+}
+
+// pairLattice caches the parameters and emission
+// probabilities needed for dynamic programming over a
+// pair of sequences.
+//
+// Cell (i, j) of a table corresponds to the point after
+// i observations from X and j observations from Y.
+type pairLattice struct {
+	X []Obs
+	Y []Obs
+
+	Init  [numPairEmitters + 1]float64
+	Trans [numPairEmitters][numPairEmitters + 1]float64
+
+	MatchProbs   [][]float64
+	InsertXProbs []float64
+	InsertYProbs []float64
+
+	ForwardTables [numPairEmitters][][]float64
+}
+
+func newPairLattice(p *PairHMM, x, y []Obs) *pairLattice {
+	res := &pairLattice{X: x, Y: y}
+	for s := range res.Init {
+		if prob, ok := p.Init[PairState(s)]; ok {
+			res.Init[s] = prob
+		} else {
+			res.Init[s] = math.Inf(-1)
+		}
+	}
+	for from := range res.Trans {
+		for to := range res.Trans[from] {
+			t := Transition{From: PairState(from), To: PairState(to)}
+			if prob, ok := p.Transitions[t]; ok {
+				res.Trans[from][to] = prob
+			} else {
+				res.Trans[from][to] = math.Inf(-1)
+			}
+		}
+	}
+	res.InsertXProbs = make([]float64, len(x))
+	for i, obs := range x {
+		res.InsertXProbs[i] = p.Emitter.LogProbs(obs, PairInsertX)[0]
+	}
+	res.InsertYProbs = make([]float64, len(y))
+	for j, obs := range y {
+		res.InsertYProbs[j] = p.Emitter.LogProbs(obs, PairInsertY)[0]
+	}
+	res.MatchProbs = make([][]float64, len(x))
+	for i, xObs := range x {
+		res.MatchProbs[i] = make([]float64, len(y))
+		for j, yObs := range y {
+			pair := ObsPair{X: xObs, Y: yObs}
+			res.MatchProbs[i][j] = p.Emitter.LogProbs(pair, PairMatch)[0]
+		}
+	}
+	return res
+}
+
+// Forward runs the forward algorithm, filling in
+// ForwardTables and returning the log-likelihood.
+//
+// Each table entry is the joint probability of the
+// observations up to the cell and of the state which
+// emitted the cell's final observation(s).
+func (l *pairLattice) Forward() float64 {
+	for s := range l.ForwardTables {
+		l.ForwardTables[s] = l.newTable()
+	}
+	for i := 0; i <= len(l.X); i++ {
+		for j := 0; j <= len(l.Y); j++ {
+			for s := PairState(0); s < numPairEmitters; s++ {
+				pi, pj, ok := pairPrevCell(s, i, j)
+				if !ok {
+					continue
+				}
+				prior := math.Inf(-1)
+				if pi == 0 && pj == 0 {
+					prior = l.Init[s]
+				} else {
+					for prev := PairState(0); prev < numPairEmitters; prev++ {
+						prob := l.ForwardTables[prev][pi][pj] + l.Trans[prev][s]
+						prior = addLogs(prior, prob)
+					}
+				}
+				l.ForwardTables[s][i][j] = prior + l.emission(s, i, j)
+			}
+		}
+	}
+
+	if len(l.X) == 0 && len(l.Y) == 0 {
+		return l.Init[PairEnd]
+	}
+	sum := math.Inf(-1)
+	for s := PairState(0); s < numPairEmitters; s++ {
+		prob := l.ForwardTables[s][len(l.X)][len(l.Y)] + l.Trans[s][PairEnd]
+		sum = addLogs(sum, prob)
+	}
+	return sum
+}
+
+// Backward runs the backward algorithm.
+//
+// Each table entry is the probability of the observations
+// after the cell, given the state which emitted the
+// cell's final observation(s).
+func (l *pairLattice) Backward() [numPairEmitters][][]float64 {
+	var res [numPairEmitters][][]float64
+	for s := range res {
+		res[s] = l.newTable()
+	}
+	for i := len(l.X); i >= 0; i-- {
+		for j := len(l.Y); j >= 0; j-- {
+			for s := PairState(0); s < numPairEmitters; s++ {
+				if i == len(l.X) && j == len(l.Y) {
+					res[s][i][j] = l.Trans[s][PairEnd]
+					continue
+				}
+				sum := math.Inf(-1)
+				for next := PairState(0); next < numPairEmitters; next++ {
+					ni, nj := pairNextCell(next, i, j)
+					if ni > len(l.X) || nj > len(l.Y) {
+						continue
+					}
+					prob := l.Trans[s][next] + l.emission(next, ni, nj) + res[next][ni][nj]
+					sum = addLogs(sum, prob)
+				}
+				res[s][i][j] = sum
+			}
+		}
+	}
+	return res
+}
+
+// emission gets the log probability of the observation(s)
+// emitted by the state when arriving at cell (i, j).
+func (l *pairLattice) emission(s PairState, i, j int) float64 {
+	switch s {
+	case PairMatch:
+		return l.MatchProbs[i-1][j-1]
+	case PairInsertX:
+		return l.InsertXProbs[i-1]
+	default:
+		return l.InsertYProbs[j-1]
+	}
+}
+
+// obs gets the observation emitted by the state when
+// arriving at cell (i, j).
+func (l *pairLattice) obs(s PairState, i, j int) Obs {
+	switch s {
+	case PairMatch:
+		return ObsPair{X: l.X[i-1], Y: l.Y[j-1]}
+	case PairInsertX:
+		return l.X[i-1]
+	default:
+		return l.Y[j-1]
+	}
+}
+
+func (l *pairLattice) newTable() [][]float64 {
+	res := make([][]float64, len(l.X)+1)
+	for i := range res {
+		res[i] = make([]float64, len(l.Y)+1)
+		for j := range res[i] {
+			res[i][j] = math.Inf(-1)
+		}
+	}
+	return res
+}
+
+// pairPrevCell finds the cell that precedes (i, j) when
+// the given state arrives at (i, j).
+// If the state cannot arrive at (i, j), ok is false.
+func pairPrevCell(s PairState, i, j int) (pi, pj int, ok bool) {
+	switch s {
+	case PairMatch:
+		pi, pj = i-1, j-1
+	case PairInsertX:
+		pi, pj = i-1, j
+	default:
+		pi, pj = i, j-1
+	}
+	return pi, pj, pi >= 0 && pj >= 0
+}
+
+// pairNextCell finds the cell reached from (i, j) by
+// entering the given state.
+func pairNextCell(s PairState, i, j int) (ni, nj int) {
+	switch s {
+	case PairMatch:
+		return i + 1, j + 1
+	case PairInsertX:
+		return i + 1, j
+	default:
+		return i, j + 1
+	}
+}
@@ -0,0 +1,191 @@
+package hmm
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestPairLogLikelihood(t *testing.T) {
+	p := testingPairHMM()
+	for _, pair := range testingSeqPairs() {
+		expected := math.Inf(-1)
+		enumeratePairAlignments(p, pair.X, pair.Y, func(a []AlignedPair, prob float64) {
+			expected = addLogs(expected, prob)
+		})
+		actual := PairLogLikelihood(p, pair.X, pair.Y)
+		if math.Abs(actual-expected) > 1e-4 {
+			t.Errorf("pair %v: expected %f but got %f", pair, expected, actual)
+		}
+		actual = NewPairForwardBackward(p, pair.X, pair.Y).LogLikelihood()
+		if math.Abs(actual-expected) > 1e-4 {
+			t.Errorf("pair %v: expected %f but got %f", pair, expected, actual)
+		}
+	}
+}
+
+func TestPairMostLikely(t *testing.T) {
+	p := testingPairHMM()
+	for _, pair := range testingSeqPairs() {
+		var expected []AlignedPair
+		bestProb := math.Inf(-1)
+		enumeratePairAlignments(p, pair.X, pair.Y, func(a []AlignedPair, prob float64) {
+			if prob > bestProb {
+				bestProb = prob
+				expected = a
+			}
+		})
+		actual := PairMostLikely(p, pair.X, pair.Y)
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("pair %v: expected %v but got %v", pair, expected, actual)
+		}
+	}
+}
+
+func TestPairMatchProb(t *testing.T) {
+	p := testingPairHMM()
+	pair := SeqPair{X: []Obs{"a", "b", "a"}, Y: []Obs{"b", "a"}}
+
+	expected := make([][]float64, len(pair.X))
+	for i := range expected {
+		expected[i] = make([]float64, len(pair.Y))
+	}
+	var total float64
+	enumeratePairAlignments(p, pair.X, pair.Y, func(a []AlignedPair, prob float64) {
+		total += math.Exp(prob)
+		for _, col := range a {
+			if col.X >= 0 && col.Y >= 0 {
+				expected[col.X][col.Y] += math.Exp(prob)
+			}
+		}
+	})
+
+	fb := NewPairForwardBackward(p, pair.X, pair.Y)
+	for i, row := range expected {
+		for j, prob := range row {
+			actual := math.Exp(fb.MatchProb(i, j))
+			if math.Abs(actual-prob/total) > 1e-4 {
+				t.Errorf("match (%d, %d): expected %f but got %f", i, j, prob/total, actual)
+			}
+		}
+	}
+}
+
+func TestPairBaumWelch(t *testing.T) {
+	obses := []Obs{"a", "b"}
+	p := RandomPairHMM(rand.New(rand.NewSource(1337)), obses, obses)
+	pairs := testingSeqPairs()
+	logLikelihood := func() float64 {
+		var sum float64
+		for _, pair := range pairs {
+			sum += PairLogLikelihood(p, pair.X, pair.Y)
+		}
+		return sum
+	}
+	for i := 0; i < 3; i++ {
+		data := make(chan SeqPair, len(pairs))
+		for _, pair := range pairs {
+			data <- pair
+		}
+		close(data)
+		oldLikelihood := logLikelihood()
+		p = PairBaumWelch(p, data, 0)
+		newLikelihood := logLikelihood()
+		if newLikelihood < oldLikelihood {
+			t.Errorf("expected new likelihood (%f) to be greater than %f", newLikelihood,
+				oldLikelihood)
+		}
+	}
+}
+
+func testingPairHMM() *PairHMM {
+	return &PairHMM{
+		Emitter: TabularEmitter{
+			PairMatch: map[Obs]float64{
+				ObsPair{X: "a", Y: "a"}: math.Log(0.4),
+				ObsPair{X: "a", Y: "b"}: math.Log(0.1),
+				ObsPair{X: "b", Y: "a"}: math.Log(0.1),
+				ObsPair{X: "b", Y: "b"}: math.Log(0.4),
+			},
+			PairInsertX: map[Obs]float64{
+				"a": math.Log(0.3),
+				"b": math.Log(0.7),
+			},
+			PairInsertY: map[Obs]float64{
+				"a": math.Log(0.6),
+				"b": math.Log(0.4),
+			},
+		},
+		Init: map[PairState]float64{
+			PairMatch:   math.Log(0.7),
+			PairInsertX: math.Log(0.1),
+			PairInsertY: math.Log(0.15),
+			PairEnd:     math.Log(0.05),
+		},
+		Transitions: map[Transition]float64{
+			Transition{From: PairMatch, To: PairMatch}:   math.Log(0.7),
+			Transition{From: PairMatch, To: PairInsertX}: math.Log(0.1),
+			Transition{From: PairMatch, To: PairInsertY}: math.Log(0.1),
+			Transition{From: PairMatch, To: PairEnd}:     math.Log(0.1),
+
+			Transition{From: PairInsertX, To: PairMatch}:   math.Log(0.5),
+			Transition{From: PairInsertX, To: PairInsertX}: math.Log(0.3),
+			Transition{From: PairInsertX, To: PairEnd}:     math.Log(0.2),
+
+			Transition{From: PairInsertY, To: PairMatch}:   math.Log(0.6),
+			Transition{From: PairInsertY, To: PairInsertY}: math.Log(0.2),
+			Transition{From: PairInsertY, To: PairEnd}:     math.Log(0.2),
+		},
+	}
+}
+
+func testingSeqPairs() []SeqPair {
+	return []SeqPair{
+		{},
+		{X: []Obs{"a"}},
+		{X: []Obs{"a", "b"}, Y: []Obs{"b"}},
+		{X: []Obs{"a", "b", "a"}, Y: []Obs{"b", "a"}},
+		{X: []Obs{"b", "b"}, Y: []Obs{"a", "b", "b"}},
+	}
+}
+
+// enumeratePairAlignments calls f with every alignment of
+// the two sequences and its joint log probability.
+func enumeratePairAlignments(p *PairHMM, x, y []Obs, f func([]AlignedPair, float64)) {
+	var rec func(i, j int, prev PairState, prob float64, a []AlignedPair)
+	rec = func(i, j int, prev PairState, prob float64, a []AlignedPair) {
+		param := func(s PairState) float64 {
+			var res float64
+			var ok bool
+			if prev < 0 {
+				res, ok = p.Init[s]
+			} else {
+				res, ok = p.Transitions[Transition{From: prev, To: s}]
+			}
+			if !ok {
+				return math.Inf(-1)
+			}
+			return res
+		}
+		if i == len(x) && j == len(y) {
+			f(append([]AlignedPair{}, a...), prob+param(PairEnd))
+		}
+		if i < len(x) && j < len(y) {
+			emission := p.Emitter.LogProbs(ObsPair{X: x[i], Y: y[j]}, PairMatch)[0]
+			rec(i+1, j+1, PairMatch, prob+param(PairMatch)+emission,
+				append(a, AlignedPair{X: i, Y: j}))
+		}
+		if i < len(x) {
+			emission := p.Emitter.LogProbs(x[i], PairInsertX)[0]
+			rec(i+1, j, PairInsertX, prob+param(PairInsertX)+emission,
+				append(a, AlignedPair{X: i, Y: -1}))
+		}
+		if j < len(y) {
+			emission := p.Emitter.LogProbs(y[j], PairInsertY)[0]
+			rec(i, j+1, PairInsertY, prob+param(PairInsertY)+emission,
+				append(a, AlignedPair{X: -1, Y: j}))
+		}
+	}
+	rec(0, 0, -1, 0, []AlignedPair{})
+}
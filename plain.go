@@ -0,0 +1,378 @@
+package hmm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sync"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/serializer"
+)
+
+func init() {
+	serializer.RegisterTypedDeserializer(plainValue{}.SerializerType(), deserializePlainValue)
+}
+
+// Type tags for plainValue encodings.
+const (
+	plainString byte = iota
+	plainBool
+	plainInt
+	plainInt8
+	plainInt16
+	plainInt32
+	plainInt64
+	plainUint
+	plainUint8
+	plainUint16
+	plainUint32
+	plainUint64
+	plainFloat32
+	plainFloat64
+	plainNamed
+)
+
+var (
+	plainTypesLock sync.RWMutex
+	plainTypes     = map[string]reflect.Type{}
+
+	plainBuiltins = map[reflect.Kind]reflect.Type{
+		reflect.String:  reflect.TypeOf(""),
+		reflect.Bool:    reflect.TypeOf(false),
+		reflect.Int:     reflect.TypeOf(int(0)),
+		reflect.Int8:    reflect.TypeOf(int8(0)),
+		reflect.Int16:   reflect.TypeOf(int16(0)),
+		reflect.Int32:   reflect.TypeOf(int32(0)),
+		reflect.Int64:   reflect.TypeOf(int64(0)),
+		reflect.Uint:    reflect.TypeOf(uint(0)),
+		reflect.Uint8:   reflect.TypeOf(uint8(0)),
+		reflect.Uint16:  reflect.TypeOf(uint16(0)),
+		reflect.Uint32:  reflect.TypeOf(uint32(0)),
+		reflect.Uint64:  reflect.TypeOf(uint64(0)),
+		reflect.Float32: reflect.TypeOf(float32(0)),
+		reflect.Float64: reflect.TypeOf(float64(0)),
+	}
+)
+
+// RegisterType registers a named type so that its values
+// can be serialized as states or observations.
+//
+// The type must be based on a string, bool, or number, or
+// be a struct whose fields are all exported and based on
+// these types or on other such structs.
+// Struct fields are registered automatically.
+//
+// Values are encoded field by field under the type's
+// package path and name, so the encoding is the same in
+// every process.
+func RegisterType(value interface{}) {
+	if err := registerType(reflect.TypeOf(value)); err != nil {
+		panic(err)
+	}
+}
+
+func registerType(t reflect.Type) error {
+	if t == nil || t.Name() == "" {
+		return fmt.Errorf("cannot register unnamed type %v", t)
+	}
+	if _, ok := plainBuiltins[t.Kind()]; !ok {
+		if t.Kind() != reflect.Struct {
+			return fmt.Errorf("cannot register %v: unsupported kind %v", t, t.Kind())
+		}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				return fmt.Errorf("cannot register %v: unexported field %s", t, field.Name)
+			}
+			if _, ok := plainBuiltins[field.Type.Kind()]; !ok {
+				if err := registerType(field.Type); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	name := plainTypeName(t)
+	plainTypesLock.Lock()
+	defer plainTypesLock.Unlock()
+	if old, ok := plainTypes[name]; ok && old != t {
+		return fmt.Errorf("type name %s registered twice", name)
+	}
+	plainTypes[name] = t
+	return nil
+}
+
+func plainTypeName(t reflect.Type) string {
+	return t.PkgPath() + "." + t.Name()
+}
+
+func lookupPlainType(name string) (reflect.Type, bool) {
+	plainTypesLock.RLock()
+	defer plainTypesLock.RUnlock()
+	t, ok := plainTypes[name]
+	return t, ok
+}
+
+// plainValue wraps a state or observation which does not
+// implement serializer.Serializer, so that it can be
+// serialized anyway.
+//
+// Builtin strings, bools, and numbers are encoded
+// directly.
+// Values of other types, such as small structs, are
+// encoded under their type name, so their types must be
+// registered with RegisterType.
+type plainValue struct {
+	Value interface{}
+}
+
+func deserializePlainValue(d []byte) (p plainValue, err error) {
+	defer essentials.AddCtxTo("deserialize plain value", &err)
+	if len(d) == 0 {
+		return p, errors.New("missing type tag")
+	}
+	tag, body := d[0], d[1:]
+	switch tag {
+	case plainString:
+		return plainValue{Value: string(body)}, nil
+	case plainBool:
+		if len(body) != 1 {
+			return p, errors.New("invalid bool")
+		}
+		return plainValue{Value: body[0] != 0}, nil
+	case plainInt, plainInt8, plainInt16, plainInt32, plainInt64:
+		x, n := binary.Varint(body)
+		if n <= 0 || n != len(body) {
+			return p, errors.New("invalid integer")
+		}
+		switch tag {
+		case plainInt:
+			return plainValue{Value: int(x)}, nil
+		case plainInt8:
+			return plainValue{Value: int8(x)}, nil
+		case plainInt16:
+			return plainValue{Value: int16(x)}, nil
+		case plainInt32:
+			return plainValue{Value: int32(x)}, nil
+		}
+		return plainValue{Value: x}, nil
+	case plainUint, plainUint8, plainUint16, plainUint32, plainUint64:
+		x, n := binary.Uvarint(body)
+		if n <= 0 || n != len(body) {
+			return p, errors.New("invalid integer")
+		}
+		switch tag {
+		case plainUint:
+			return plainValue{Value: uint(x)}, nil
+		case plainUint8:
+			return plainValue{Value: uint8(x)}, nil
+		case plainUint16:
+			return plainValue{Value: uint16(x)}, nil
+		case plainUint32:
+			return plainValue{Value: uint32(x)}, nil
+		}
+		return plainValue{Value: x}, nil
+	case plainFloat32:
+		if len(body) != 4 {
+			return p, errors.New("invalid float32")
+		}
+		return plainValue{Value: math.Float32frombits(binary.BigEndian.Uint32(body))}, nil
+	case plainFloat64:
+		if len(body) != 8 {
+			return p, errors.New("invalid float64")
+		}
+		return plainValue{Value: math.Float64frombits(binary.BigEndian.Uint64(body))}, nil
+	case plainNamed:
+		value, err := decodeNamed(body)
+		if err != nil {
+			return p, err
+		}
+		return plainValue{Value: value}, nil
+	default:
+		return p, fmt.Errorf("unknown type tag: %d", tag)
+	}
+}
+
+// SerializerType returns the unique ID used to serialize
+// a plainValue with the serializer package.
+func (p plainValue) SerializerType() string {
+	return "github.com/unixpickle/hmm.plainValue"
+}
+
+// Serialize serializes the wrapped value.
+func (p plainValue) Serialize() ([]byte, error) {
+	varint := func(tag byte, x int64) []byte {
+		buf := make([]byte, binary.MaxVarintLen64)
+		return append([]byte{tag}, buf[:binary.PutVarint(buf, x)]...)
+	}
+	uvarint := func(tag byte, x uint64) []byte {
+		buf := make([]byte, binary.MaxVarintLen64)
+		return append([]byte{tag}, buf[:binary.PutUvarint(buf, x)]...)
+	}
+	switch x := p.Value.(type) {
+	case string:
+		return append([]byte{plainString}, x...), nil
+	case bool:
+		if x {
+			return []byte{plainBool, 1}, nil
+		}
+		return []byte{plainBool, 0}, nil
+	case int:
+		return varint(plainInt, int64(x)), nil
+	case int8:
+		return varint(plainInt8, int64(x)), nil
+	case int16:
+		return varint(plainInt16, int64(x)), nil
+	case int32:
+		return varint(plainInt32, int64(x)), nil
+	case int64:
+		return varint(plainInt64, x), nil
+	case uint:
+		return uvarint(plainUint, uint64(x)), nil
+	case uint8:
+		return uvarint(plainUint8, uint64(x)), nil
+	case uint16:
+		return uvarint(plainUint16, uint64(x)), nil
+	case uint32:
+		return uvarint(plainUint32, uint64(x)), nil
+	case uint64:
+		return uvarint(plainUint64, x), nil
+	case float32:
+		res := []byte{plainFloat32, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(res[1:], math.Float32bits(x))
+		return res, nil
+	case float64:
+		res := []byte{plainFloat64, 0, 0, 0, 0, 0, 0, 0, 0}
+		binary.BigEndian.PutUint64(res[1:], math.Float64bits(x))
+		return res, nil
+	}
+	if p.Value == nil {
+		return nil, errors.New("cannot serialize nil")
+	}
+	body, err := encodeNamed(reflect.ValueOf(p.Value))
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{plainNamed}, body...), nil
+}
+
+// encodeNamed encodes a value of a registered type as its
+// type name followed by its underlying value or its
+// length-prefixed fields.
+func encodeNamed(v reflect.Value) ([]byte, error) {
+	name := plainTypeName(v.Type())
+	if t, ok := lookupPlainType(name); !ok || t != v.Type() {
+		return nil, fmt.Errorf("cannot serialize %v (type not registered with RegisterType)",
+			v.Type())
+	}
+	buf := make([]byte, binary.MaxVarintLen64)
+	res := append([]byte{}, buf[:binary.PutUvarint(buf, uint64(len(name)))]...)
+	res = append(res, name...)
+
+	if builtin, ok := plainBuiltins[v.Kind()]; ok {
+		inner, err := plainValue{Value: v.Convert(builtin).Interface()}.Serialize()
+		if err != nil {
+			return nil, err
+		}
+		return append(res, inner...), nil
+	}
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if builtin, ok := plainBuiltins[field.Kind()]; ok {
+			field = field.Convert(builtin)
+		}
+		inner, err := plainValue{Value: field.Interface()}.Serialize()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, buf[:binary.PutUvarint(buf, uint64(len(inner)))]...)
+		res = append(res, inner...)
+	}
+	return res, nil
+}
+
+// decodeNamed undoes encodeNamed.
+func decodeNamed(d []byte) (interface{}, error) {
+	r := bytes.NewReader(d)
+	readChunk := func() ([]byte, error) {
+		size, err := binary.ReadUvarint(r)
+		if err != nil || size > uint64(r.Len()) {
+			return nil, errors.New("invalid length")
+		}
+		chunk := make([]byte, size)
+		r.Read(chunk)
+		return chunk, nil
+	}
+	name, err := readChunk()
+	if err != nil {
+		return nil, err
+	}
+	t, ok := lookupPlainType(string(name))
+	if !ok {
+		return nil, fmt.Errorf("type %s not registered with RegisterType", name)
+	}
+	decodeAs := func(data []byte, target reflect.Type) (reflect.Value, error) {
+		inner, err := deserializePlainValue(data)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		value := reflect.ValueOf(inner.Value)
+		expected := target
+		if builtin, ok := plainBuiltins[target.Kind()]; ok {
+			expected = builtin
+		}
+		if value.Type() != expected {
+			return reflect.Value{}, fmt.Errorf("expected %v but got %v", expected, value.Type())
+		}
+		return value.Convert(target), nil
+	}
+
+	if _, ok := plainBuiltins[t.Kind()]; ok {
+		rest := make([]byte, r.Len())
+		r.Read(rest)
+		value, err := decodeAs(rest, t)
+		if err != nil {
+			return nil, err
+		}
+		return value.Interface(), nil
+	}
+	res := reflect.New(t).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		chunk, err := readChunk()
+		if err != nil {
+			return nil, err
+		}
+		value, err := decodeAs(chunk, t.Field(i).Type)
+		if err != nil {
+			return nil, essentials.AddCtx("field "+t.Field(i).Name, err)
+		}
+		res.Field(i).Set(value)
+	}
+	if r.Len() != 0 {
+		return nil, errors.New("unexpected trailing data")
+	}
+	return res.Interface(), nil
+}
+
+// toSerializer converts a state or observation into a
+// serializer.Serializer, wrapping it if necessary.
+func toSerializer(x interface{}) (serializer.Serializer, error) {
+	if s, ok := x.(serializer.Serializer); ok {
+		return s, nil
+	}
+	if x == nil || !reflect.TypeOf(x).Comparable() {
+		return nil, fmt.Errorf("cannot serialize %T", x)
+	}
+	return plainValue{Value: x}, nil
+}
+
+// fromSerializer undoes toSerializer.
+func fromSerializer(s serializer.Serializer) interface{} {
+	if p, ok := s.(plainValue); ok {
+		return p.Value
+	}
+	return s
+}
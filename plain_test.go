@@ -0,0 +1,181 @@
+package hmm
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+
+	"github.com/unixpickle/serializer"
+)
+
+type plainTestingStruct struct {
+	Name  string
+	Index int
+}
+
+type plainTestingName string
+
+type plainTestingNested struct {
+	Inner plainTestingStruct
+	Name  plainTestingName
+	Flag  bool
+}
+
+func init() {
+	RegisterType(plainTestingNested{})
+}
+
+func TestPlainValue(t *testing.T) {
+	values := []interface{}{
+		"", "hello", true, false,
+		int(-3), int8(-128), int16(1000), int32(-70000), int64(1 << 40),
+		uint(3), uint8(255), uint16(1000), uint32(70000), uint64(1 << 63),
+		float32(1.5), float64(-2.25),
+		plainTestingStruct{Name: "x", Index: 3},
+		plainTestingNested{Inner: plainTestingStruct{Name: "y"}, Name: "z", Flag: true},
+	}
+	for _, value := range values {
+		data, err := plainValue{Value: value}.Serialize()
+		if err != nil {
+			t.Errorf("%T: %s", value, err)
+			continue
+		}
+		decoded, err := deserializePlainValue(data)
+		if err != nil {
+			t.Errorf("%T: %s", value, err)
+		} else if decoded.Value != value {
+			t.Errorf("expected %#v but got %#v", value, decoded.Value)
+		}
+	}
+
+	for _, value := range []interface{}{nil, []int{1}, map[string]int{}} {
+		if _, err := toSerializer(value); err == nil {
+			t.Errorf("%T: expected error", value)
+		}
+	}
+	for _, data := range [][]byte{nil, {plainBool}, {plainInt, 0x80}, {plainFloat64, 1}, {0xff}} {
+		if _, err := deserializePlainValue(data); err == nil {
+			t.Errorf("%v: expected error", data)
+		}
+	}
+}
+
+func TestPlainValueNamed(t *testing.T) {
+	// The encoding must not depend on the process, so it is
+	// checked byte for byte.
+	data, err := plainValue{Value: plainTestingStruct{Name: "x", Index: 3}}.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := "github.com/unixpickle/hmm.plainTestingStruct"
+	expected := append([]byte{plainNamed, byte(len(name))}, name...)
+	expected = append(expected, 2, plainString, 'x', 2, plainInt, 6)
+	if !bytes.Equal(data, expected) {
+		t.Errorf("expected %v but got %v", expected, data)
+	}
+
+	type unregistered struct{ X int }
+	if _, err := (plainValue{Value: unregistered{}}).Serialize(); err == nil {
+		t.Error("expected error for unregistered type")
+	}
+	if _, err := (plainValue{Value: plainTestingName("x")}).Serialize(); err == nil {
+		t.Error("expected error for unregistered named type")
+	}
+	type unexported struct{ x int }
+	for _, value := range []interface{}{unexported{}, struct{ X int }{}, []int{}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%T: expected panic", value)
+				}
+			}()
+			RegisterType(value)
+		}()
+	}
+}
+
+func TestSerializePlain(t *testing.T) {
+	h := testingHMM()
+	data, err := serializer.SerializeAny(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded *HMM
+	if err := serializer.DeserializeAny(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	checkJSONModelsEqual(t, h, decoded)
+
+	structs := testingHMM()
+	renamed := map[State]State{}
+	for i, state := range structs.States {
+		renamed[state] = plainTestingStruct{Name: state.(string), Index: i}
+	}
+	structs = renameStates(structs, renamed)
+	data, err = structs.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err = DeserializeHMM(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkJSONModelsEqual(t, structs, decoded)
+
+	h.States[0] = []int{}
+	if _, err := h.Serialize(); err == nil {
+		t.Error("expected error for non-comparable state")
+	}
+}
+
+func TestSerializeGob(t *testing.T) {
+	h := silentTestingHMM()
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(h); err != nil {
+		t.Fatal(err)
+	}
+	var decoded HMM
+	if err := gob.NewDecoder(&buf).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	checkJSONModelsEqual(t, h, &decoded)
+
+	emitter := h.Emitter.(TabularEmitter)
+	data, err := emitter.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decodedEmitter TabularEmitter
+	if err := decodedEmitter.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	withEmitter := *h
+	withEmitter.Emitter = decodedEmitter
+	checkJSONModelsEqual(t, h, &withEmitter)
+}
+
+func renameStates(h *HMM, names map[State]State) *HMM {
+	res := &HMM{
+		TerminalState: names[h.TerminalState],
+		Init:          map[State]float64{},
+		Transitions:   map[Transition]float64{},
+	}
+	for _, state := range h.States {
+		res.States = append(res.States, names[state])
+	}
+	for _, state := range h.SilentStates {
+		res.SilentStates = append(res.SilentStates, names[state])
+	}
+	for state, prob := range h.Init {
+		res.Init[names[state]] = prob
+	}
+	for trans, prob := range h.Transitions {
+		res.Transitions[Transition{From: names[trans.From], To: names[trans.To]}] = prob
+	}
+	emitter := TabularEmitter{}
+	for state, row := range h.Emitter.(TabularEmitter) {
+		emitter[names[state]] = row
+	}
+	res.Emitter = emitter
+	return res
+}
@@ -0,0 +1,136 @@
+package hmm
+
+import (
+	"math"
+	"math/rand"
+	"runtime"
+	"sync"
+)
+
+// RandomRestarts trains HMMs with BaumWelch from several
+// independent RandomHMM initializations, to reduce the
+// impact of local optima.
+type RandomRestarts struct {
+	// States, TerminalState, and Obs are passed to
+	// RandomHMM to create each initialization.
+	States        []State
+	TerminalState State
+	Obs           []Obs
+
+	// NumRuns is the number of initializations.
+	NumRuns int
+
+	// Iterations is the maximum number of BaumWelch steps
+	// for each run.
+	Iterations int
+
+	// Tolerance, if non-zero, ends a run early once an
+	// iteration improves the training log-likelihood by
+	// less than Tolerance.
+	Tolerance float64
+
+	// Parallelism is the number of runs to perform
+	// concurrently.
+	// If it is 0, then GOMAXPROCS is used.
+	Parallelism int
+}
+
+// A RestartRun is the result of one run of RandomRestarts.
+type RestartRun struct {
+	// Seed is the seed used to initialize the run.
+	Seed int64
+
+	// HMM is the trained model.
+	HMM *HMM
+
+	// History stores the training log-likelihood before
+	// each iteration, followed by the final training
+	// log-likelihood.
+	History []float64
+
+	// HeldOut is the log-likelihood of the held-out data
+	// under the trained model, or 0 if there was no
+	// held-out data.
+	HeldOut float64
+}
+
+// LogLikelihood returns the final training log-likelihood
+// of the run.
+func (r *RestartRun) LogLikelihood() float64 {
+	return r.History[len(r.History)-1]
+}
+
+// Train performs every run on the training data.
+//
+// If heldOut is non-empty, the best run is the one with
+// the highest held-out log-likelihood.
+// Otherwise, the best run is the one with the highest
+// training log-likelihood.
+//
+// The seed of each run is drawn from gen in order, so the
+// results are reproducible for a given gen.
+// If gen is nil, the global routines in package rand are
+// used instead.
+func (r *RandomRestarts) Train(gen *rand.Rand, data, heldOut [][]Obs) (best *RestartRun,
+	runs []*RestartRun) {
+	runs = make([]*RestartRun, r.NumRuns)
+	for i := range runs {
+		if gen != nil {
+			runs[i] = &RestartRun{Seed: gen.Int63()}
+		} else {
+			runs[i] = &RestartRun{Seed: rand.Int63()}
+		}
+	}
+
+	parallelism := r.Parallelism
+	if parallelism == 0 {
+		parallelism = runtime.GOMAXPROCS(0)
+	}
+	runChan := make(chan *RestartRun, len(runs))
+	for _, run := range runs {
+		runChan <- run
+	}
+	close(runChan)
+	var wg sync.WaitGroup
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			for run := range runChan {
+				r.train(run, data, heldOut)
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+
+	bestScore := math.Inf(-1)
+	for _, run := range runs {
+		score := run.LogLikelihood()
+		if len(heldOut) > 0 {
+			score = run.HeldOut
+		}
+		if best == nil || score > bestScore {
+			best = run
+			bestScore = score
+		}
+	}
+	return best, runs
+}
+
+func (r *RandomRestarts) train(run *RestartRun, data, heldOut [][]Obs) {
+	gen := rand.New(rand.NewSource(run.Seed))
+	run.HMM = RandomHMM(gen, r.States, r.TerminalState, r.Obs)
+	run.History = []float64{totalLogLikelihood(run.HMM, data)}
+	for i := 0; i < r.Iterations; i++ {
+		run.HMM = BaumWelch(run.HMM, obsChan(data), 1)
+		ll := totalLogLikelihood(run.HMM, data)
+		improvement := ll - run.History[len(run.History)-1]
+		run.History = append(run.History, ll)
+		if r.Tolerance != 0 && improvement < r.Tolerance {
+			break
+		}
+	}
+	if len(heldOut) > 0 {
+		run.HeldOut = totalLogLikelihood(run.HMM, heldOut)
+	}
+}
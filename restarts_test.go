@@ -0,0 +1,49 @@
+package hmm
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestRandomRestarts(t *testing.T) {
+	gen := rand.New(rand.NewSource(1337))
+	target := testingHMM()
+	var data, heldOut [][]Obs
+	for i := 0; i < 40; i++ {
+		_, obs := target.Sample(gen)
+		if i%4 == 0 {
+			heldOut = append(heldOut, obs)
+		} else {
+			data = append(data, obs)
+		}
+	}
+
+	r := &RandomRestarts{
+		States:        target.States,
+		TerminalState: target.TerminalState,
+		Obs:           []Obs{"x", "y", "z"},
+		NumRuns:       4,
+		Iterations:    5,
+	}
+	for _, held := range [][][]Obs{nil, heldOut} {
+		best, runs := r.Train(gen, data, held)
+		if len(runs) != r.NumRuns {
+			t.Fatalf("expected %d runs but got %d", r.NumRuns, len(runs))
+		}
+		for _, run := range runs {
+			if len(run.History) != r.Iterations+1 {
+				t.Errorf("unexpected history length: %d", len(run.History))
+			}
+			for i := 1; i < len(run.History); i++ {
+				if run.History[i] < run.History[i-1]-1e-8 {
+					t.Errorf("history is not increasing: %v", run.History)
+				}
+			}
+			if held == nil && run.LogLikelihood() > best.LogLikelihood() {
+				t.Errorf("run %d beats best run %d", run.Seed, best.Seed)
+			} else if held != nil && run.HeldOut > best.HeldOut {
+				t.Errorf("run %d beats best run %d on held-out data", run.Seed, best.Seed)
+			}
+		}
+	}
+}
@@ -1,8 +1,10 @@
 package hmm
 
 import (
+	"bytes"
 	"math"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/unixpickle/serializer"
@@ -33,6 +35,127 @@ func TestSerialize(t *testing.T) {
 	}
 }
 
+func TestSerializeDeterministic(t *testing.T) {
+	h := RandomHMM(nil, []State{0, 1, 2, 3, 4, 5, 6, 7}, 7, []Obs{"a", "b", "c", "d", "e"})
+	h.SilentStates = []State{5}
+	expected, err := h.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		// Rebuild the maps so that their iteration order
+		// changes.
+		decoded, err := DeserializeHMM(expected)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual, err := decoded.Serialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(actual, expected) {
+			t.Fatal("serialized data differs between runs")
+		}
+	}
+
+	g := gaussianTestingHMM().Emitter.(GaussianEmitter)
+	expected, _ = g.Serialize()
+	for i := 0; i < 10; i++ {
+		if actual, _ := g.Serialize(); !bytes.Equal(actual, expected) {
+			t.Fatal("serialized GaussianEmitter differs between runs")
+		}
+	}
+}
+
+func TestSerializeVersions(t *testing.T) {
+	// The original encoding has seven fields and requires
+	// serializer.Serializer states and observations.
+	h := serializableHMM()
+	legacy, err := legacySerializeHMM(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DeserializeHMM(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkJSONModelsEqual(t, h, decoded)
+	if len(decoded.SilentStates) != 0 {
+		t.Errorf("unexpected silent states: %v", decoded.SilentStates)
+	}
+
+	h = silentTestingHMM()
+	data, err := h.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := data[len(writeFormatHeader(hmmFormatVersion)):]
+	newer := append(writeFormatHeader(hmmFormatVersion+1), body...)
+	_, err = DeserializeHMM(newer)
+	if err == nil || !strings.Contains(err.Error(), "unsupported format version") {
+		t.Errorf("unexpected error for newer version: %v", err)
+	}
+
+	h.Init["unknown"] = 0
+	if _, err := h.Serialize(); err == nil {
+		t.Error("expected error for unknown state")
+	}
+}
+
+// legacySerializeHMM reproduces the original, unversioned
+// encoding byte for byte.
+//
+// The states, observations, and emitter must implement
+// serializer.Serializer, and the emitter must be a
+// TabularEmitter.
+func legacySerializeHMM(h *HMM) ([]byte, error) {
+	terminalIdx := -1
+	var states []serializer.Serializer
+	var initStates []serializer.Serializer
+	var initProbs []float64
+	var transitionStates []serializer.Serializer
+	var transitionProbs []float64
+	for i, state := range h.States {
+		states = append(states, state.(serializer.Serializer))
+		if state == h.TerminalState {
+			terminalIdx = i
+		}
+	}
+	for state, prob := range h.Init {
+		initStates = append(initStates, state.(serializer.Serializer))
+		initProbs = append(initProbs, prob)
+	}
+	for trans, prob := range h.Transitions {
+		transitionStates = append(transitionStates, trans.From.(serializer.Serializer),
+			trans.To.(serializer.Serializer))
+		transitionProbs = append(transitionProbs, prob)
+	}
+	return serializer.SerializeAny(terminalIdx, states, initStates, initProbs,
+		transitionStates, transitionProbs, legacyTabularEmitter(h.Emitter.(TabularEmitter)))
+}
+
+// legacyTabularEmitter reproduces the original encoding of
+// a TabularEmitter, which wrote entries in map order.
+type legacyTabularEmitter TabularEmitter
+
+func (l legacyTabularEmitter) SerializerType() string {
+	return TabularEmitter{}.SerializerType()
+}
+
+func (l legacyTabularEmitter) Serialize() ([]byte, error) {
+	var states []serializer.Serializer
+	var obses []serializer.Serializer
+	var probs []float64
+	for state, dist := range l {
+		for obs, prob := range dist {
+			states = append(states, state.(serializer.Serializer))
+			obses = append(obses, obs.(serializer.Serializer))
+			probs = append(probs, prob)
+		}
+	}
+	return serializer.SerializeAny(states, obses, probs)
+}
+
 func serializableHMM() *HMM {
 	h := testingHMM()
 
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// A batcher runs work from concurrent requests in batches
+// on a fixed pool of workers.
+//
+// Work which arrives within a short window is grouped into
+// one batch, which bounds the number of concurrent
+// computations no matter how many requests are in flight.
+type batcher struct {
+	items   chan *batchItem
+	stop    chan struct{}
+	stopped sync.WaitGroup
+
+	workers  int
+	maxBatch int
+	window   time.Duration
+}
+
+type batchItem struct {
+	run  func()
+	done *sync.WaitGroup
+}
+
+func newBatcher(workers, maxBatch int, window time.Duration) *batcher {
+	b := &batcher{
+		items:    make(chan *batchItem, maxBatch),
+		stop:     make(chan struct{}),
+		workers:  workers,
+		maxBatch: maxBatch,
+		window:   window,
+	}
+	b.stopped.Add(1)
+	go b.loop()
+	return b
+}
+
+// Do runs the functions and waits for them to finish.
+func (b *batcher) Do(fns []func()) {
+	var wg sync.WaitGroup
+	wg.Add(len(fns))
+	for _, fn := range fns {
+		b.items <- &batchItem{run: fn, done: &wg}
+	}
+	wg.Wait()
+}
+
+// Close stops the batcher once pending work is finished.
+// Work which was queued before Close is still run, but Do
+// must not be called during or after Close.
+func (b *batcher) Close() {
+	close(b.stop)
+	b.stopped.Wait()
+}
+
+func (b *batcher) loop() {
+	defer b.stopped.Done()
+	for {
+		var batch []*batchItem
+		select {
+		case item := <-b.items:
+			batch = append(batch, item)
+		case <-b.stop:
+			b.drain()
+			return
+		}
+		var stopping bool
+		timer := time.NewTimer(b.window)
+	GatherLoop:
+		for len(batch) < b.maxBatch {
+			select {
+			case item := <-b.items:
+				batch = append(batch, item)
+			case <-timer.C:
+				break GatherLoop
+			case <-b.stop:
+				stopping = true
+				break GatherLoop
+			}
+		}
+		timer.Stop()
+		b.runBatch(batch)
+		if stopping {
+			b.drain()
+			return
+		}
+	}
+}
+
+// drain runs the work which is still queued.
+func (b *batcher) drain() {
+	for {
+		var batch []*batchItem
+	DrainLoop:
+		for len(batch) < b.maxBatch {
+			select {
+			case item := <-b.items:
+				batch = append(batch, item)
+			default:
+				break DrainLoop
+			}
+		}
+		if len(batch) == 0 {
+			return
+		}
+		b.runBatch(batch)
+	}
+}
+
+func (b *batcher) runBatch(batch []*batchItem) {
+	items := make(chan *batchItem, len(batch))
+	for _, item := range batch {
+		items <- item
+	}
+	close(items)
+	var wg sync.WaitGroup
+	for i := 0; i < b.workers && i < len(batch); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range items {
+				item.run()
+				item.done.Done()
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBatcher(t *testing.T) {
+	b := newBatcher(3, 5, time.Millisecond)
+	defer b.Close()
+
+	var running, maxRunning, total int64
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fns := make([]func(), 7)
+			for j := range fns {
+				fns[j] = func() {
+					n := atomic.AddInt64(&running, 1)
+					for {
+						old := atomic.LoadInt64(&maxRunning)
+						if n <= old || atomic.CompareAndSwapInt64(&maxRunning, old, n) {
+							break
+						}
+					}
+					time.Sleep(time.Microsecond * 100)
+					atomic.AddInt64(&running, -1)
+					atomic.AddInt64(&total, 1)
+				}
+			}
+			b.Do(fns)
+		}()
+	}
+	wg.Wait()
+	if total != 70 {
+		t.Errorf("expected 70 calls but got %d", total)
+	}
+	if maxRunning > 3 {
+		t.Errorf("expected at most 3 concurrent calls but got %d", maxRunning)
+	}
+}
+
+func TestBatcherCloseDrains(t *testing.T) {
+	// The long window keeps the items queued until Close.
+	b := newBatcher(2, 4, time.Hour)
+	var total int64
+	done := make(chan struct{})
+	go func() {
+		fns := make([]func(), 3)
+		for i := range fns {
+			fns[i] = func() {
+				atomic.AddInt64(&total, 1)
+			}
+		}
+		b.Do(fns)
+		close(done)
+	}()
+	time.Sleep(time.Millisecond * 10)
+	b.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatal("Do did not return after Close")
+	}
+	if total != 3 {
+		t.Errorf("expected 3 calls but got %d", total)
+	}
+}
@@ -0,0 +1,518 @@
+// Package server exposes HMM inference over HTTP with JSON
+// request and response bodies.
+//
+// The following endpoints are provided:
+//
+//	GET  /models         list the loaded models
+//	POST /decode         most likely hidden states
+//	POST /posterior      hidden state distributions
+//	POST /loglikelihood  log-likelihood of sequences
+//	POST /sample         sample sequences from a model
+//
+// Each POST body is a JSON object with a "model" field
+// naming the model to use.
+// The decode, posterior, and loglikelihood endpoints also
+// take a "sequences" field, which is a list of observation
+// sequences.
+// Observations may be strings, numbers, booleans, or
+// arrays of numbers (for Gaussian emitters), and null
+// observations are missing.
+//
+// Results for sequences which the model cannot produce are
+// null.
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/hmm"
+)
+
+// Default batching parameters.
+const (
+	DefaultMaxBatch    = 64
+	DefaultBatchWindow = time.Millisecond
+)
+
+// Config configures a Server.
+type Config struct {
+	// Workers is the number of sequences processed in
+	// parallel.
+	// If it is 0, then GOMAXPROCS is used.
+	Workers int
+
+	// MaxBatch is the maximum number of sequences in a
+	// batch.
+	// If it is 0, DefaultMaxBatch is used.
+	MaxBatch int
+
+	// BatchWindow is how long to wait for more work before
+	// running a batch.
+	// If it is 0, DefaultBatchWindow is used.
+	BatchWindow time.Duration
+
+	// ErrorLog, if non-nil, is used to log errors when
+	// reloading model files.
+	ErrorLog *log.Logger
+}
+
+// A Server serves inference requests for a set of named
+// models.
+//
+// A Server is an http.Handler, so it can be used with
+// http.ListenAndServe or httptest.NewServer.
+type Server struct {
+	errorLog *log.Logger
+	batcher  *batcher
+	mux      *http.ServeMux
+
+	lock   sync.RWMutex
+	models map[string]*model
+
+	watchLock sync.Mutex
+	stopWatch chan struct{}
+}
+
+type model struct {
+	HMM *hmm.HMM
+
+	// Path and ModTime are set for models loaded from
+	// files.
+	Path    string
+	ModTime time.Time
+}
+
+// New creates a Server with no models.
+// If c is nil, the default configuration is used.
+func New(c *Config) *Server {
+	if c == nil {
+		c = &Config{}
+	}
+	workers := c.Workers
+	if workers == 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	maxBatch := c.MaxBatch
+	if maxBatch == 0 {
+		maxBatch = DefaultMaxBatch
+	}
+	window := c.BatchWindow
+	if window == 0 {
+		window = DefaultBatchWindow
+	}
+	s := &Server{
+		errorLog: c.ErrorLog,
+		batcher:  newBatcher(workers, maxBatch, window),
+		mux:      http.NewServeMux(),
+		models:   map[string]*model{},
+	}
+	s.mux.HandleFunc("/models", s.handleModels)
+	s.mux.HandleFunc("/decode", s.post(s.decode))
+	s.mux.HandleFunc("/posterior", s.post(s.posterior))
+	s.mux.HandleFunc("/loglikelihood", s.post(s.logLikelihood))
+	s.mux.HandleFunc("/sample", s.post(s.sample))
+	return s
+}
+
+// AddModel adds or replaces an in-memory model.
+func (s *Server) AddModel(name string, h *hmm.HMM) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.models[name] = &model{HMM: h}
+}
+
+// LoadModel adds or replaces a model from a file.
+//
+// The file may be in the binary format of HMM.Serialize or,
+// if its name ends in ".json", in the format of
+// hmm.EncodeJSON.
+// The file is watched for changes by Reload and Watch.
+func (s *Server) LoadModel(name, path string) error {
+	m, err := loadModelFile(path)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.models[name] = m
+	return nil
+}
+
+// RemoveModel removes a model.
+func (s *Server) RemoveModel(name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.models, name)
+}
+
+// Reload reloads the model files which have changed since
+// they were loaded.
+//
+// If a file cannot be loaded, the previous version of the
+// model remains in use, and the first such error is
+// returned after trying every file.
+func (s *Server) Reload() error {
+	s.lock.RLock()
+	paths := map[string]*model{}
+	for name, m := range s.models {
+		if m.Path != "" {
+			paths[name] = m
+		}
+	}
+	s.lock.RUnlock()
+
+	var firstErr error
+	for name, old := range paths {
+		info, err := os.Stat(old.Path)
+		if err == nil && info.ModTime().Equal(old.ModTime) {
+			continue
+		}
+		var m *model
+		if err == nil {
+			m, err = loadModelFile(old.Path)
+		}
+		if err != nil {
+			err = essentials.AddCtx("reload "+name, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		s.lock.Lock()
+		if s.models[name] == old {
+			s.models[name] = m
+		}
+		s.lock.Unlock()
+	}
+	return firstErr
+}
+
+// Watch calls Reload periodically in the background,
+// logging errors to the ErrorLog, until Close is called.
+// Calling Watch again changes the interval.
+func (s *Server) Watch(interval time.Duration) {
+	s.watchLock.Lock()
+	defer s.watchLock.Unlock()
+	if s.stopWatch != nil {
+		close(s.stopWatch)
+	}
+	stop := make(chan struct{})
+	s.stopWatch = stop
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.Reload(); err != nil && s.errorLog != nil {
+					s.errorLog.Println(err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops watching model files and stops the batching
+// workers.
+// The Server must not handle requests after Close.
+func (s *Server) Close() {
+	s.watchLock.Lock()
+	if s.stopWatch != nil {
+		close(s.stopWatch)
+		s.stopWatch = nil
+	}
+	s.watchLock.Unlock()
+	s.batcher.Close()
+}
+
+// ServeHTTP handles an HTTP request.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	s.lock.RLock()
+	names := []string{}
+	for name := range s.models {
+		names = append(names, name)
+	}
+	s.lock.RUnlock()
+	sort.Strings(names)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"models": names})
+}
+
+// request is the body of a POST request.
+type request struct {
+	Model     string            `json:"model"`
+	Sequences []json.RawMessage `json:"sequences"`
+
+	// Fields for sampling.
+	// A non-zero seed makes the samples reproducible.
+	Count  int   `json:"count"`
+	MaxLen int   `json:"max_len"`
+	Seed   int64 `json:"seed"`
+}
+
+// post wraps a handler for a POST endpoint, parsing the
+// request and looking up the model.
+func (s *Server) post(handler func(h *hmm.HMM, req *request,
+	seqs [][]hmm.Obs) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		var req request
+		decoder := json.NewDecoder(r.Body)
+		decoder.UseNumber()
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, essentials.AddCtx("decode request", err))
+			return
+		}
+		s.lock.RLock()
+		m, ok := s.models[req.Model]
+		s.lock.RUnlock()
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("unknown model: %q", req.Model))
+			return
+		}
+		seqs := make([][]hmm.Obs, len(req.Sequences))
+		for i, rawSeq := range req.Sequences {
+			seq, err := decodeSequence(rawSeq)
+			if err != nil {
+				writeError(w, http.StatusBadRequest,
+					essentials.AddCtx(fmt.Sprintf("sequence %d", i), err))
+				return
+			}
+			seqs[i] = seq
+		}
+		res, err := handler(m.HMM, &req, seqs)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	}
+}
+
+// each runs f(0) through f(n-1) in the batcher.
+// If f panics, for example because an observation is not
+// supported by the emitter, an error is returned.
+func (s *Server) each(n int, f func(i int)) error {
+	var errLock sync.Mutex
+	var firstErr error
+	fns := make([]func(), n)
+	for i := range fns {
+		i := i
+		fns[i] = func() {
+			defer func() {
+				if r := recover(); r != nil {
+					errLock.Lock()
+					if firstErr == nil {
+						firstErr = fmt.Errorf("sequence %d: %v", i, r)
+					}
+					errLock.Unlock()
+				}
+			}()
+			f(i)
+		}
+	}
+	s.batcher.Do(fns)
+	return firstErr
+}
+
+func (s *Server) decode(h *hmm.HMM, req *request, seqs [][]hmm.Obs) (interface{}, error) {
+	res := make([][]hmm.State, len(seqs))
+	err := s.each(len(seqs), func(i int) {
+		res[i] = hmm.MostLikely(h, seqs[i])
+	})
+	return map[string]interface{}{"states": res}, err
+}
+
+// stateProb is a state and its probability.
+type stateProb struct {
+	State hmm.State `json:"state"`
+	Prob  float64   `json:"prob"`
+}
+
+func (s *Server) posterior(h *hmm.HMM, req *request, seqs [][]hmm.Obs) (interface{},
+	error) {
+	res := make([][][]stateProb, len(seqs))
+	err := s.each(len(seqs), func(i int) {
+		seq := seqs[i]
+		fb := hmm.NewForwardBackward(h, seq)
+		if math.IsInf(fb.LogLikelihood(), -1) {
+			return
+		}
+		res[i] = make([][]stateProb, len(seq))
+		for t := range seq {
+			dist := fb.Dist(t)
+			res[i][t] = []stateProb{}
+			for _, state := range h.States {
+				if prob, ok := dist[state]; ok {
+					res[i][t] = append(res[i][t], stateProb{State: state, Prob: math.Exp(prob)})
+				}
+			}
+		}
+	})
+	return map[string]interface{}{"distributions": res}, err
+}
+
+func (s *Server) logLikelihood(h *hmm.HMM, req *request, seqs [][]hmm.Obs) (interface{},
+	error) {
+	// Impossible sequences have null log-likelihoods, since
+	// JSON cannot represent -Inf.
+	res := make([]*float64, len(seqs))
+	err := s.each(len(seqs), func(i int) {
+		if ll := hmm.LogLikelihood(h, seqs[i]); !math.IsInf(ll, -1) {
+			res[i] = &ll
+		}
+	})
+	return map[string]interface{}{"log_likelihoods": res}, err
+}
+
+// sampleResult is a sampled sequence.
+type sampleResult struct {
+	States []hmm.State `json:"states"`
+	Obs    []hmm.Obs   `json:"obs"`
+}
+
+func (s *Server) sample(h *hmm.HMM, req *request, seqs [][]hmm.Obs) (interface{}, error) {
+	if len(seqs) != 0 {
+		return nil, errors.New("sample does not take sequences")
+	} else if req.Count < 0 || req.MaxLen < 0 {
+		return nil, errors.New("count and max_len must be non-negative")
+	} else if req.MaxLen == 0 && h.TerminalState == nil {
+		return nil, errors.New("max_len is required for models without a terminal state")
+	}
+	count := req.Count
+	if count == 0 {
+		count = 1
+	}
+	seed := req.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	res := make([]sampleResult, count)
+	err := s.each(count, func(i int) {
+		gen := rand.New(rand.NewSource(seed + int64(i)))
+		var states []hmm.State
+		var obs []hmm.Obs
+		if req.MaxLen > 0 {
+			states, obs = h.SampleLen(gen, req.MaxLen)
+		} else {
+			states, obs = h.Sample(gen)
+		}
+		if states == nil {
+			states = []hmm.State{}
+		}
+		if obs == nil {
+			obs = []hmm.Obs{}
+		}
+		res[i] = sampleResult{States: states, Obs: obs}
+	})
+	return map[string]interface{}{"samples": res}, err
+}
+
+// decodeSequence decodes a JSON list of observations.
+//
+// Integers become ints and other numbers become float64s,
+// matching hmm.DecodeJSON.
+func decodeSequence(data json.RawMessage) ([]hmm.Obs, error) {
+	var raw []interface{}
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+	res := make([]hmm.Obs, len(raw))
+	for i, value := range raw {
+		obs, err := decodeObs(value)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = obs
+	}
+	return res, nil
+}
+
+func decodeObs(value interface{}) (hmm.Obs, error) {
+	switch value := value.(type) {
+	case nil, string, bool:
+		return value, nil
+	case json.Number:
+		if x, err := value.Int64(); err == nil && int64(int(x)) == x {
+			return int(x), nil
+		}
+		return value.Float64()
+	case []interface{}:
+		vec := make([]float64, len(value))
+		for i, x := range value {
+			num, ok := x.(json.Number)
+			if !ok {
+				return nil, errors.New("vector observations must contain numbers")
+			}
+			f, err := num.Float64()
+			if err != nil {
+				return nil, err
+			}
+			vec[i] = f
+		}
+		return vec, nil
+	default:
+		return nil, fmt.Errorf("unsupported observation: %v", value)
+	}
+}
+
+func loadModelFile(path string) (m *model, err error) {
+	defer essentials.AddCtxTo("load model file", &err)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var h *hmm.HMM
+	if strings.HasSuffix(path, ".json") {
+		h, err = hmm.DecodeJSON(data)
+	} else {
+		h, err = hmm.DeserializeHMM(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &model{HMM: h, Path: path, ModTime: info.ModTime()}, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
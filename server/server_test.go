@@ -0,0 +1,356 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/unixpickle/hmm"
+)
+
+func TestServerModels(t *testing.T) {
+	s, ts := testingServer()
+	defer s.Close()
+	defer ts.Close()
+
+	var res struct {
+		Models []string `json:"models"`
+	}
+	resp, err := http.Get(ts.URL + "/models")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res.Models, []string{"gaussian", "tabular"}) {
+		t.Errorf("unexpected models: %v", res.Models)
+	}
+}
+
+func TestServerDecode(t *testing.T) {
+	s, ts := testingServer()
+	defer s.Close()
+	defer ts.Close()
+
+	var res struct {
+		States [][]string `json:"states"`
+	}
+	postJSON(t, ts, "/decode", http.StatusOK, map[string]interface{}{
+		"model":     "tabular",
+		"sequences": [][]interface{}{{"x", "y", "y"}, {}, {"x", "q"}},
+	}, &res)
+	h := tabularTestingHMM()
+	expected := [][]string{
+		statesToStrings(hmm.MostLikely(h, []hmm.Obs{"x", "y", "y"})),
+		statesToStrings(hmm.MostLikely(h, []hmm.Obs{})),
+		nil,
+	}
+	if !reflect.DeepEqual(res.States, expected) {
+		t.Errorf("expected %v but got %v", expected, res.States)
+	}
+}
+
+func TestServerPosterior(t *testing.T) {
+	s, ts := testingServer()
+	defer s.Close()
+	defer ts.Close()
+
+	var res struct {
+		Distributions [][][]struct {
+			State string  `json:"state"`
+			Prob  float64 `json:"prob"`
+		} `json:"distributions"`
+	}
+	seq := []hmm.Obs{"x", "y", "x"}
+	postJSON(t, ts, "/posterior", http.StatusOK, map[string]interface{}{
+		"model":     "tabular",
+		"sequences": [][]hmm.Obs{seq, {"q"}},
+	}, &res)
+	if len(res.Distributions) != 2 || res.Distributions[1] != nil {
+		t.Fatalf("unexpected result: %v", res.Distributions)
+	}
+	fb := hmm.NewForwardBackward(tabularTestingHMM(), seq)
+	for i, dist := range res.Distributions[0] {
+		expected := fb.Dist(i)
+		if len(dist) != len(expected) {
+			t.Errorf("time %d: expected %d states but got %d", i, len(expected), len(dist))
+		}
+		for _, entry := range dist {
+			if math.Abs(entry.Prob-math.Exp(expected[entry.State])) > 1e-8 {
+				t.Errorf("time %d state %s: expected %f but got %f", i, entry.State,
+					math.Exp(expected[entry.State]), entry.Prob)
+			}
+		}
+	}
+}
+
+func TestServerLogLikelihood(t *testing.T) {
+	s, ts := testingServer()
+	defer s.Close()
+	defer ts.Close()
+
+	var res struct {
+		LogLikelihoods []*float64 `json:"log_likelihoods"`
+	}
+	seqs := [][]hmm.Obs{
+		{[]float64{0.5, 1}, nil, []float64{-1, 2}},
+		{[]float64{0, 0}},
+	}
+	postJSON(t, ts, "/loglikelihood", http.StatusOK, map[string]interface{}{
+		"model":     "gaussian",
+		"sequences": seqs,
+	}, &res)
+	if len(res.LogLikelihoods) != len(seqs) {
+		t.Fatalf("unexpected result: %v", res.LogLikelihoods)
+	}
+	for i, seq := range seqs {
+		expected := hmm.LogLikelihood(gaussianTestingHMM(), seq)
+		actual := res.LogLikelihoods[i]
+		if actual == nil || math.Abs(*actual-expected) > 1e-8 {
+			t.Errorf("sequence %d: expected %f but got %v", i, expected, actual)
+		}
+	}
+
+	// Impossible sequences have no log-likelihood.
+	postJSON(t, ts, "/loglikelihood", http.StatusOK, map[string]interface{}{
+		"model":     "tabular",
+		"sequences": [][]hmm.Obs{{"q"}},
+	}, &res)
+	if len(res.LogLikelihoods) != 1 || res.LogLikelihoods[0] != nil {
+		t.Errorf("unexpected result: %v", res.LogLikelihoods)
+	}
+}
+
+func TestServerSample(t *testing.T) {
+	s, ts := testingServer()
+	defer s.Close()
+	defer ts.Close()
+
+	type sampleResponse struct {
+		Samples []struct {
+			States []string `json:"states"`
+			Obs    []string `json:"obs"`
+		} `json:"samples"`
+	}
+	req := map[string]interface{}{"model": "tabular", "count": 5, "seed": 1337}
+	var res, res2 sampleResponse
+	postJSON(t, ts, "/sample", http.StatusOK, req, &res)
+	postJSON(t, ts, "/sample", http.StatusOK, req, &res2)
+	if len(res.Samples) != 5 {
+		t.Fatalf("expected 5 samples but got %d", len(res.Samples))
+	}
+	if !reflect.DeepEqual(res, res2) {
+		t.Error("samples with the same seed should match")
+	}
+	for _, sample := range res.Samples {
+		if len(sample.States) != len(sample.Obs) {
+			t.Errorf("mismatched sample: %v", sample)
+		}
+	}
+
+	req["max_len"] = 2
+	postJSON(t, ts, "/sample", http.StatusOK, req, &res)
+	for _, sample := range res.Samples {
+		if len(sample.Obs) > 2 {
+			t.Errorf("sample exceeds max_len: %v", sample)
+		}
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	s, ts := testingServer()
+	defer s.Close()
+	defer ts.Close()
+
+	var res struct {
+		Error string `json:"error"`
+	}
+	cases := []struct {
+		Path   string
+		Body   interface{}
+		Status int
+	}{
+		{"/decode", map[string]interface{}{"model": "missing"}, http.StatusNotFound},
+		{"/decode", map[string]interface{}{"model": "tabular", "extra": 1},
+			http.StatusBadRequest},
+		{"/decode", map[string]interface{}{"model": "tabular", "sequences": []interface{}{"x"}},
+			http.StatusBadRequest},
+		{"/decode", map[string]interface{}{"model": "gaussian",
+			"sequences": [][]interface{}{{"x"}}}, http.StatusBadRequest},
+		{"/sample", map[string]interface{}{"model": "tabular", "count": -1},
+			http.StatusBadRequest},
+		{"/sample", map[string]interface{}{"model": "tabular",
+			"sequences": [][]interface{}{{"x"}}}, http.StatusBadRequest},
+	}
+	for i, c := range cases {
+		res.Error = ""
+		postJSON(t, ts, c.Path, c.Status, c.Body, &res)
+		if res.Error == "" {
+			t.Errorf("case %d: missing error message", i)
+		}
+	}
+
+	resp, err := http.Get(ts.URL + "/decode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("unexpected status for GET: %d", resp.StatusCode)
+	}
+}
+
+func TestServerReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hmm-server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "model.json")
+	writeModel := func(h *hmm.HMM, modTime time.Time) {
+		data, err := hmm.EncodeJSON(h, hmm.LogSpace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	writeModel(tabularTestingHMM(), now.Add(-time.Hour))
+
+	s := New(nil)
+	defer s.Close()
+	if err := s.LoadModel("model", path); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	logLikelihood := func() float64 {
+		var res struct {
+			LogLikelihoods []float64 `json:"log_likelihoods"`
+		}
+		postJSON(t, ts, "/loglikelihood", http.StatusOK, map[string]interface{}{
+			"model":     "model",
+			"sequences": [][]hmm.Obs{{"x"}},
+		}, &res)
+		return res.LogLikelihoods[0]
+	}
+	oldLL := logLikelihood()
+
+	h := tabularTestingHMM()
+	h.Emitter.(hmm.TabularEmitter)["A"]["x"] = math.Log(0.9)
+	h.Emitter.(hmm.TabularEmitter)["A"]["y"] = math.Log(0.1)
+	writeModel(h, now)
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	newLL := logLikelihood()
+	if expected := hmm.LogLikelihood(h, []hmm.Obs{"x"}); math.Abs(newLL-expected) > 1e-8 {
+		t.Errorf("expected reloaded log-likelihood %f but got %f (old %f)", expected, newLL,
+			oldLL)
+	}
+
+	// A corrupt file should not replace the model.
+	if err := ioutil.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, now.Add(time.Hour), now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reload(); err == nil {
+		t.Error("expected reload error")
+	}
+	if ll := logLikelihood(); ll != newLL {
+		t.Errorf("expected log-likelihood %f but got %f", newLL, ll)
+	}
+}
+
+func testingServer() (*Server, *httptest.Server) {
+	s := New(&Config{Workers: 2, MaxBatch: 4})
+	s.AddModel("tabular", tabularTestingHMM())
+	s.AddModel("gaussian", gaussianTestingHMM())
+	return s, httptest.NewServer(s)
+}
+
+func postJSON(t *testing.T, ts *httptest.Server, path string, status int, body,
+	res interface{}) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(ts.URL+path, "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != status {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		t.Fatalf("%s: expected status %d but got %d: %s", path, status, resp.StatusCode, msg)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(res); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func statesToStrings(states []hmm.State) []string {
+	if states == nil {
+		return nil
+	}
+	res := make([]string, len(states))
+	for i, s := range states {
+		res[i] = s.(string)
+	}
+	return res
+}
+
+func tabularTestingHMM() *hmm.HMM {
+	return &hmm.HMM{
+		States: []hmm.State{"A", "B", "T"},
+		Emitter: hmm.TabularEmitter{
+			"A": map[hmm.Obs]float64{"x": math.Log(0.7), "y": math.Log(0.3)},
+			"B": map[hmm.Obs]float64{"x": math.Log(0.2), "y": math.Log(0.8)},
+		},
+		TerminalState: "T",
+		Init:          map[hmm.State]float64{"A": math.Log(0.6), "B": math.Log(0.4)},
+		Transitions: map[hmm.Transition]float64{
+			hmm.Transition{From: "A", To: "A"}: math.Log(0.5),
+			hmm.Transition{From: "A", To: "B"}: math.Log(0.3),
+			hmm.Transition{From: "A", To: "T"}: math.Log(0.2),
+			hmm.Transition{From: "B", To: "A"}: math.Log(0.3),
+			hmm.Transition{From: "B", To: "B"}: math.Log(0.5),
+			hmm.Transition{From: "B", To: "T"}: math.Log(0.2),
+		},
+	}
+}
+
+func gaussianTestingHMM() *hmm.HMM {
+	return &hmm.HMM{
+		States: []hmm.State{"A", "B"},
+		Emitter: hmm.GaussianEmitter{
+			"A": &hmm.Gaussian{Mean: []float64{0, 1}, Var: []float64{1, 2}},
+			"B": &hmm.Gaussian{Mean: []float64{-1, 0.5}, Var: []float64{0.5, 1}},
+		},
+		Init: map[hmm.State]float64{"A": math.Log(0.3), "B": math.Log(0.7)},
+		Transitions: map[hmm.Transition]float64{
+			hmm.Transition{From: "A", To: "A"}: math.Log(0.6),
+			hmm.Transition{From: "A", To: "B"}: math.Log(0.4),
+			hmm.Transition{From: "B", To: "A"}: math.Log(0.5),
+			hmm.Transition{From: "B", To: "B"}: math.Log(0.5),
+		},
+	}
+}
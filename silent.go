@@ -0,0 +1,159 @@
+package hmm
+
+import "math"
+
+// silentSet creates a set containing the non-terminal
+// silent states of the HMM.
+func silentSet(h *HMM) map[State]bool {
+	res := map[State]bool{}
+	for _, state := range h.SilentStates {
+		res[state] = true
+	}
+	return res
+}
+
+// silentMask computes, for each state index, whether or
+// not the state is silent.
+// The terminal state is considered silent.
+func silentMask(h *HMM, s2i map[State]int) []bool {
+	res := make([]bool, len(h.States))
+	for _, state := range h.SilentStates {
+		if idx, ok := s2i[state]; ok {
+			res[idx] = true
+		}
+	}
+	if h.TerminalState != nil {
+		if idx, ok := s2i[h.TerminalState]; ok {
+			res[idx] = true
+		}
+	}
+	return res
+}
+
+// silentOrder sorts the non-terminal silent states such
+// that no transition goes from a silent state to an
+// earlier silent state.
+//
+// If there is no such order, ErrSilentCycle is returned.
+func silentOrder(h *HMM, s2i map[State]int, silent []bool) ([]int, error) {
+	terminal := -1
+	if h.TerminalState != nil {
+		terminal = s2i[h.TerminalState]
+	}
+	isInner := func(idx int) bool {
+		return silent[idx] && idx != terminal
+	}
+
+	inDegrees := make([]int, len(h.States))
+	children := map[int][]int{}
+	for trans, prob := range h.Transitions {
+		from, to := s2i[trans.From], s2i[trans.To]
+		if math.IsInf(prob, -1) || !isInner(from) || !isInner(to) {
+			continue
+		}
+		inDegrees[to]++
+		children[from] = append(children[from], to)
+	}
+
+	var numSilent int
+	var res []int
+	for i := range h.States {
+		if isInner(i) {
+			numSilent++
+			if inDegrees[i] == 0 {
+				res = append(res, i)
+			}
+		}
+	}
+	for i := 0; i < len(res); i++ {
+		for _, child := range children[res[i]] {
+			inDegrees[child]--
+			if inDegrees[child] == 0 {
+				res = append(res, child)
+			}
+		}
+	}
+	if len(res) != numSilent {
+		return nil, ErrSilentCycle
+	}
+	return res, nil
+}
+
+// computeClosure fills in the closure-related fields of
+// the cache.
+func (c *hmmCache) computeClosure(h *HMM) {
+	c.Outgoing = make([][]fastTransition, len(h.States))
+	for _, trans := range fastTransitions(h, c.S2I) {
+		c.Outgoing[trans.From] = append(c.Outgoing[trans.From], trans)
+	}
+
+	c.InitClosure = newFastStateMapFrom(h, h.Init)
+	c.propagateSilent(c.InitClosure)
+	c.Init = newFastStateMap(h)
+	c.InitClosure.Iter(func(state int, prob float64) {
+		if c.isTarget(state) {
+			c.Init.Set(state, prob)
+		}
+	})
+
+	c.Closure = make([]*fastStateMap, len(h.States))
+	for from := range h.States {
+		if c.Silent[from] {
+			continue
+		}
+		closure := newFastStateMap(h)
+		for _, trans := range c.Outgoing[from] {
+			closure.AddLog(trans.To, trans.Prob)
+		}
+		c.propagateSilent(closure)
+		c.Closure[from] = closure
+		closure.Iter(func(to int, prob float64) {
+			if c.isTarget(to) {
+				c.Transitions = append(c.Transitions, fastTransition{
+					From: from,
+					To:   to,
+					Prob: prob,
+				})
+			}
+		})
+	}
+}
+
+// propagateSilent pushes probability mass from the silent
+// states in m to the states they lead to.
+// The silent states keep their entries in m.
+func (c *hmmCache) propagateSilent(m *fastStateMap) {
+	for _, state := range c.SilentOrder {
+		prob, ok := m.Get(state)
+		if !ok {
+			continue
+		}
+		for _, trans := range c.Outgoing[state] {
+			m.AddLog(trans.To, prob+trans.Prob)
+		}
+	}
+}
+
+// isTarget checks if a state is an endpoint of the silent
+// closure, i.e. an emitting state or the terminal state.
+func (c *hmmCache) isTarget(state int) bool {
+	return !c.Silent[state] || state == c.Terminal
+}
+
+// reachTarget computes, for every state, the log
+// probability of reaching the target state from that
+// state without making an emission.
+// The target itself is reached with probability 1.
+func (c *hmmCache) reachTarget(h *HMM, target int) *fastStateMap {
+	res := newFastStateMap(h)
+	res.Set(target, 0)
+	for i := len(c.SilentOrder) - 1; i >= 0; i-- {
+		state := c.SilentOrder[i]
+		for _, trans := range c.Outgoing[state] {
+			if prob, ok := res.Get(trans.To); ok {
+				res.AddLog(state, prob+trans.Prob)
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,173 @@
+package hmm
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSilentLogLikelihood(t *testing.T) {
+	h := silentTestingHMM()
+	folded := foldedSilentTestingHMM()
+	seqs := [][]Obs{
+		{},
+		{"x"},
+		{"x", "y"},
+		{"y", "y", "x"},
+		{"x", "x", "y", "x"},
+	}
+	for _, seq := range seqs {
+		expected := LogLikelihood(folded, seq)
+		actual := LogLikelihood(h, seq)
+		if math.Abs(actual-expected) > 1e-4 {
+			t.Errorf("sequence %v: expected %f but got %f", seq, expected, actual)
+		}
+		actual = NewForwardBackward(h, seq).LogLikelihood()
+		if math.Abs(actual-expected) > 1e-4 {
+			t.Errorf("sequence %v: expected %f but got %f", seq, expected, actual)
+		}
+	}
+}
+
+func TestSilentMostLikely(t *testing.T) {
+	h := silentTestingHMM()
+	actual := MostLikely(h, []Obs{"x", "y"})
+	expected := []State{"A", "S", "B"}
+	if !stateSeqsEqual(actual, expected) {
+		t.Errorf("expected %v but got %v", expected, actual)
+	}
+}
+
+func TestSilentSample(t *testing.T) {
+	h := silentTestingHMM()
+	for i := 0; i < 100; i++ {
+		states, obs := h.Sample(nil)
+		var numEmitting int
+		for _, state := range states {
+			if state != "S" {
+				numEmitting++
+			}
+		}
+		if numEmitting != len(obs) {
+			t.Fatalf("states %v do not match observations %v", states, obs)
+		}
+	}
+}
+
+func TestSilentBaumWelch(t *testing.T) {
+	h := silentTestingHMM()
+	samples := [][]Obs{{"x", "y"}, {"y"}, {"x", "x", "y"}, {}}
+	logLikelihood := func() float64 {
+		var sum float64
+		for _, sample := range samples {
+			sum += LogLikelihood(h, sample)
+		}
+		return sum
+	}
+	for i := 0; i < 3; i++ {
+		ch := make(chan []Obs, len(samples))
+		for _, sample := range samples {
+			ch <- sample
+		}
+		close(ch)
+		oldLikelihood := logLikelihood()
+		h = BaumWelch(h, ch, 0)
+		newLikelihood := logLikelihood()
+		if newLikelihood < oldLikelihood {
+			t.Errorf("expected new likelihood (%f) to be greater than %f", newLikelihood,
+				oldLikelihood)
+		}
+	}
+
+	initSum := math.Inf(-1)
+	for _, prob := range h.Init {
+		initSum = addLogs(initSum, prob)
+	}
+	if math.Abs(initSum) > 1e-4 {
+		t.Errorf("initial probabilities sum to %f", math.Exp(initSum))
+	}
+	transSums := map[State]float64{}
+	for trans, prob := range h.Transitions {
+		if _, ok := transSums[trans.From]; !ok {
+			transSums[trans.From] = math.Inf(-1)
+		}
+		transSums[trans.From] = addLogs(transSums[trans.From], prob)
+	}
+	for _, state := range []State{"A", "B", "S"} {
+		if math.Abs(transSums[state]) > 1e-4 {
+			t.Errorf("transitions from %v sum to %f", state, math.Exp(transSums[state]))
+		}
+	}
+}
+
+func TestSilentCycle(t *testing.T) {
+	h := silentTestingHMM()
+	h.States = append(h.States, "S2")
+	h.SilentStates = append(h.SilentStates, "S2")
+	h.Transitions[Transition{From: "S", To: "S2"}] = math.Log(0.1)
+	h.Transitions[Transition{From: "S2", To: "S"}] = 0
+
+	defer func() {
+		if r := recover(); r != ErrSilentCycle {
+			t.Errorf("expected ErrSilentCycle but got %v", r)
+		}
+	}()
+	LogLikelihood(h, []Obs{"x"})
+}
+
+// silentTestingHMM creates an HMM with a silent state S.
+func silentTestingHMM() *HMM {
+	return &HMM{
+		States: []State{"A", "B", "S", "T"},
+		Emitter: TabularEmitter{
+			"A": map[Obs]float64{
+				"x": math.Log(0.8),
+				"y": math.Log(0.2),
+			},
+			"B": map[Obs]float64{
+				"x": math.Log(0.1),
+				"y": math.Log(0.9),
+			},
+		},
+		TerminalState: "T",
+		SilentStates:  []State{"S"},
+		Init: map[State]float64{
+			"A": math.Log(0.6),
+			"S": math.Log(0.4),
+		},
+		Transitions: map[Transition]float64{
+			Transition{From: "A", To: "A"}: math.Log(0.2),
+			Transition{From: "A", To: "S"}: math.Log(0.5),
+			Transition{From: "A", To: "T"}: math.Log(0.3),
+
+			Transition{From: "S", To: "B"}: math.Log(0.7),
+			Transition{From: "S", To: "T"}: math.Log(0.3),
+
+			Transition{From: "B", To: "A"}: math.Log(0.4),
+			Transition{From: "B", To: "B"}: math.Log(0.3),
+			Transition{From: "B", To: "T"}: math.Log(0.3),
+		},
+	}
+}
+
+// foldedSilentTestingHMM is equivalent to silentTestingHMM
+// with the silent state folded into the transitions.
+func foldedSilentTestingHMM() *HMM {
+	h := silentTestingHMM()
+	h.States = []State{"A", "B", "T"}
+	h.SilentStates = nil
+	h.Init = map[State]float64{
+		"A": math.Log(0.6),
+		"B": math.Log(0.28),
+		"T": math.Log(0.12),
+	}
+	h.Transitions = map[Transition]float64{
+		Transition{From: "A", To: "A"}: math.Log(0.2),
+		Transition{From: "A", To: "B"}: math.Log(0.35),
+		Transition{From: "A", To: "T"}: math.Log(0.45),
+
+		Transition{From: "B", To: "A"}: math.Log(0.4),
+		Transition{From: "B", To: "B"}: math.Log(0.3),
+		Transition{From: "B", To: "T"}: math.Log(0.3),
+	}
+	return h
+}
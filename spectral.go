@@ -0,0 +1,331 @@
+package hmm
+
+import (
+	"math"
+	"math/rand"
+)
+
+// A SpectralHMM is an observable operator representation
+// of an HMM with discrete observations, as learned by
+// LearnSpectral.
+//
+// The probability of a sequence x_1, ..., x_t is
+//
+//	Final^T * Operators[x_t] * ... * Operators[x_1] * Init
+//
+// A SpectralHMM models the probability of sequence
+// prefixes; it does not model termination.
+type SpectralHMM struct {
+	// Obs lists the observations, which correspond to the
+	// entries of Operators.
+	Obs []Obs
+
+	Init      []float64
+	Final     []float64
+	Operators [][][]float64
+}
+
+// LearnSpectral estimates a SpectralHMM with the given
+// number of hidden states from the unigram, bigram, and
+// trigram statistics of the data, using the algorithm of
+// Hsu, Kakade, and Zhang.
+//
+// The initial vector is estimated from the first
+// observation of each sequence, while the remaining
+// statistics are gathered from every window of three
+// consecutive observations.
+// Windows containing missing observations are skipped.
+//
+// The number of states may not exceed the number of
+// distinct observations.
+// LearnSpectral panics if the statistics are too
+// degenerate to estimate the requested number of states.
+func LearnSpectral(data [][]Obs, numStates int) *SpectralHMM {
+	res := &SpectralHMM{}
+	obsIndices := map[Obs]int{}
+	for _, seq := range data {
+		for _, obs := range seq {
+			if obs == nil {
+				continue
+			}
+			if _, ok := obsIndices[obs]; !ok {
+				obsIndices[obs] = len(res.Obs)
+				res.Obs = append(res.Obs, obs)
+			}
+		}
+	}
+	numObs := len(res.Obs)
+	if numStates > numObs {
+		panic("more states than observations")
+	}
+
+	first := make([]float64, numObs)
+	unigrams := make([]float64, numObs)
+	bigrams := newMatrix(numObs, numObs)
+	trigrams := make([][][]float64, numObs)
+	for i := range trigrams {
+		trigrams[i] = newMatrix(numObs, numObs)
+	}
+	var numSeqs, numWindows float64
+	for _, seq := range data {
+		if len(seq) > 0 && seq[0] != nil {
+			first[obsIndices[seq[0]]]++
+			numSeqs++
+		}
+		for t := 0; t+2 < len(seq); t++ {
+			if seq[t] == nil || seq[t+1] == nil || seq[t+2] == nil {
+				continue
+			}
+			x1 := obsIndices[seq[t]]
+			x2 := obsIndices[seq[t+1]]
+			x3 := obsIndices[seq[t+2]]
+			unigrams[x1]++
+			bigrams[x2][x1]++
+			trigrams[x2][x3][x1]++
+			numWindows++
+		}
+	}
+	if numWindows == 0 || numSeqs == 0 {
+		panic("not enough data")
+	}
+	for i := range first {
+		first[i] /= numSeqs
+		unigrams[i] /= numWindows
+		for j := range bigrams[i] {
+			bigrams[i][j] /= numWindows
+			for k := range trigrams[i][j] {
+				trigrams[i][j][k] /= numWindows
+			}
+		}
+	}
+
+	// U stores the top left singular vectors of the
+	// bigram matrix.
+	_, vecs := symmetricEigen(matMul(bigrams, transpose(bigrams)))
+	u := newMatrix(numObs, numStates)
+	for i := range u {
+		copy(u[i], vecs[i][:numStates])
+	}
+	ut := transpose(u)
+
+	res.Init = matVec(ut, first)
+	finalInv, ok := pseudoInverse(transpose(matMul(transpose(bigrams), u)))
+	if !ok {
+		panic("degenerate bigram statistics")
+	}
+	res.Final = matVec(transpose(finalInv), unigrams)
+	bigramInv, ok := pseudoInverse(matMul(ut, bigrams))
+	if !ok {
+		panic("degenerate bigram statistics")
+	}
+	for _, trigram := range trigrams {
+		res.Operators = append(res.Operators, matMul(matMul(ut, trigram), bigramInv))
+	}
+	return res
+}
+
+// NumStates returns the number of hidden states.
+func (s *SpectralHMM) NumStates() int {
+	return len(s.Init)
+}
+
+// LogLikelihood computes the log probability of the
+// observation sequence.
+//
+// Missing observations are marginalized out.
+// Since the operators are only estimates, the computed
+// probability may be non-positive, in which case -Inf is
+// returned.
+// Unknown observations have probability 0.
+func (s *SpectralHMM) LogLikelihood(obs []Obs) float64 {
+	obsIndices := map[Obs]int{}
+	for i, o := range s.Obs {
+		obsIndices[o] = i
+	}
+	var sumOp [][]float64
+	state := s.Init
+	var res float64
+	for _, o := range obs {
+		var op [][]float64
+		if o == nil {
+			if sumOp == nil {
+				sumOp = s.sumOperator()
+			}
+			op = sumOp
+		} else if idx, ok := obsIndices[o]; ok {
+			op = s.Operators[idx]
+		} else {
+			return math.Inf(-1)
+		}
+		state = matVec(op, state)
+		norm := dot(s.Final, state)
+		if norm <= 0 {
+			return math.Inf(-1)
+		}
+		res += math.Log(norm)
+		for i := range state {
+			state[i] /= norm
+		}
+	}
+	return res
+}
+
+// HMM converts the observable operators into an
+// approximate HMM with int states and no terminal state.
+//
+// The conversion jointly diagonalizes the normalized
+// operators to recover the emission probabilities, and
+// then recovers the transition and initial probabilities.
+// Estimation errors are corrected by clipping small or
+// negative probabilities and renormalizing, so the result
+// is best used as an initialization for BaumWelch.
+//
+// The generator gen is used to pick random combinations
+// of operators to diagonalize.
+// It may be nil.
+func (s *SpectralHMM) HMM(gen *rand.Rand) *HMM {
+	const minProb = 1e-4
+
+	numStates := s.NumStates()
+	sumOp := s.sumOperator()
+	sumInv, ok := invertMatrix(sumOp)
+	if !ok {
+		panic("singular operators")
+	}
+
+	normOps := make([][][]float64, len(s.Operators))
+	for i, op := range s.Operators {
+		normOps[i] = matMul(sumInv, op)
+	}
+
+	// The eigenvectors are the columns of U^T*O, scaled so
+	// that Final^T*U^T*O is the vector of all ones.
+	vecs := s.bestEigenvectors(gen, normOps)
+	for col := 0; col < numStates; col++ {
+		var scale float64
+		for row := range vecs {
+			scale += s.Final[row] * vecs[row][col]
+		}
+		if scale != 0 {
+			for row := range vecs {
+				vecs[row][col] /= scale
+			}
+		}
+	}
+	vecsInv, ok := invertMatrix(vecs)
+	if !ok {
+		panic("singular eigenvectors")
+	}
+
+	res := &HMM{
+		Init:        map[State]float64{},
+		Transitions: map[Transition]float64{},
+	}
+	for i := 0; i < numStates; i++ {
+		res.States = append(res.States, i)
+	}
+
+	emissions := newMatrix(numStates, len(s.Obs))
+	for x, op := range normOps {
+		diag := matMul(matMul(vecsInv, op), vecs)
+		for state := range emissions {
+			emissions[state][x] = diag[state][state]
+		}
+	}
+	emitter := TabularEmitter{}
+	for state, row := range emissions {
+		emitter[state] = map[Obs]float64{}
+		for x, prob := range clippedLogDist(row, minProb) {
+			emitter[state][s.Obs[x]] = prob
+		}
+	}
+	res.Emitter = emitter
+
+	// trans[i][j] is the probability of moving from i to j.
+	trans := transpose(matMul(matMul(vecsInv, sumOp), vecs))
+	for from, row := range trans {
+		for to, prob := range clippedLogDist(row, minProb) {
+			res.Transitions[Transition{From: from, To: to}] = prob
+		}
+	}
+
+	for state, prob := range clippedLogDist(matVec(vecsInv, s.Init), minProb) {
+		res.Init[state] = prob
+	}
+
+	return res
+}
+
+// bestEigenvectors diagonalizes several random convex
+// combinations of the normalized operators and returns the
+// eigenvectors of the one whose eigenvalues are the most
+// separated.
+// Nearly equal eigenvalues make the eigenvectors, and thus
+// the recovered parameters, very sensitive to estimation
+// error.
+func (s *SpectralHMM) bestEigenvectors(gen *rand.Rand, normOps [][][]float64) [][]float64 {
+	const numCombinations = 20
+
+	var bestVecs [][]float64
+	bestGap := -1.0
+	for i := 0; i < numCombinations; i++ {
+		coeffs := make([]float64, len(normOps))
+		var coeffSum float64
+		for j := range coeffs {
+			if gen != nil {
+				coeffs[j] = gen.Float64()
+			} else {
+				coeffs[j] = rand.Float64()
+			}
+			coeffSum += coeffs[j]
+		}
+		combination := newMatrix(s.NumStates(), s.NumStates())
+		for j, op := range normOps {
+			for k, row := range op {
+				for l, x := range row {
+					combination[k][l] += coeffs[j] / coeffSum * x
+				}
+			}
+		}
+		values, vecs := realEigen(combination)
+		gap := math.Inf(1)
+		for j, x := range values {
+			for _, y := range values[:j] {
+				gap = math.Min(gap, math.Abs(x-y))
+			}
+		}
+		if gap > bestGap {
+			bestGap = gap
+			bestVecs = vecs
+		}
+	}
+	return bestVecs
+}
+
+func (s *SpectralHMM) sumOperator() [][]float64 {
+	res := newMatrix(s.NumStates(), s.NumStates())
+	for _, op := range s.Operators {
+		for i, row := range op {
+			for j, x := range row {
+				res[i][j] += x
+			}
+		}
+	}
+	return res
+}
+
+// clippedLogDist clips the entries of an approximate
+// probability vector to a minimum value and converts it
+// to a normalized log distribution.
+func clippedLogDist(probs []float64, minProb float64) []float64 {
+	var sum float64
+	res := make([]float64, len(probs))
+	for i, prob := range probs {
+		res[i] = math.Max(prob, minProb)
+		sum += res[i]
+	}
+	for i := range res {
+		res[i] = math.Log(res[i] / sum)
+	}
+	return res
+}
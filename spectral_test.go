@@ -0,0 +1,125 @@
+package hmm
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestLearnSpectral(t *testing.T) {
+	gen := rand.New(rand.NewSource(1337))
+	target := spectralTestingHMM()
+	train := spectralTestingData(gen, target, 20000)
+	test := spectralTestingData(gen, target, 100)
+
+	model := LearnSpectral(train, 2)
+	if model.NumStates() != 2 {
+		t.Fatalf("expected 2 states but got %d", model.NumStates())
+	}
+	var totalErr float64
+	for _, seq := range test {
+		totalErr += math.Abs(model.LogLikelihood(seq) - LogLikelihood(target, seq))
+	}
+	if meanErr := totalErr / float64(len(test)); meanErr > 0.05 {
+		t.Errorf("mean log-likelihood error is %f", meanErr)
+	}
+
+	missing := []Obs{"x", nil, "z"}
+	expected := LogLikelihood(target, missing)
+	if actual := model.LogLikelihood(missing); math.Abs(actual-expected) > 0.05 {
+		t.Errorf("missing observation: expected %f but got %f", expected, actual)
+	}
+	if !math.IsInf(model.LogLikelihood([]Obs{"x", "w"}), -1) {
+		t.Error("expected unknown observation to be impossible")
+	}
+}
+
+func TestSpectralHMM(t *testing.T) {
+	gen := rand.New(rand.NewSource(1337))
+	target := spectralTestingHMM()
+	train := spectralTestingData(gen, target, 20000)
+
+	// The estimation error shrinks like 1/sqrt(N) in the
+	// number of observations.
+	// Across 200 random seeds, the median of the largest
+	// error was 5/sqrt(N) and the maximum was 12/sqrt(N),
+	// so 15/sqrt(N) leaves a small margin.
+	var numObs int
+	for _, seq := range train {
+		numObs += len(seq)
+	}
+	tolerance := 15 / math.Sqrt(float64(numObs))
+
+	h := LearnSpectral(train, 2).HMM(gen)
+	if len(h.States) != 2 {
+		t.Fatalf("unexpected states: %v", h.States)
+	}
+
+	// Match up the states using their emissions.
+	mapping := map[State]State{0: "A", 1: "B"}
+	if math.Exp(h.Emitter.LogProbs("x", 0)[0]) < 0.5 {
+		mapping = map[State]State{0: "B", 1: "A"}
+	}
+	for state, targetState := range mapping {
+		for _, obs := range []Obs{"x", "y", "z"} {
+			expected := math.Exp(target.Emitter.LogProbs(obs, targetState)[0])
+			actual := math.Exp(h.Emitter.LogProbs(obs, state)[0])
+			if math.Abs(actual-expected) > tolerance {
+				t.Errorf("emission %v from %v: expected %f but got %f", obs, targetState,
+					expected, actual)
+			}
+		}
+		for otherState, otherTarget := range mapping {
+			trans := Transition{From: targetState, To: otherTarget}
+			expected := math.Exp(target.Transitions[trans])
+			actual := math.Exp(h.Transitions[Transition{From: state, To: otherState}])
+			if math.Abs(actual-expected) > tolerance {
+				t.Errorf("transition %v: expected %f but got %f", trans, expected, actual)
+			}
+		}
+	}
+
+	trainLikelihood := totalLogLikelihood(h, train[:1000])
+	h = BaumWelch(h, obsChan(train[:1000]), 0)
+	if newLikelihood := totalLogLikelihood(h, train[:1000]); newLikelihood < trainLikelihood {
+		t.Errorf("BaumWelch decreased log-likelihood from %f to %f", trainLikelihood,
+			newLikelihood)
+	}
+}
+
+func spectralTestingHMM() *HMM {
+	return &HMM{
+		States: []State{"A", "B"},
+		Emitter: TabularEmitter{
+			"A": map[Obs]float64{
+				"x": math.Log(0.7),
+				"y": math.Log(0.2),
+				"z": math.Log(0.1),
+			},
+			"B": map[Obs]float64{
+				"x": math.Log(0.1),
+				"y": math.Log(0.3),
+				"z": math.Log(0.6),
+			},
+		},
+		Init: map[State]float64{
+			"A": math.Log(0.6),
+			"B": math.Log(0.4),
+		},
+		Transitions: map[Transition]float64{
+			Transition{From: "A", To: "A"}: math.Log(0.8),
+			Transition{From: "A", To: "B"}: math.Log(0.2),
+			Transition{From: "B", To: "A"}: math.Log(0.3),
+			Transition{From: "B", To: "B"}: math.Log(0.7),
+		},
+	}
+}
+
+func spectralTestingData(gen *rand.Rand, h *HMM, n int) [][]Obs {
+	var res [][]Obs
+	for i := 0; i < n; i++ {
+		_, obs := h.SampleLen(gen, 10)
+		res = append(res, obs)
+	}
+	return res
+}
@@ -0,0 +1,302 @@
+package hmm
+
+import (
+	"fmt"
+	"math"
+)
+
+// A LabeledSeq is an observation sequence along with the
+// hidden state for each observation.
+type LabeledSeq struct {
+	States []State
+	Obs    []Obs
+}
+
+// SupervisedMLE estimates an HMM from fully labeled
+// sequences by counting initial states, transitions, and
+// emissions.
+//
+// Without smoothing, the result is the maximum-likelihood
+// estimate.
+// With smoothing, pseudo-counts are added to the counts
+// before normalizing, which is equivalent to taking the
+// posterior mean under a Dirichlet prior.
+type SupervisedMLE struct {
+	// States lists the states of the model.
+	// States which appear in the data are added to the end.
+	// This can be used to fix the order of the states or to
+	// include states which never appear in the data.
+	States []State
+
+	// TerminalState, if non-nil, is added to the model, and
+	// the end of each sequence is counted as a transition
+	// to it.
+	// Otherwise, the end of each sequence is ignored.
+	TerminalState State
+
+	// AddK is a pseudo-count added to every initial state
+	// except TerminalState, every transition, and every
+	// emission of every observation in the vocabulary.
+	// Use InitPrior to give empty sequences probability
+	// beyond what the data implies.
+	AddK float64
+
+	// InitPrior, TransitionPrior, and EmissionPrior are
+	// Dirichlet pseudo-counts added to the corresponding
+	// counts, on top of AddK.
+	// EmissionPrior is shared by every state, so it can be
+	// used to back off to a global distribution.
+	//
+	// Every state in a prior must be a state of the model.
+	InitPrior       map[State]float64
+	TransitionPrior map[Transition]float64
+	EmissionPrior   map[Obs]float64
+
+	// UnknownObs, if non-nil, is an observation which
+	// stands in for observations outside the vocabulary.
+	// It is added to the vocabulary, and observations seen
+	// fewer than MinCount times are counted as UnknownObs.
+	// See ReplaceUnknown for applying the result to new
+	// data.
+	//
+	// Train panics if UnknownObs ends up with no counts,
+	// e.g. because MinCount is zero and there is no
+	// smoothing, since no state could emit it.
+	UnknownObs Obs
+	MinCount   int
+}
+
+// Train counts the labeled sequences and returns the
+// resulting model.
+// The model uses a TabularEmitter.
+//
+// Probabilities which would be zero are omitted.
+func (s *SupervisedMLE) Train(data <-chan LabeledSeq) *HMM {
+	states := append([]State{}, s.States...)
+	known := map[State]bool{}
+	for _, state := range states {
+		known[state] = true
+	}
+	addState := func(state State) {
+		if !known[state] {
+			known[state] = true
+			states = append(states, state)
+		}
+	}
+
+	initCounts := map[State]float64{}
+	transCounts := map[Transition]float64{}
+	emitCounts := map[State]map[Obs]float64{}
+	obsCounts := map[Obs]int{}
+	var vocab []Obs
+	for seq := range data {
+		if len(seq.States) != len(seq.Obs) {
+			panic("state count must match observation count")
+		}
+		var prev State
+		for i, state := range seq.States {
+			if state == s.TerminalState && s.TerminalState != nil {
+				panic("terminal state cannot emit observations")
+			}
+			addState(state)
+			if i == 0 {
+				initCounts[state]++
+			} else {
+				transCounts[Transition{From: prev, To: state}]++
+			}
+			prev = state
+			obs := seq.Obs[i]
+			if obs == nil {
+				// Missing observations only contribute to the
+				// transition counts.
+				continue
+			}
+			if emitCounts[state] == nil {
+				emitCounts[state] = map[Obs]float64{}
+			}
+			emitCounts[state][obs]++
+			if _, ok := obsCounts[obs]; !ok {
+				vocab = append(vocab, obs)
+			}
+			obsCounts[obs]++
+		}
+		if s.TerminalState != nil {
+			if len(seq.States) == 0 {
+				initCounts[s.TerminalState]++
+			} else {
+				transCounts[Transition{From: prev, To: s.TerminalState}]++
+			}
+		}
+	}
+
+	vocab = s.mergeRare(vocab, obsCounts, emitCounts)
+
+	res := &HMM{
+		States:        states,
+		Emitter:       TabularEmitter{},
+		TerminalState: s.TerminalState,
+		Init:          map[State]float64{},
+		Transitions:   map[Transition]float64{},
+	}
+	targets := states
+	if s.TerminalState != nil {
+		if known[s.TerminalState] {
+			panic("terminal state cannot be in States")
+		}
+		targets = append(append([]State{}, states...), s.TerminalState)
+		res.States = targets
+		known[s.TerminalState] = true
+	}
+
+	for state, count := range s.InitPrior {
+		s.checkPriorState(known, state)
+		initCounts[state] += count
+	}
+	for trans, count := range s.TransitionPrior {
+		s.checkPriorState(known, trans.From)
+		s.checkPriorState(known, trans.To)
+		transCounts[trans] += count
+	}
+	if s.AddK != 0 {
+		for _, state := range states {
+			initCounts[state] += s.AddK
+		}
+		for _, to := range targets {
+			for _, from := range states {
+				transCounts[Transition{From: from, To: to}] += s.AddK
+			}
+		}
+	}
+	for _, state := range states {
+		counts := emitCounts[state]
+		if counts == nil {
+			counts = map[Obs]float64{}
+			emitCounts[state] = counts
+		}
+		for obs, count := range s.EmissionPrior {
+			counts[obs] += count
+		}
+		if s.AddK != 0 {
+			for _, obs := range vocab {
+				counts[obs] += s.AddK
+			}
+		}
+	}
+
+	if s.UnknownObs != nil {
+		s.checkUnknownMass(emitCounts)
+	}
+
+	res.Init = normalizeCounts(initCounts)
+	fromCounts := map[State]map[State]float64{}
+	for trans, count := range transCounts {
+		if fromCounts[trans.From] == nil {
+			fromCounts[trans.From] = map[State]float64{}
+		}
+		fromCounts[trans.From][trans.To] = count
+	}
+	for from, counts := range fromCounts {
+		for to, prob := range normalizeCounts(counts) {
+			res.Transitions[Transition{From: from, To: to}] = prob
+		}
+	}
+	emitter := res.Emitter.(TabularEmitter)
+	for state, counts := range emitCounts {
+		var total float64
+		for _, count := range counts {
+			total += count
+		}
+		probs := map[Obs]float64{}
+		for obs, count := range counts {
+			if count > 0 {
+				probs[obs] = math.Log(count / total)
+			}
+		}
+		if len(probs) > 0 {
+			emitter[state] = probs
+		}
+	}
+	return res
+}
+
+// mergeRare moves the counts of rare observations to the
+// UnknownObs and returns the updated vocabulary.
+func (s *SupervisedMLE) mergeRare(vocab []Obs, obsCounts map[Obs]int,
+	emitCounts map[State]map[Obs]float64) []Obs {
+	if s.UnknownObs == nil {
+		return vocab
+	}
+	var res []Obs
+	for _, obs := range vocab {
+		if obs == s.UnknownObs || obsCounts[obs] >= s.MinCount {
+			res = append(res, obs)
+			continue
+		}
+		for _, counts := range emitCounts {
+			if count, ok := counts[obs]; ok {
+				counts[s.UnknownObs] += count
+				delete(counts, obs)
+			}
+		}
+	}
+	if _, ok := obsCounts[s.UnknownObs]; !ok {
+		res = append(res, s.UnknownObs)
+	}
+	return res
+}
+
+func (s *SupervisedMLE) checkUnknownMass(emitCounts map[State]map[Obs]float64) {
+	for _, counts := range emitCounts {
+		if counts[s.UnknownObs] > 0 {
+			return
+		}
+	}
+	panic(fmt.Sprintf("unknown observation %v has no counts (MinCount is %d)",
+		s.UnknownObs, s.MinCount))
+}
+
+func (s *SupervisedMLE) checkPriorState(known map[State]bool, state State) {
+	if !known[state] {
+		panic(fmt.Sprintf("prior references unknown state %v", state))
+	}
+}
+
+// normalizeCounts converts non-zero counts into log
+// probabilities.
+func normalizeCounts(counts map[State]float64) map[State]float64 {
+	var total float64
+	for _, count := range counts {
+		total += count
+	}
+	res := map[State]float64{}
+	for key, count := range counts {
+		if count > 0 {
+			res[key] = math.Log(count / total)
+		}
+	}
+	return res
+}
+
+// ReplaceUnknown replaces the observations which no state
+// of a TabularEmitter can emit with the unknown
+// observation, so that a model trained with
+// SupervisedMLE.UnknownObs can be applied to new data.
+//
+// Missing (nil) observations are left as they are.
+func ReplaceUnknown(e TabularEmitter, obs []Obs, unknown Obs) []Obs {
+	vocab := map[Obs]bool{}
+	for _, probs := range e {
+		for o := range probs {
+			vocab[o] = true
+		}
+	}
+	res := make([]Obs, len(obs))
+	for i, o := range obs {
+		if o == nil || vocab[o] {
+			res[i] = o
+		} else {
+			res[i] = unknown
+		}
+	}
+	return res
+}
@@ -0,0 +1,164 @@
+package hmm
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSupervisedMLE(t *testing.T) {
+	s := &SupervisedMLE{States: []State{"B"}, TerminalState: "T"}
+	h := s.Train(supervisedTestingData())
+	expected := &HMM{
+		States:        []State{"B", "A", "T"},
+		TerminalState: "T",
+		Init: map[State]float64{
+			"A": math.Log(2.0 / 4),
+			"B": math.Log(1.0 / 4),
+			"T": math.Log(1.0 / 4),
+		},
+		Transitions: map[Transition]float64{
+			Transition{From: "A", To: "A"}: math.Log(1.0 / 3),
+			Transition{From: "A", To: "B"}: math.Log(1.0 / 3),
+			Transition{From: "A", To: "T"}: math.Log(1.0 / 3),
+			Transition{From: "B", To: "T"}: 0,
+		},
+	}
+	checkHTKModelsEqual(t, expected, h)
+	checkSupervisedEmissions(t, h, map[State]map[Obs]float64{
+		"A": {"x": 2.0 / 3, "z": 1.0 / 3},
+		"B": {"y": 1},
+	})
+}
+
+func TestSupervisedMLESmoothing(t *testing.T) {
+	s := &SupervisedMLE{
+		AddK:            1,
+		InitPrior:       map[State]float64{"B": 2},
+		TransitionPrior: map[Transition]float64{Transition{From: "B", To: "A"}: 3},
+		EmissionPrior:   map[Obs]float64{"w": 0.5},
+	}
+	h := s.Train(supervisedTestingData())
+
+	// Without a terminal state, empty sequences and
+	// sequence endings are ignored.
+	expectedInit := map[State]float64{"A": 3.0 / 7, "B": 4.0 / 7}
+	for state, prob := range expectedInit {
+		if math.Abs(math.Exp(h.Init[state])-prob) > 1e-8 {
+			t.Errorf("init %v: expected %f but got %f", state, prob, math.Exp(h.Init[state]))
+		}
+	}
+	expectedTrans := map[Transition]float64{
+		Transition{From: "A", To: "A"}: 2.0 / 4,
+		Transition{From: "A", To: "B"}: 2.0 / 4,
+		Transition{From: "B", To: "A"}: 4.0 / 5,
+		Transition{From: "B", To: "B"}: 1.0 / 5,
+	}
+	for trans, prob := range expectedTrans {
+		if math.Abs(math.Exp(h.Transitions[trans])-prob) > 1e-8 {
+			t.Errorf("transition %v: expected %f but got %f", trans, prob,
+				math.Exp(h.Transitions[trans]))
+		}
+	}
+	checkSupervisedEmissions(t, h, map[State]map[Obs]float64{
+		"A": {"x": 3.0 / 6.5, "y": 1.0 / 6.5, "z": 2.0 / 6.5, "w": 0.5 / 6.5},
+		"B": {"x": 1.0 / 5.5, "y": 3.0 / 5.5, "z": 1.0 / 5.5, "w": 0.5 / 5.5},
+	})
+}
+
+func TestSupervisedMLESmoothingTerminal(t *testing.T) {
+	s := &SupervisedMLE{TerminalState: "T", AddK: 1}
+	h := s.Train(supervisedTestingData())
+
+	// Only the empty sequence in the data makes the
+	// terminal state an initial state.
+	expectedInit := map[State]float64{"A": 3.0 / 6, "B": 2.0 / 6, "T": 1.0 / 6}
+	for state, prob := range expectedInit {
+		if math.Abs(math.Exp(h.Init[state])-prob) > 1e-8 {
+			t.Errorf("init %v: expected %f but got %f", state, prob, math.Exp(h.Init[state]))
+		}
+	}
+	expectedTrans := map[Transition]float64{
+		Transition{From: "A", To: "A"}: 2.0 / 6,
+		Transition{From: "A", To: "B"}: 2.0 / 6,
+		Transition{From: "A", To: "T"}: 2.0 / 6,
+		Transition{From: "B", To: "A"}: 1.0 / 5,
+		Transition{From: "B", To: "B"}: 1.0 / 5,
+		Transition{From: "B", To: "T"}: 3.0 / 5,
+	}
+	for trans, prob := range expectedTrans {
+		if math.Abs(math.Exp(h.Transitions[trans])-prob) > 1e-8 {
+			t.Errorf("transition %v: expected %f but got %f", trans, prob,
+				math.Exp(h.Transitions[trans]))
+		}
+	}
+}
+
+func TestSupervisedMLEUnknown(t *testing.T) {
+	s := &SupervisedMLE{TerminalState: "T", UnknownObs: "<unk>", MinCount: 2}
+	h := s.Train(supervisedTestingData())
+	checkSupervisedEmissions(t, h, map[State]map[Obs]float64{
+		"A": {"x": 2.0 / 3, "<unk>": 1.0 / 3},
+		"B": {"y": 1},
+	})
+
+	emitter := h.Emitter.(TabularEmitter)
+	actual := ReplaceUnknown(emitter, []Obs{"x", "z", nil, "q", "y"}, "<unk>")
+	expected := []Obs{"x", "<unk>", nil, "<unk>", "y"}
+	for i, obs := range expected {
+		if actual[i] != obs {
+			t.Errorf("expected %v but got %v", expected, actual)
+			break
+		}
+	}
+}
+
+func TestSupervisedMLEPanics(t *testing.T) {
+	cases := map[string]*SupervisedMLE{
+		"unknown prior state":  {InitPrior: map[State]float64{"C": 1}},
+		"terminal in States":   {States: []State{"T"}, TerminalState: "T"},
+		"terminal in data":     {TerminalState: "A"},
+		"unknown with no mass": {UnknownObs: "<unk>"},
+	}
+	for name, s := range cases {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expected a panic", name)
+				}
+			}()
+			s.Train(supervisedTestingData())
+		}()
+	}
+}
+
+func supervisedTestingData() <-chan LabeledSeq {
+	data := []LabeledSeq{
+		{States: []State{"A", "B"}, Obs: []Obs{"x", "y"}},
+		{States: []State{"A", "A"}, Obs: []Obs{"x", "z"}},
+		{States: []State{"B"}, Obs: []Obs{"y"}},
+		{},
+	}
+	res := make(chan LabeledSeq, len(data))
+	for _, seq := range data {
+		res <- seq
+	}
+	close(res)
+	return res
+}
+
+func checkSupervisedEmissions(t *testing.T, h *HMM, expected map[State]map[Obs]float64) {
+	emitter := h.Emitter.(TabularEmitter)
+	if len(emitter) != len(expected) {
+		t.Errorf("expected emissions %v but got %v", expected, emitter)
+	}
+	for state, probs := range expected {
+		if len(emitter[state]) != len(probs) {
+			t.Errorf("state %v: expected %v but got %v", state, probs, emitter[state])
+		}
+		for obs, prob := range probs {
+			if actual := math.Exp(emitter[state][obs]); math.Abs(actual-prob) > 1e-8 {
+				t.Errorf("state %v obs %v: expected %f but got %f", state, obs, prob, actual)
+			}
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package hmm
 
 import (
+	"fmt"
 	"math"
 	"math/rand"
 	"reflect"
@@ -29,6 +30,121 @@ func sampleIndex(gen *rand.Rand, probs []float64) int {
 	return len(probs) - 1
 }
 
+// valueLess orders comparable values of any type, first
+// by type and then by value, so that the keys of a map can
+// be visited in a reproducible order.
+func valueLess(x, y interface{}) bool {
+	// Fast paths for the most common types.
+	switch x := x.(type) {
+	case string:
+		if y, ok := y.(string); ok {
+			return x < y
+		}
+	case int:
+		if y, ok := y.(int); ok {
+			return x < y
+		}
+	}
+
+	v1, v2 := reflect.ValueOf(x), reflect.ValueOf(y)
+	if t1, t2 := v1.Type(), v2.Type(); t1 != t2 {
+		return t1.String() < t2.String()
+	}
+	switch v1.Kind() {
+	case reflect.String:
+		return v1.String() < v2.String()
+	case reflect.Bool:
+		return !v1.Bool() && v2.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v1.Int() < v2.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v1.Uint() < v2.Uint()
+	case reflect.Float32, reflect.Float64:
+		return v1.Float() < v2.Float()
+	}
+	return fmt.Sprintf("%#v", x) < fmt.Sprintf("%#v", y)
+}
+
+// sampleLogIndex is like sampleIndex, but the weights are
+// unnormalized log probabilities.
+// At least one weight must be finite.
+func sampleLogIndex(gen *rand.Rand, logWeights []float64) int {
+	max := math.Inf(-1)
+	for _, w := range logWeights {
+		max = math.Max(max, w)
+	}
+	if math.IsInf(max, -1) {
+		panic("cannot sample from zero weights")
+	}
+	probs := make([]float64, len(logWeights))
+	var sum float64
+	for i, w := range logWeights {
+		probs[i] = math.Exp(w - max)
+		sum += probs[i]
+	}
+	for i := range probs {
+		probs[i] /= sum
+	}
+	return sampleIndex(gen, probs)
+}
+
+// sampleLogGamma samples the logarithm of a Gamma random
+// variable with the given shape and a scale of 1.
+//
+// Working in the log domain avoids underflow for small
+// shape parameters.
+func sampleLogGamma(gen *rand.Rand, shape float64) float64 {
+	uniform := func() float64 {
+		if gen != nil {
+			return gen.Float64()
+		}
+		return rand.Float64()
+	}
+	normal := func() float64 {
+		if gen != nil {
+			return gen.NormFloat64()
+		}
+		return rand.NormFloat64()
+	}
+	if shape < 1 {
+		// Use Gamma(a) = Gamma(a+1) * U^(1/a).
+		return sampleLogGamma(gen, shape+1) + math.Log(1-uniform())/shape
+	}
+
+	// Marsaglia and Tsang's method.
+	d := shape - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := normal()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := 1 - uniform()
+		if math.Log(u) < 0.5*x*x+d-d*v+d*math.Log(v) {
+			return math.Log(d * v)
+		}
+	}
+}
+
+// sampleLogDirichlet samples a probability vector from a
+// Dirichlet distribution with the given concentrations.
+//
+// The probabilities are expressed in the log domain.
+func sampleLogDirichlet(gen *rand.Rand, concentrations []float64) []float64 {
+	res := make([]float64, len(concentrations))
+	sum := math.Inf(-1)
+	for i, c := range concentrations {
+		res[i] = sampleLogGamma(gen, c)
+		sum = addLogs(sum, res[i])
+	}
+	for i := range res {
+		res[i] -= sum
+	}
+	return res
+}
+
 // addLogs adds two numbers in the log domain.
 func addLogs(x1, x2 float64) float64 {
 	max := math.Max(x1, x2)
@@ -54,6 +170,32 @@ func addToState(m map[State]float64, s State, prob float64) {
 	}
 }
 
+// addToTransition is like addToState, but for a map of
+// transitions.
+func addToTransition(m map[Transition]float64, t Transition, prob float64) {
+	if math.IsInf(prob, -1) {
+		return
+	}
+	if lastProb, ok := m[t]; ok {
+		m[t] = addLogs(lastProb, prob)
+	} else {
+		m[t] = prob
+	}
+}
+
+// addToObs is like addToState, but for a map of
+// observations.
+func addToObs(m map[Obs]float64, o Obs, prob float64) {
+	if math.IsInf(prob, -1) {
+		return
+	}
+	if lastProb, ok := m[o]; ok {
+		m[o] = addLogs(lastProb, prob)
+	} else {
+		m[o] = prob
+	}
+}
+
 // randomDist generates a random probability distribution.
 //
 // The probabilities are expressed in the log domain.
@@ -76,6 +218,40 @@ func randomDist(gen *rand.Rand, n int) []float64 {
 	return res
 }
 
+// digamma computes the derivative of math.Lgamma for a
+// positive argument.
+func digamma(x float64) float64 {
+	var res float64
+	for x < 6 {
+		res -= 1 / x
+		x++
+	}
+	f := 1 / (x * x)
+	return res + math.Log(x) - 0.5/x -
+		f*(1.0/12-f*(1.0/120-f*(1.0/252-f*(1.0/240-f/132))))
+}
+
+// obsChan creates a closed channel containing the
+// sequences.
+func obsChan(seqs [][]Obs) <-chan []Obs {
+	res := make(chan []Obs, len(seqs))
+	for _, seq := range seqs {
+		res <- seq
+	}
+	close(res)
+	return res
+}
+
+// totalLogLikelihood computes the sum of the sequences'
+// log-likelihoods.
+func totalLogLikelihood(h *HMM, seqs [][]Obs) float64 {
+	var sum float64
+	for _, seq := range seqs {
+		sum += LogLikelihood(h, seq)
+	}
+	return sum
+}
+
 func serializersComparable(slices ...[]serializer.Serializer) bool {
 	for _, slice := range slices {
 		for _, item := range slice {
@@ -4,6 +4,7 @@ import (
 	"math"
 	"math/rand"
 	"runtime"
+	"testing"
 
 	"golang.org/x/net/context"
 )
@@ -105,3 +106,14 @@ func sampleConditionalHidden(ctx context.Context, h *HMM, out []Obs) <-chan []St
 	}
 	return res
 }
+
+func TestValueLess(t *testing.T) {
+	sorted := []interface{}{false, true, -2, 3, 10, "a", "b", uint8(1)}
+	for i, x := range sorted {
+		for j, y := range sorted {
+			if valueLess(x, y) != (i < j) {
+				t.Errorf("valueLess(%#v, %#v) should be %v", x, y, i < j)
+			}
+		}
+	}
+}
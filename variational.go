@@ -0,0 +1,396 @@
+package hmm
+
+import "math"
+
+// VariationalBayes trains an HMM with mean-field
+// variational Bayes.
+//
+// The posterior over the parameters is approximated by
+// independent Dirichlet distributions over Init, each row
+// of Transitions, and each row of a TabularEmitter.
+// The E-step runs forward-backward on a sub-normalized
+// model whose parameters are the expected log-parameters
+// under the approximate posterior, and the M-step adds the
+// resulting expected counts to the prior.
+//
+// The structure of the initial model is preserved: states,
+// transitions, and observations with no entry in the
+// initial model keep a probability of 0.
+//
+// Like BaumWelch, VariationalBayes requires a
+// TabularEmitter.
+type VariationalBayes struct {
+	// InitPrior, TransPrior, and EmitPrior are the
+	// symmetric Dirichlet concentration parameters for the
+	// initial distribution, the transitions, and the
+	// emissions, respectively.
+	// If one is 0, then 1 is used.
+	//
+	// Concentrations below 1 favor sparse models, which
+	// makes it easier to prune unused states.
+	InitPrior  float64
+	TransPrior float64
+	EmitPrior  float64
+
+	// MaxIterations is the maximum number of iterations.
+	// If it is 0, then 100 is used.
+	MaxIterations int
+
+	// Tolerance, if non-zero, ends training once an
+	// iteration improves the evidence lower bound by less
+	// than Tolerance.
+	Tolerance float64
+
+	// PruneThreshold is the expected number of visits
+	// below which a state is removed from the model.
+	// If it is 0, then 0.01 is used.
+	// If it is negative, states are never pruned.
+	//
+	// The terminal state is never pruned.
+	PruneThreshold float64
+
+	// Parallelism is the number of sequences to process
+	// concurrently.
+	// If it is 0, then GOMAXPROCS is used.
+	Parallelism int
+}
+
+// A VBResult is the result of VariationalBayes training.
+type VBResult struct {
+	// Posterior is the approximate posterior.
+	Posterior *VBPosterior
+
+	// HMM uses the posterior mean parameters.
+	HMM *HMM
+
+	// ELBO stores the evidence lower bound at each
+	// iteration after the first.
+	// It never decreases, except on iterations after
+	// states are pruned.
+	ELBO []float64
+
+	// Pruned lists the states that were removed.
+	Pruned []State
+}
+
+// A VBPosterior stores the concentration parameters of a
+// set of Dirichlet distributions over the parameters of an
+// HMM.
+type VBPosterior struct {
+	States        []State
+	TerminalState State
+	SilentStates  []State
+
+	Init        map[State]float64
+	Transitions map[Transition]float64
+	Emissions   map[State]map[Obs]float64
+}
+
+// Mean creates an HMM using the posterior mean of every
+// parameter.
+func (v *VBPosterior) Mean() *HMM {
+	return v.model(func(conc, total float64) float64 {
+		return math.Log(conc) - math.Log(total)
+	})
+}
+
+// ExpectedLog creates an HMM using the expectation of the
+// logarithm of every parameter.
+//
+// The resulting probabilities do not sum to 1.
+func (v *VBPosterior) ExpectedLog() *HMM {
+	return v.model(func(conc, total float64) float64 {
+		return digamma(conc) - digamma(total)
+	})
+}
+
+// KL computes the KL divergence between the posterior and
+// a prior with the same structure.
+func (v *VBPosterior) KL(prior *VBPosterior) float64 {
+	var res float64
+	v.rows(prior, func(post, prior []float64) {
+		res += dirichletKL(post, prior)
+	})
+	return res
+}
+
+func (v *VBPosterior) model(param func(conc, total float64) float64) *HMM {
+	res := &HMM{
+		States:        v.States,
+		TerminalState: v.TerminalState,
+		SilentStates:  v.SilentStates,
+		Init:          map[State]float64{},
+		Transitions:   map[Transition]float64{},
+	}
+
+	var initTotal float64
+	for _, conc := range v.Init {
+		initTotal += conc
+	}
+	for state, conc := range v.Init {
+		res.Init[state] = param(conc, initTotal)
+	}
+
+	transTotals := map[State]float64{}
+	for t, conc := range v.Transitions {
+		transTotals[t.From] += conc
+	}
+	for t, conc := range v.Transitions {
+		res.Transitions[t] = param(conc, transTotals[t.From])
+	}
+
+	emitter := TabularEmitter{}
+	for state, row := range v.Emissions {
+		var total float64
+		for _, conc := range row {
+			total += conc
+		}
+		emitter[state] = map[Obs]float64{}
+		for obs, conc := range row {
+			emitter[state][obs] = param(conc, total)
+		}
+	}
+	res.Emitter = emitter
+
+	return res
+}
+
+// rows calls f with the concentrations of each Dirichlet
+// distribution in v and the corresponding distribution in
+// other.
+func (v *VBPosterior) rows(other *VBPosterior, f func(v, other []float64)) {
+	var init, otherInit []float64
+	for state, conc := range v.Init {
+		init = append(init, conc)
+		otherInit = append(otherInit, other.Init[state])
+	}
+	f(init, otherInit)
+
+	trans := map[State][]float64{}
+	otherTrans := map[State][]float64{}
+	for t, conc := range v.Transitions {
+		trans[t.From] = append(trans[t.From], conc)
+		otherTrans[t.From] = append(otherTrans[t.From], other.Transitions[t])
+	}
+	for from, row := range trans {
+		f(row, otherTrans[from])
+	}
+
+	for state, row := range v.Emissions {
+		var concs, otherConcs []float64
+		for obs, conc := range row {
+			concs = append(concs, conc)
+			otherConcs = append(otherConcs, other.Emissions[state][obs])
+		}
+		f(concs, otherConcs)
+	}
+}
+
+// prune removes the given states.
+func (v *VBPosterior) prune(states map[State]bool) {
+	var newStates []State
+	for _, state := range v.States {
+		if !states[state] {
+			newStates = append(newStates, state)
+		}
+	}
+	v.States = newStates
+
+	var newSilent []State
+	for _, state := range v.SilentStates {
+		if !states[state] {
+			newSilent = append(newSilent, state)
+		}
+	}
+	v.SilentStates = newSilent
+
+	for state := range states {
+		delete(v.Init, state)
+		delete(v.Emissions, state)
+	}
+	for t := range v.Transitions {
+		if states[t.From] || states[t.To] {
+			delete(v.Transitions, t)
+		}
+	}
+}
+
+// Train runs variational Bayes starting from the
+// parameters of h.
+func (v *VariationalBayes) Train(h *HMM, data [][]Obs) *VBResult {
+	numIters := v.MaxIterations
+	if numIters == 0 {
+		numIters = 100
+	}
+	threshold := v.PruneThreshold
+	if threshold == 0 {
+		threshold = 0.01
+	}
+
+	prior := v.prior(h)
+	posterior := v.prior(h)
+	res := &VBResult{}
+	model := h
+	for iter := 0; iter < numIters; iter++ {
+		seqs := obsChan(data)
+		bw := baumWelchWorkers(model, v.Parallelism, func(bw *baumWelch) {
+			for seq := range seqs {
+				bw.Accumulate(seq, nil, 1)
+			}
+		})
+		converged := false
+		if iter > 0 {
+			elbo := totalLogLikelihood(model, data) - posterior.KL(prior)
+			if len(res.ELBO) > 0 && v.Tolerance != 0 &&
+				elbo-res.ELBO[len(res.ELBO)-1] < v.Tolerance {
+				converged = true
+			}
+			res.ELBO = append(res.ELBO, elbo)
+		}
+
+		bw.expandSilent()
+		v.update(posterior, prior, bw)
+		if threshold > 0 {
+			pruned := v.unusedStates(bw, threshold)
+			if len(pruned) > 0 {
+				posterior.prune(pruned)
+				prior.prune(pruned)
+				for _, state := range bw.HMM.States {
+					if pruned[state] {
+						res.Pruned = append(res.Pruned, state)
+					}
+				}
+			}
+		}
+		if converged {
+			break
+		}
+		model = posterior.ExpectedLog()
+	}
+
+	res.Posterior = posterior
+	res.HMM = posterior.Mean()
+	return res
+}
+
+// prior creates the prior with the structure of h.
+func (v *VariationalBayes) prior(h *HMM) *VBPosterior {
+	initPrior := v.InitPrior
+	if initPrior == 0 {
+		initPrior = 1
+	}
+	transPrior := v.TransPrior
+	if transPrior == 0 {
+		transPrior = 1
+	}
+	emitPrior := v.EmitPrior
+	if emitPrior == 0 {
+		emitPrior = 1
+	}
+
+	res := &VBPosterior{
+		States:        append([]State{}, h.States...),
+		TerminalState: h.TerminalState,
+		SilentStates:  append([]State{}, h.SilentStates...),
+		Init:          map[State]float64{},
+		Transitions:   map[Transition]float64{},
+		Emissions:     map[State]map[Obs]float64{},
+	}
+	for state := range h.Init {
+		res.Init[state] = initPrior
+	}
+	for t := range h.Transitions {
+		res.Transitions[t] = transPrior
+	}
+	emitter, ok := h.Emitter.(TabularEmitter)
+	if !ok {
+		panic("variational Bayes requires a TabularEmitter")
+	}
+	for state, row := range emitter {
+		res.Emissions[state] = map[Obs]float64{}
+		for obs := range row {
+			res.Emissions[state][obs] = emitPrior
+		}
+	}
+	return res
+}
+
+// update sets the posterior to the prior plus the
+// expected counts from bw.
+func (v *VariationalBayes) update(posterior, prior *VBPosterior, bw *baumWelch) {
+	count := func(tally *fastStateMap, idx int) float64 {
+		if prob, ok := tally.Get(idx); ok {
+			return math.Exp(prob)
+		}
+		return 0
+	}
+	for state, conc := range prior.Init {
+		posterior.Init[state] = conc + count(bw.InitTally, bw.Cache.S2I[state])
+	}
+	for t, conc := range prior.Transitions {
+		from := bw.Cache.S2I[t.From]
+		posterior.Transitions[t] = conc + count(bw.TransTally[from], bw.Cache.S2I[t.To])
+	}
+	for state, row := range prior.Emissions {
+		tally := bw.EmitTally[bw.Cache.S2I[state]]
+		for obs, conc := range row {
+			posterior.Emissions[state][obs] = conc
+			if prob, ok := tally[obs]; ok {
+				posterior.Emissions[state][obs] += math.Exp(prob)
+			}
+		}
+	}
+}
+
+// unusedStates finds the non-terminal states whose
+// expected number of visits is below the threshold.
+//
+// At least one emitting state is always kept.
+func (v *VariationalBayes) unusedStates(bw *baumWelch, threshold float64) map[State]bool {
+	h := bw.HMM
+	visits := bw.InitTally.Copy()
+	for _, tally := range bw.TransTally {
+		tally.Iter(func(to int, count float64) {
+			visits.AddLog(to, count)
+		})
+	}
+	res := map[State]bool{}
+	var numEmitting int
+	for i, state := range h.States {
+		if i == bw.Cache.Terminal {
+			continue
+		}
+		if count, ok := visits.Get(i); !ok || math.Exp(count) < threshold {
+			res[state] = true
+		} else if !bw.Cache.Silent[i] {
+			numEmitting++
+		}
+	}
+	if numEmitting == 0 {
+		return map[State]bool{}
+	}
+	return res
+}
+
+// dirichletKL computes the KL divergence between two
+// Dirichlet distributions with the given concentrations.
+func dirichletKL(a, b []float64) float64 {
+	var sumA, sumB float64
+	for i := range a {
+		sumA += a[i]
+		sumB += b[i]
+	}
+	if len(a) == 0 {
+		return 0
+	}
+	lgamma := func(x float64) float64 {
+		res, _ := math.Lgamma(x)
+		return res
+	}
+	res := lgamma(sumA) - lgamma(sumB)
+	digammaSum := digamma(sumA)
+	for i := range a {
+		res += lgamma(b[i]) - lgamma(a[i]) + (a[i]-b[i])*(digamma(a[i])-digammaSum)
+	}
+	return res
+}
@@ -0,0 +1,127 @@
+package hmm
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestVariationalBayes(t *testing.T) {
+	gen := rand.New(rand.NewSource(1337))
+	target := testingHMM()
+	var data [][]Obs
+	for i := 0; i < 200; i++ {
+		_, obs := target.Sample(gen)
+		data = append(data, obs)
+	}
+	init := RandomHMM(gen, target.States, target.TerminalState, []Obs{"x", "y", "z"})
+
+	vb := &VariationalBayes{MaxIterations: 30, PruneThreshold: -1}
+	res := vb.Train(init, data)
+	if len(res.ELBO) != 29 {
+		t.Fatalf("expected 29 ELBO values but got %d", len(res.ELBO))
+	}
+	for i := 1; i < len(res.ELBO); i++ {
+		if res.ELBO[i] < res.ELBO[i-1]-1e-6 {
+			t.Errorf("iteration %d: ELBO decreased from %f to %f", i, res.ELBO[i-1],
+				res.ELBO[i])
+		}
+	}
+	expected := totalLogLikelihood(target, data)
+	if actual := totalLogLikelihood(res.HMM, data); actual < expected*1.05 {
+		t.Errorf("log-likelihood %f is much worse than %f", actual, expected)
+	}
+	if elbo := res.ELBO[len(res.ELBO)-1]; elbo > totalLogLikelihood(res.HMM, data) {
+		t.Errorf("ELBO %f exceeds the log-likelihood of the posterior mean", elbo)
+	}
+
+	vb.Tolerance = 1e-3
+	vb.MaxIterations = 1000
+	res = vb.Train(init, data)
+	if len(res.ELBO) >= 999 {
+		t.Error("training did not converge")
+	}
+}
+
+func TestVariationalBayesPruning(t *testing.T) {
+	gen := rand.New(rand.NewSource(1337))
+	target := testingHMM()
+	var data [][]Obs
+	for i := 0; i < 50; i++ {
+		_, obs := target.Sample(gen)
+		data = append(data, obs)
+	}
+
+	// State E is unreachable, so it should be pruned.
+	init := RandomHMM(gen, []State{"A", "B", "C", "D", "E"}, "D", []Obs{"x", "y", "z"})
+	delete(init.Init, "E")
+	for trans := range init.Transitions {
+		if trans.To == "E" {
+			delete(init.Transitions, trans)
+		}
+	}
+
+	res := (&VariationalBayes{MaxIterations: 5}).Train(init, data)
+	if len(res.Pruned) != 1 || res.Pruned[0] != "E" {
+		t.Fatalf("unexpected pruned states: %v", res.Pruned)
+	}
+	if len(res.HMM.States) != 4 {
+		t.Errorf("unexpected states: %v", res.HMM.States)
+	}
+	for trans := range res.HMM.Transitions {
+		if trans.From == "E" || trans.To == "E" {
+			t.Errorf("unexpected transition: %v", trans)
+		}
+	}
+	if _, ok := res.HMM.Emitter.(TabularEmitter)["E"]; ok {
+		t.Error("unexpected emissions for pruned state")
+	}
+	if math.IsInf(totalLogLikelihood(res.HMM, data), 0) {
+		t.Error("pruned model cannot explain the data")
+	}
+}
+
+func TestDirichletKL(t *testing.T) {
+	a := []float64{1.5, 0.3, 4}
+	b := []float64{1, 1, 2}
+	if kl := dirichletKL(a, a); math.Abs(kl) > 1e-8 {
+		t.Errorf("expected 0 but got %f", kl)
+	}
+
+	// Estimate KL(a || b) = E_a[log p_a(x) - log p_b(x)].
+	gen := rand.New(rand.NewSource(1337))
+	logDensity := func(conc []float64, logX []float64) float64 {
+		var sum float64
+		for _, c := range conc {
+			sum += c
+		}
+		lgSum, _ := math.Lgamma(sum)
+		res := lgSum
+		for i, c := range conc {
+			lg, _ := math.Lgamma(c)
+			res += (c-1)*logX[i] - lg
+		}
+		return res
+	}
+	var estimate float64
+	const numSamples = 200000
+	for i := 0; i < numSamples; i++ {
+		logX := sampleLogDirichlet(gen, a)
+		estimate += (logDensity(a, logX) - logDensity(b, logX)) / numSamples
+	}
+	if actual := dirichletKL(a, b); math.Abs(actual-estimate) > 0.02 {
+		t.Errorf("expected %f but got %f", estimate, actual)
+	}
+}
+
+func TestDigamma(t *testing.T) {
+	for _, x := range []float64{0.01, 0.3, 1, 2.5, 7, 30} {
+		const eps = 1e-6
+		hi, _ := math.Lgamma(x + eps)
+		lo, _ := math.Lgamma(x - eps)
+		expected := (hi - lo) / (2 * eps)
+		if actual := digamma(x); math.Abs(actual-expected) > 1e-4*math.Max(1, math.Abs(expected)) {
+			t.Errorf("digamma(%f): expected %f but got %f", x, expected, actual)
+		}
+	}
+}
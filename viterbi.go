@@ -7,7 +7,12 @@ import "math"
 //
 // If no hidden sequence can explain the observations, nil
 // is returned.
+//
+// Silent states on the most probable path are included in
+// the result, so it may be longer than obs.
 func MostLikely(h *HMM, obs []Obs) []State {
+	cache := newHMMCache(h)
+
 	// Maps the final state of a path to that path.
 	paths := map[State]*viterbiPath{}
 
@@ -17,11 +22,13 @@ func MostLikely(h *HMM, obs []Obs) []State {
 			LogProb: logProb,
 		}
 	}
+	viterbiSilent(h, cache, paths)
 
 	for i, o := range obs {
-		viterbiObservation(h, o, paths)
+		viterbiObservation(h, cache, o, paths)
 		if h.TerminalState != nil || i+1 < len(obs) {
 			paths = viterbiTransition(h, paths)
+			viterbiSilent(h, cache, paths)
 		}
 	}
 
@@ -47,12 +54,16 @@ func MostLikely(h *HMM, obs []Obs) []State {
 	return mostLikely.Seq
 }
 
-func viterbiObservation(h *HMM, obs Obs, paths map[State]*viterbiPath) {
+func viterbiObservation(h *HMM, c *hmmCache, obs Obs, paths map[State]*viterbiPath) {
 	var states []State
 	for state := range paths {
-		states = append(states, state)
+		if c.Silent[c.S2I[state]] {
+			delete(paths, state)
+		} else {
+			states = append(states, state)
+		}
 	}
-	emitProbs := h.Emitter.LogProbs(obs, states...)
+	emitProbs := emissionLogProbs(h.Emitter, obs, states...)
 	for i, state := range states {
 		path := paths[state]
 		path.LogProb += emitProbs[i]
@@ -83,6 +94,31 @@ func viterbiTransition(h *HMM, paths map[State]*viterbiPath) map[State]*viterbiP
 	return res
 }
 
+// viterbiSilent extends the paths through silent states,
+// replacing paths which are less likely than a silent
+// detour to the same state.
+func viterbiSilent(h *HMM, c *hmmCache, paths map[State]*viterbiPath) {
+	for _, idx := range c.SilentOrder {
+		oldPath, ok := paths[h.States[idx]]
+		if !ok {
+			continue
+		}
+		for _, trans := range c.Outgoing[idx] {
+			newProb := trans.Prob + oldPath.LogProb
+			if math.IsInf(newProb, -1) {
+				continue
+			}
+			to := h.States[trans.To]
+			if existing, ok := paths[to]; !ok || existing.LogProb < newProb {
+				paths[to] = &viterbiPath{
+					Seq:     append(append([]State{}, oldPath.Seq...), to),
+					LogProb: newProb,
+				}
+			}
+		}
+	}
+}
+
 type viterbiPath struct {
 	Seq     []State
 	LogProb float64